@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"os"
 	"github.com/c-jamie/sql-manager/clientlib/account"
+	"github.com/c-jamie/sql-manager/clientlib/gitrepo"
 	"github.com/c-jamie/sql-manager/clientlib/log"
 	migation "github.com/c-jamie/sql-manager/clientlib/migration"
+	"github.com/c-jamie/sql-manager/clientlib/project"
 	"github.com/c-jamie/sql-manager/clientlib/request"
 	"github.com/c-jamie/sql-manager/clientlib/script"
 	"github.com/c-jamie/sql-manager/clientlib/token"
@@ -29,6 +31,8 @@ type App struct {
 	Account    account.Account
 	Migration  migation.Migration
 	Script     script.Script
+	Project    project.Project
+	GitRepo    gitrepo.GitRepo
 }
 
 func getEnv(key, fallback string) string {
@@ -59,8 +63,15 @@ func New(level string) (*App, error) {
 	}
 
 	tok := token.New((server + "/" + urlVersion), home)
+	token, tokErr := tok.Get()
+	user := ""
+	if tokErr == nil && token.User != nil {
+		user = token.User.Email
+	}
 	scr := script.New((server + "/" + urlVersion))
-	mig := migation.New((server + "/" + urlVersion))
+	proj := project.New((server + "/" + urlVersion))
+	repo := gitrepo.New((server + "/" + urlVersion))
+	mig := migation.New((server + "/" + urlVersion), user)
 	acc := account.New(authURL + "/" + urlVersion, home)
 
 	app := &App{
@@ -71,9 +82,10 @@ func New(level string) (*App, error) {
 		Account:    acc,
 		Script:     scr,
 		Migration:  mig,
+		Project:    proj,
+		GitRepo:    repo,
 	}
-	token, err := tok.Get()
-	if err != nil {
+	if tokErr != nil {
 		return app, nil
 	} else {
 		if app.ServerURL == "" {
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/c-jamie/sql-manager/clientlib/app"
+	"github.com/c-jamie/sql-manager/clientlib/gitrepo"
+	"github.com/urfave/cli/v2"
+)
+
+// RepoAdd registers a git repo with the server
+func RepoAdd(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().Get(0)
+	url := c.Args().Get(1)
+	if name == "" || url == "" {
+		return fmt.Errorf("repo name and url are required")
+	}
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	repo, err := app.GitRepo.Add(name, url, c.String("branch"), c.String("credentials-ref"))
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to add repo", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "added repo", repo.Name)
+	return nil
+}
+
+// RepoList lists every git repo
+func RepoList(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	repos, err := app.GitRepo.List()
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to list repos", err)
+		return nil
+	}
+	gitrepo.ReposToTable(repos)
+	return nil
+}
+
+// RepoDelete removes a git repo which no project is bound to
+func RepoDelete(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("repo name is missing")
+	}
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	err = app.GitRepo.Delete(name)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete repo", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "deleted repo", name)
+	return nil
+}
@@ -1,13 +1,23 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"syscall"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/c-jamie/sql-manager/clientlib/app"
+	"github.com/c-jamie/sql-manager/clientlib/migrate"
 	sqlMig "github.com/c-jamie/sql-manager/clientlib/migration"
+	"github.com/c-jamie/sql-manager/clientlib/utils"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
 )
 
 
@@ -27,12 +37,21 @@ func MigrationAdd(c *cli.Context) error {
 	env := c.String("env")
 	table := c.String("table")
 
+	var dependsOn []*sqlMig.SQLMigrationDependencyRef
+	for _, d := range c.StringSlice("depends-on") {
+		dep, err := sqlMig.ParseDependency(d)
+		if err != nil {
+			return err
+		}
+		dependsOn = append(dependsOn, dep)
+	}
+
 	app, err := app.New(debug)
 	if err != nil {
 		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
 		return nil
 	}
-	err = app.Migration.Add(file, env, table)
+	err = app.Migration.Add(file, env, table, dependsOn)
 
 	if err != nil {
 		fmt.Println(cRe.Sprint("Error:"), "unable to add migrate", err)
@@ -43,6 +62,162 @@ func MigrationAdd(c *cli.Context) error {
 }
 
 
+// MigrationNew writes a new migration file for a table, numbered after the table's existing migrations
+func MigrationNew(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	table := c.Args().Get(0)
+	name := c.Args().Get(1)
+	if table == "" || name == "" {
+		return fmt.Errorf("table and name are required")
+	}
+	env := c.String("env")
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	migrations, err := app.Migration.Get(env, table)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get migrations", err)
+		return nil
+	}
+
+	order := 1
+	if migrations != nil {
+		for _, m := range append(append([]*sqlMig.SQLMigration{}, migrations.MigrationsUp...), migrations.MigrationsDown...) {
+			if m.FileOrder >= order {
+				order = m.FileOrder + 1
+			}
+		}
+	}
+
+	file := filepath.Join(c.String("dir"), migrate.FileName(order, name))
+	if utils.FileExists(file) {
+		fmt.Println(cRe.Sprint("Error:"), "unable to create migration -", file, "already exists")
+		return nil
+	}
+	err = ioutil.WriteFile(file, []byte(migrate.Scaffold(c.String("driver"), c.String("up"))), 0644)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to create migration", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "created", file)
+	fmt.Println("commit it and register it with", cCy.Sprint("migration add -e", env, "-t", table, "<git path>"))
+	return nil
+}
+
+
+// MigrationSchema shows the schema of a table captured after a migration, or the changes between two migrations
+func MigrationSchema(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	table := c.Args().Get(0)
+	if table == "" {
+		return fmt.Errorf("table is missing")
+	}
+	env := c.String("env")
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	schemas, err := app.Migration.Schemas(env, table)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get migration schemas", err)
+		return nil
+	}
+	if len(schemas) == 0 {
+		fmt.Println(cRe.Sprint("Error:"), "no schemas captured for", table, "in", env)
+		return nil
+	}
+	find := func(id int) *sqlMig.SQLMigrationSchema {
+		for _, s := range schemas {
+			if s.SQLMigrationID == id {
+				return s
+			}
+		}
+		return nil
+	}
+
+	at := schemas[len(schemas)-1]
+	if c.IsSet("at") {
+		at = find(c.Int("at"))
+		if at == nil {
+			fmt.Println(cRe.Sprint("Error:"), "no schema captured for migration", c.Int("at"))
+			return nil
+		}
+	}
+	if !c.IsSet("diff") {
+		sqlMig.MigrationSchemaToTable(*at)
+		return nil
+	}
+
+	from := find(c.Int("diff"))
+	if from == nil {
+		fmt.Println(cRe.Sprint("Error:"), "no schema captured for migration", c.Int("diff"))
+		return nil
+	}
+	changes := migrate.DiffSchema(&from.Schema, &at.Schema)
+	if len(changes) == 0 {
+		fmt.Println(cGr.Sprint("Success:"), "no schema changes between migration", from.SQLMigrationID, "and", at.SQLMigrationID)
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	return nil
+}
+
+
+// MigrationSync registers every migration in a git directory with the service
+func MigrationSync(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	dir := c.Args().Get(0)
+
+	if dir == "" {
+		return fmt.Errorf("dir is missing")
+	}
+	env := c.String("env")
+	table := c.String("table")
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	sync, err := app.Migration.Sync(dir, env, table)
+
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to sync migrations", err)
+		return nil
+	}
+	for _, m := range sync.Migrations {
+		fmt.Println(cCy.Sprint("Registered:"), m.File)
+	}
+	for _, m := range sync.Missing {
+		fmt.Println(cRe.Sprint("Missing:"), m.File, "is registered but no longer in git")
+	}
+	fmt.Println(cGr.Sprint("Success:"), len(sync.Migrations), "migrations registered")
+	return nil
+}
+
+
 // DoMigrations runs the migration for a given table and env
 func DoMigrations(c *cli.Context) error {
 
@@ -53,13 +228,175 @@ func DoMigrations(c *cli.Context) error {
 		debug = "debug"
 	}
 	table := c.Args().Get(0)
+	all := c.Bool("all")
+
+	if table == "" && !all {
+		return fmt.Errorf("table is missing")
+	}
+	env := c.String("env")
+
+	app, err := app.New(debug)
+	if err != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"unable to initialise client "+err.Error(), 2)
+	}
+
+	exec, err := newExecutor(c)
+	if err != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"unable to connect to the target database "+err.Error(), 2)
+	}
+	defer exec.Close()
+
+	// ctrl-c cancels the statement in flight, which is rolled back and left unapplied on the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if timeout := c.Duration("total-timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	opts := sqlMig.RunOptions{
+		AllowModified:    c.Bool("allow-modified"),
+		Parallel:         c.Int("parallel"),
+		Context:          ctx,
+		StatementTimeout: c.Duration("statement-timeout"),
+	}
+	// a run which fails, times out or is cancelled exits with 1 so scripts and ci can tell it apart from success
+	if all {
+		results, err := app.Migration.RunAll(exec, env, opts)
+		if err != nil {
+			return cli.Exit(cRe.Sprint("Error: ")+"unable to run migrations "+err.Error(), 1)
+		}
+		sqlMig.RunResultsToTable(results)
+		if ctx.Err() != nil {
+			return cli.Exit(cRe.Sprint("Error: ")+"migrations cancelled, the migrations in flight were rolled back "+ctx.Err().Error(), 1)
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Status != sqlMig.RunSuccess {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return cli.Exit(cRe.Sprint("Error: ")+fmt.Sprintf("%d tables were not fully migrated", failed), 1)
+		}
+		fmt.Println(cGr.Sprint("Success:"), "migrations applied")
+		return nil
+	}
+	err = app.Migration.Run(exec, env, table, opts)
+	if err != nil && ctx.Err() != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"migrations cancelled, the migration in flight was rolled back "+err.Error(), 1)
+	}
+	if err != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"unable to run migrations "+err.Error(), 1)
+	}
+	fmt.Println(cGr.Sprint("Success:"), "migrations applied")
+	return nil
+}
+
+
+// MigrationDAG lists every migration for an env in the order they are applied
+func MigrationDAG(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	env := c.String("env")
+	dag, err := app.Migration.DAG(env)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get migration dag", err)
+		return nil
+	}
+	sqlMig.MigrationDAGToTable(*dag)
+	return nil
+}
+
+
+// MigrationDiff shows the migrations which differ between two envs
+func MigrationDiff(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	source := c.Args().Get(0)
+	target := c.Args().Get(1)
+	if source == "" || target == "" {
+		return fmt.Errorf("source and target envs are required")
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	diff, err := app.Migration.Diff(source, target)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to diff migrations", err)
+		return nil
+	}
+	if len(diff.Tables) == 0 {
+		fmt.Println(cGr.Sprint("Success:"), source, "and", target, "are in sync")
+		return nil
+	}
+	sqlMig.MigrationDiffToTable(*diff)
+	return nil
+}
+
+
+// MigrationPromote registers the migrations of a table which are missing from the target env
+func MigrationPromote(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	source := c.Args().Get(0)
+	target := c.Args().Get(1)
+	table := c.Args().Get(2)
+	if source == "" || target == "" || table == "" {
+		return fmt.Errorf("source env, target env and table are required")
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	migs, err := app.Migration.Promote(source, target, table, c.Bool("require-applied"))
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to promote migrations", err)
+		return nil
+	}
+	for _, m := range migs {
+		fmt.Println(cCy.Sprint("Promoted:"), m.File)
+	}
+	fmt.Println(cGr.Sprint("Success:"), len(migs), "migrations promoted to", target)
+	return nil
+}
+
+
+// MigrationStatus compares the migrations applied according to the server with the log kept in the target database
+func MigrationStatus(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	table := c.Args().Get(0)
 
 	if table == "" {
 		return fmt.Errorf("table is missing")
 	}
 	env := c.String("env")
-	connection := c.String("connection")
-	driver := c.String("driver")
 
 	app, err := app.New(debug)
 	if err != nil {
@@ -67,12 +404,93 @@ func DoMigrations(c *cli.Context) error {
 		return nil
 	}
 
-	err = app.Migration.Run(driver, connection, env, table)
+	exec, err := newExecutor(c)
 	if err != nil {
-		fmt.Println(cRe.Sprint("Error:"), "unable to run migrations", err)
+		fmt.Println(cRe.Sprint("Error:"), "unable to connect to the target database", err)
 		return nil
 	}
-	fmt.Println(cGr.Sprint("Success:"), "migrations applied")
+	defer exec.Close()
+
+	status, err := app.Migration.Status(exec, env, table)
+	if errors.Is(err, migrate.ErrNoLog) {
+		fmt.Println(cCy.Sprint("Skipped:"), "no log, no migration has been run against the target database")
+		return nil
+	}
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get migration status", err)
+		return nil
+	}
+	sqlMig.MigrationStatusToTable(status)
+
+	drift := 0
+	for _, s := range status {
+		if s.Drift {
+			drift++
+		}
+	}
+	if drift > 0 {
+		fmt.Println(cRe.Sprint("Warning:"), drift, "migrations have drifted between the server and the target database")
+	}
+	return nil
+}
+
+
+// MigrationDrift compares the live schema of tables with the schema recorded after their latest applied migration, exiting non-zero on drift
+func MigrationDrift(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	env := c.String("env")
+
+	app, err := app.New(debug)
+	if err != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"unable to initialise client "+err.Error(), 2)
+	}
+
+	exec, err := newExecutor(c)
+	if err != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"unable to connect to the target database "+err.Error(), 2)
+	}
+	defer exec.Close()
+
+	tables := c.Args().Slice()
+	if len(tables) == 0 {
+		migTables, err := app.Migration.ListTables(env)
+		if err != nil {
+			return cli.Exit(cRe.Sprint("Error: ")+"unable to list migration tables "+err.Error(), 2)
+		}
+		for _, t := range migTables {
+			tables = append(tables, t.Table)
+		}
+	}
+
+	drifts, err := app.Migration.Drift(exec, env, tables)
+	if err != nil {
+		return cli.Exit(cRe.Sprint("Error: ")+"unable to check schema drift "+err.Error(), 2)
+	}
+
+	drifted := 0
+	for _, d := range drifts {
+		if !d.Recorded {
+			fmt.Println(cCy.Sprint("Skipped:"), d.Table, "has no schema recorded for migration", d.SQLMigrationID)
+			continue
+		}
+		if len(d.Changes) == 0 {
+			fmt.Println(cGr.Sprint("Success:"), d.Table, "matches migration", d.SQLMigrationID)
+			continue
+		}
+		drifted++
+		fmt.Println(cRe.Sprint("Drift:"), d.Table, "has changed since migration", d.SQLMigrationID)
+		for _, change := range d.Changes {
+			fmt.Println("  ", change)
+		}
+	}
+	if drifted > 0 {
+		return cli.Exit(fmt.Sprintf("%d tables have drifted from their recorded schema", drifted), 1)
+	}
 	return nil
 }
 
@@ -125,64 +543,100 @@ func MigrationSet(c *cli.Context) error {
 	if env == "" {
 		return fmt.Errorf("env is missing")
 	}
-	var selectedTable string
-	var tablesSelection []string
-
-	tables, err := app.Migration.ListTables(env)
+	selectedTable, err := selectTable(c, app, env, "Choose a migration to update")
 	if err != nil {
 		fmt.Println(cRe.Sprint("Error:"), "unable to set migration", err)
 		return nil
 	}
-	for _, t := range tables {
-		tablesSelection = append(tablesSelection, t.Table)
-	}
-	prompt := &survey.Select{
-		Message: "Choose a migration to update",
-		Options: tablesSelection,
+
+	if c.Bool("undo") {
+		err = app.Migration.Undo(env, selectedTable, c.String("reason"))
+		if err != nil {
+			fmt.Println(cRe.Sprint("Error:"), "unable to undo migration", err)
+			return nil
+		}
+		fmt.Println(cGr.Sprint("Success:"), "latest migration restored")
+		return nil
 	}
-	survey.AskOne(prompt, &selectedTable)
 
 	migrations, err := app.Migration.Get(env, selectedTable)
 	if err != nil {
 		fmt.Println(cRe.Sprint("Error:"), "unable to set migration", err)
 		return nil
 	}
-	var migrationIDs []string
-	var selectedMigration string
+	if migrations == nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to set migration - no migrations")
+		return nil
+	}
 
-	if migrations != nil {
-		if migrations.MigrationsUp != nil {
-			for _, m := range migrations.MigrationsUp {
-				fmt.Println("adding id", m.ID)
-				migrationIDs = append(migrationIDs, strconv.Itoa(m.ID))
-			}
+	selectedMigID := 0
+	switch c.String("to") {
+	case "":
+		selectedMig, err := selectMigration(c, migrations, "Choose a migration to set to")
+		if err != nil {
+			fmt.Println(cRe.Sprint("Error:"), "unable to set migration", err)
+			return nil
 		}
-		if migrations.MigrationsDown != nil {
-			for _, m := range migrations.MigrationsDown {
-				migrationIDs = append(migrationIDs, strconv.Itoa(m.ID))
-			}
+		selectedMigID = selectedMig.ID
+	case "latest":
+		all := append(append([]*sqlMig.SQLMigration{}, migrations.MigrationsUp...), migrations.MigrationsDown...)
+		if len(all) == 0 {
+			fmt.Println(cRe.Sprint("Error:"), "unable to set migration - no migrations")
+			return nil
 		}
-	} else {
-		fmt.Println(cRe.Sprint("Error:"), "unable to set migration - no migrations")
+		selectedMigID = all[len(all)-1].ID
+	case "previous":
+		if len(migrations.MigrationsUp) == 0 {
+			fmt.Println(cRe.Sprint("Error:"), "unable to set migration - already at base")
+			return nil
+		}
+		if len(migrations.MigrationsUp) > 1 {
+			selectedMigID = migrations.MigrationsUp[len(migrations.MigrationsUp)-2].ID
+		}
+	case "base":
+	default:
+		fmt.Println(cRe.Sprint("Error:"), "unable to set migration - --to must be latest, previous or base")
 		return nil
 	}
 
-	prompt = &survey.Select{
-		Message: "Choose a migration to set to",
-		Options: migrationIDs,
-	}
-	survey.AskOne(prompt, &selectedMigration)
-	selectedMigInt, err := strconv.Atoi(selectedMigration)
+	err = app.Migration.Set(env, selectedTable, selectedMigID, c.String("reason"))
 	if err != nil {
 		fmt.Println(cRe.Sprint("Error:"), "unable to set migration", err)
 		return nil
 	}
-	err = app.Migration.Set(env, selectedTable, selectedMigInt)
+	if selectedMigID == 0 {
+		fmt.Println(cGr.Sprint("Success:"), "migration set to base")
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "migration set to", selectedMigID)
+	return nil
+}
+
+// MigrationHistory lists the changes made to the latest migration of a table
+func MigrationHistory(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	table := c.Args().Get(0)
+	if table == "" {
+		return fmt.Errorf("table is missing")
+	}
+	env := c.String("env")
+
+	app, err := app.New(debug)
 	if err != nil {
-		fmt.Println(cRe.Sprint("Error:"), "unable to set migration", err)
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	hist, err := app.Migration.History(env, table)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get migration history", err)
 		return nil
 	}
-	fmt.Println(cRe.Sprint("Success"), "migration updated", err)
+	sqlMig.MigrationHistoryToTable(hist)
 	return nil
 }
 
@@ -203,65 +657,126 @@ func MigrationDelete(c *cli.Context) error {
 	if env == "" {
 		return fmt.Errorf("env is missing")
 	}
+	selectedTable, err := selectTable(c, app, env, "Choose a migration to delete")
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
+		return nil
+	}
+
+	migrations, err := app.Migration.Get(env, selectedTable)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
+		return nil
+	}
+	if migrations == nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration - no migrations")
+		return nil
+	}
+
+	selectedMig, err := selectMigration(c, migrations, "Choose a migration to delete")
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
+		return nil
+	}
+	err = app.Migration.Delete(env, selectedTable, selectedMig.ID)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "migration deleted", selectedMig.File)
+	return nil
+}
+
+// isInteractive reports whether the client is attached to a terminal and can prompt
+func isInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// selectTable returns the --table flag, prompting for a table when it is missing and a terminal is attached
+func selectTable(c *cli.Context, app *app.App, env string, message string) (string, error) {
+	if c.String("table") != "" {
+		return c.String("table"), nil
+	}
+	if !isInteractive() {
+		return "", fmt.Errorf("--table is required when not attached to a terminal")
+	}
+
 	var selectedTable string
 	var tablesSelection []string
 
 	tables, err := app.Migration.ListTables(env)
 	if err != nil {
-		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
-		return nil
+		return "", err
 	}
 	for _, t := range tables {
 		tablesSelection = append(tablesSelection, t.Table)
 	}
 	prompt := &survey.Select{
-		Message: "Choose a migration to delete",
+		Message: message,
 		Options: tablesSelection,
 	}
-	survey.AskOne(prompt, &selectedTable)
-
-	migrations, err := app.Migration.Get(env, selectedTable)
+	err = survey.AskOne(prompt, &selectedTable)
 	if err != nil {
-		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
-		return nil
+		return "", err
 	}
-	var migrationIDs []string
-	var selectedMigration string
+	return selectedTable, nil
+}
 
-	if migrations != nil {
-		if migrations.MigrationsUp != nil {
-			for _, m := range migrations.MigrationsUp {
-				fmt.Println("adding id", m.ID)
-				migrationIDs = append(migrationIDs, strconv.Itoa(m.ID))
+// selectMigration returns the migration picked by --id, --file or --order, prompting for one when none are set and a terminal is attached
+func selectMigration(c *cli.Context, migrations *sqlMig.SQLMigrationStrategy, message string) (*sqlMig.SQLMigration, error) {
+	all := append(append([]*sqlMig.SQLMigration{}, migrations.MigrationsUp...), migrations.MigrationsDown...)
+
+	switch {
+	case c.IsSet("id"):
+		for _, m := range all {
+			if m.ID == c.Int("id") {
+				return m, nil
 			}
 		}
-		if migrations.MigrationsDown != nil {
-			for _, m := range migrations.MigrationsDown {
-				migrationIDs = append(migrationIDs, strconv.Itoa(m.ID))
+		return nil, fmt.Errorf("no migration with id %d", c.Int("id"))
+	case c.IsSet("file"):
+		for _, m := range all {
+			if m.File == c.String("file") {
+				return m, nil
 			}
 		}
-	} else {
-		fmt.Println(cRe.Sprint("Error:"), "unable to set delete - no migrations")
-		return nil
+		return nil, fmt.Errorf("no migration with file %s", c.String("file"))
+	case c.IsSet("order"):
+		for _, m := range all {
+			if m.FileOrder == c.Int("order") {
+				return m, nil
+			}
+		}
+		return nil, fmt.Errorf("no migration with order %d", c.Int("order"))
+	}
+
+	if !isInteractive() {
+		return nil, fmt.Errorf("--id, --file or --order is required when not attached to a terminal")
 	}
 
-	prompt = &survey.Select{
-		Message: "Choose a migration to set to",
+	var migrationIDs []string
+	var selectedMigration string
+	for _, m := range all {
+		migrationIDs = append(migrationIDs, strconv.Itoa(m.ID))
+	}
+	prompt := &survey.Select{
+		Message: message,
 		Options: migrationIDs,
 	}
-	survey.AskOne(prompt, &selectedMigration)
-	selectedMigInt, err := strconv.Atoi(selectedMigration)
+	err := survey.AskOne(prompt, &selectedMigration)
 	if err != nil {
-		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
-		return nil
+		return nil, err
 	}
-	err = app.Migration.Delete(env, selectedTable, selectedMigInt)
+	selectedMigInt, err := strconv.Atoi(selectedMigration)
 	if err != nil {
-		fmt.Println(cRe.Sprint("Error:"), "unable to delete migration", err)
-		return nil
+		return nil, err
 	}
-	fmt.Println(cRe.Sprint("Success"), "migration deleted", err)
-	return nil
+	for _, m := range all {
+		if m.ID == selectedMigInt {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("no migration with id %d", selectedMigInt)
 }
 
 
@@ -290,4 +805,22 @@ func MigrationTableList(c *cli.Context) error {
 	sqlMig.MigrationTablesToTable(mig)
 	return nil
 
-}
\ No newline at end of file
+}
+
+// newExecutor connects to the target database with the driver, or pipes SQL to --exec-cmd when it is set
+func newExecutor(c *cli.Context) (migrate.Executor, error) {
+	driver := c.String("driver")
+	if cmd := c.String("exec-cmd"); cmd != "" {
+		exec, err := migrate.NewCommandExecutor(driver, cmd)
+		if err != nil {
+			return nil, err
+		}
+		exec.Header = c.Bool("exec-header")
+		return exec, nil
+	}
+	connection := c.String("connection")
+	if connection == "" {
+		return nil, fmt.Errorf("one of --connection or --exec-cmd is required")
+	}
+	return migrate.NewSQLExecutor(driver, connection)
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/c-jamie/sql-manager/clientlib/log"
+	"github.com/c-jamie/sql-manager/clientlib/migrate"
+	sqlMig "github.com/c-jamie/sql-manager/clientlib/migration"
+	"github.com/urfave/cli/v2"
+)
+
+func TestMigrationDrift(t *testing.T) {
+	log.InitLog("info")
+	db := filepath.Join(t.TempDir(), "test.db")
+	exec, err := migrate.NewSQLExecutor("sqlite", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Close()
+	migrator := migrate.NewWithExecutor(exec)
+	err = migrator.Execute("-- +migrate Up\ncreate table orders (id integer primary key);\n", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := migrator.Introspect("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var out interface{}
+		switch r.URL.Path {
+		case "/v1/migrations":
+			out = map[string]interface{}{"migrations": sqlMig.SQLMigrationStrategy{
+				Table:          "orders",
+				MigrationsDown: []*sqlMig.SQLMigration{{ID: 1, FileOrder: 1, SourceTable: "orders"}},
+			}}
+		case "/v1/migrations/schema":
+			out = map[string]interface{}{"schemas": []*sqlMig.SQLMigrationSchema{{SQLMigrationID: 1, Schema: *recorded}}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer server.Close()
+	t.Setenv("SQL_MNGR_SERVER", server.URL)
+	t.Setenv("SQL_MNGR_AUTH", server.URL)
+	t.Setenv("SQL_MNGR_HOME", t.TempDir())
+
+	run := func() error {
+		app := &cli.App{
+			Commands: []*cli.Command{{
+				Name: "drift",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "env"},
+					&cli.StringFlag{Name: "driver"},
+					&cli.StringFlag{Name: "connection"},
+					&cli.StringFlag{Name: "verbose"},
+				},
+				Action: MigrationDrift,
+			}},
+			ExitErrHandler: func(c *cli.Context, err error) {},
+		}
+		return app.Run([]string{"sqlm", "drift", "--env", "dev", "--driver", "sqlite", "--connection", db, "orders"})
+	}
+
+	testcases := []struct {
+		statement string
+		code      int
+	}{
+		{"", 0},
+		{"alter table orders add column name text", 1},
+	}
+	for _, tcase := range testcases {
+		if tcase.statement != "" {
+			err = exec.Exec(context.Background(), tcase.statement)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = run()
+		code := 0
+		if exit, ok := err.(cli.ExitCoder); ok {
+			code = exit.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if code != tcase.code {
+			t.Errorf(" error drift exit code %d %v", code, err)
+		}
+	}
+}
+
+func TestDoMigrationsExitCode(t *testing.T) {
+	log.InitLog("info")
+	testcases := []struct {
+		name   string
+		script string
+		all    bool
+		code   int
+	}{
+		{name: "applied", script: "-- +migrate Up\ncreate table orders (id integer primary key);\n", code: 0},
+		{name: "failed", script: "-- +migrate Up\ninsert into missing values (1);\n", code: 1},
+		{name: "failed all", script: "-- +migrate Up\ninsert into missing values (1);\n", all: true, code: 1},
+	}
+	for _, tcase := range testcases {
+		strategy := &sqlMig.SQLMigrationStrategy{
+			Table:        "orders",
+			Env:          "dev",
+			MigrationsUp: []*sqlMig.SQLMigration{{ID: 1, FileID: "orders-1", FileOrder: 1, SourceTable: "orders", Env: "dev", MigratedAtNull: true, Script: tcase.script}},
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var out interface{}
+			switch {
+			case r.URL.Path == "/v1/migrations" && r.Method == http.MethodGet:
+				out = map[string]interface{}{"migrations": strategy}
+			case r.URL.Path == "/v1/migrations":
+				out = map[string]interface{}{"migrations": nil}
+			case r.URL.Path == "/v1/migrations/all":
+				out = map[string]interface{}{"migrations": []*sqlMig.SQLMigrationStrategy{strategy}}
+			case r.URL.Path == "/v1/migrations/dag":
+				out = map[string]interface{}{"dag": sqlMig.SQLMigrationDAG{Env: "dev", Nodes: strategy.MigrationsUp, Order: []int{1}}}
+			default:
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(out)
+		}))
+		t.Setenv("SQL_MNGR_SERVER", server.URL)
+		t.Setenv("SQL_MNGR_AUTH", server.URL)
+		t.Setenv("SQL_MNGR_HOME", t.TempDir())
+
+		app := &cli.App{
+			Commands: []*cli.Command{{
+				Name: "run",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "env"},
+					&cli.StringFlag{Name: "driver"},
+					&cli.StringFlag{Name: "connection"},
+					&cli.StringFlag{Name: "verbose"},
+					&cli.BoolFlag{Name: "all"},
+				},
+				Action: DoMigrations,
+			}},
+			ExitErrHandler: func(c *cli.Context, err error) {},
+		}
+		args := []string{"sqlm", "run", "--env", "dev", "--driver", "sqlite", "--connection", filepath.Join(t.TempDir(), "test.db")}
+		if tcase.all {
+			args = append(args, "--all")
+		} else {
+			args = append(args, "orders")
+		}
+		err := app.Run(args)
+		server.Close()
+		code := 0
+		if exit, ok := err.(cli.ExitCoder); ok {
+			code = exit.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if code != tcase.code {
+			t.Errorf(" error %s exit code %d %v", tcase.name, code, err)
+		}
+	}
+}
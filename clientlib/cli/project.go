@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/c-jamie/sql-manager/clientlib/app"
+	"github.com/c-jamie/sql-manager/clientlib/project"
+	"github.com/urfave/cli/v2"
+)
+
+// ProjectCreate creates a new project
+func ProjectCreate(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("project name is missing")
+	}
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	proj, err := app.Project.Create(name, c.String("description"), c.String("git-repo"))
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to create project", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "created project", proj.Name)
+	return nil
+}
+
+// ProjectList lists every project
+func ProjectList(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	projects, err := app.Project.List()
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to list projects", err)
+		return nil
+	}
+	project.ProjectsToTable(projects)
+	return nil
+}
+
+// ProjectRename renames a project, and sets its description when --description is provided
+func ProjectRename(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().Get(0)
+	newName := c.Args().Get(1)
+	if name == "" || newName == "" {
+		return fmt.Errorf("project name and new name are required")
+	}
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	proj, err := app.Project.Rename(name, newName)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to rename project", err)
+		return nil
+	}
+	if c.IsSet("description") {
+		proj, err = app.Project.Describe(newName, c.String("description"))
+		if err != nil {
+			fmt.Println(cRe.Sprint("Error:"), "unable to set project description", err)
+			return nil
+		}
+	}
+	fmt.Println(cGr.Sprint("Success:"), "renamed project", name, "to", proj.Name)
+	return nil
+}
+
+// ProjectBind binds a project to a git repo, or to the server's default repo when no repo is given
+func ProjectBind(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().Get(0)
+	repo := c.Args().Get(1)
+	if name == "" {
+		return fmt.Errorf("project name is missing")
+	}
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	_, err = app.Project.Bind(name, repo)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to bind project", err)
+		return nil
+	}
+	if repo == "" {
+		repo = "the default repo"
+	}
+	fmt.Println(cGr.Sprint("Success:"), "bound project", name, "to", repo)
+	return nil
+}
+
+// ProjectDelete deletes a project, its name can then be reused
+func ProjectDelete(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("project name is missing")
+	}
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	err = app.Project.Delete(name)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to delete project", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "deleted project", name)
+	return nil
+}
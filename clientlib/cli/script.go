@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strings"
 	"github.com/c-jamie/sql-manager/clientlib/app"
 	sqlMig "github.com/c-jamie/sql-manager/clientlib/migration"
 	"github.com/c-jamie/sql-manager/clientlib/script"
@@ -29,6 +32,163 @@ func ScriptRegister(c *cli.Context) error {
 }
 
 
+// ScriptRemove deregisters a script from the platform
+func ScriptRemove(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("script name is missing")
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	err = app.Script.Remove(name)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to remove script", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "removed", name)
+	return nil
+}
+
+// ScriptMove points a script at its new file location in git, or moves it to another project
+func ScriptMove(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("script name is missing")
+	}
+	file := c.String("file")
+	project := c.String("project")
+	if file == "" && project == "" {
+		return fmt.Errorf("one of --file or --project is required")
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	err = app.Script.Move(name, file, project)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to move script", err)
+		return nil
+	}
+	fmt.Println(cGr.Sprint("Success:"), "moved", name)
+	return nil
+}
+
+// ScriptSync registers every script found in git with the platform
+func ScriptSync(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	sync, err := app.Script.Sync()
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to sync scripts", err)
+		return nil
+	}
+	for _, f := range sync.Added {
+		fmt.Println("added", f)
+	}
+	for _, f := range sync.Moved {
+		fmt.Println("moved", f)
+	}
+	for _, f := range sync.Removed {
+		fmt.Println(cRe.Sprint("removed"), f)
+	}
+	fmt.Println(cGr.Sprint("Success:"), fmt.Sprintf("%d added, %d moved, %d removed", len(sync.Added), len(sync.Moved), len(sync.Removed)))
+	return nil
+}
+
+// ScriptLog prints the git history of a script
+func ScriptLog(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("script name is missing")
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	commits, err := app.Script.History(name)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get the history of the script", err)
+		return nil
+	}
+	script.CommitsToTable(commits)
+	return nil
+}
+
+// ScriptDiff prints the changes made to a script between two git refs
+func ScriptDiff(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("script name is missing")
+	}
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	diff, err := app.Script.Diff(name, c.String("from"), c.String("to"))
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to diff the script", err)
+		return nil
+	}
+	if diff == "" {
+		fmt.Println(cGr.Sprint("Success:"), "no changes")
+		return nil
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Println(line)
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(cGr.Sprint(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(cRe.Sprint(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(cCy.Sprint(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
 // ScriptGet returns a script from the platform
 func ScriptGet(c *cli.Context) error {
 	fmt.Println("Grabbing file")
@@ -49,6 +209,41 @@ func ScriptGet(c *cli.Context) error {
 }
 
 
+// getAt loads a script at a git ref. Scripts it references in the same repo are loaded from the same commit, those
+// in another repo are loaded at the ref as it resolves in their own repo
+func getAt(scr script.Script, name string, ref string) (string, func(string) (string, error), error) {
+	if ref == "" {
+		sqlFile, err := scr.Get(name)
+		return sqlFile, scr.Get, err
+	}
+	root, err := scr.GetAt(name, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	fmt.Fprintln(os.Stderr, "using", name, "at commit", root.Commit)
+	get := func(name string) (string, error) {
+		// the repo of a script is only known once it is fetched, the ref is resolved first to find it
+		at, err := scr.GetAt(name, ref)
+		if err != nil {
+			return "", fmt.Errorf("unable to load %s at %s, it may be in another git repo than the script being run: %w", name, ref, err)
+		}
+		if at.GitRepoID != root.GitRepoID {
+			fmt.Fprintln(os.Stderr, "using", name, "from another git repo at commit", at.Commit)
+			return at.Script, nil
+		}
+		if at.Commit == root.Commit {
+			return at.Script, nil
+		}
+		// the ref moved since the script being run was loaded, its commit is used
+		at, err = scr.GetAt(name, root.Commit)
+		if err != nil {
+			return "", err
+		}
+		return at.Script, nil
+	}
+	return root.Script, get, nil
+}
+
 // ScriptGetCompile returns a script from the platform and compiles it
 func ScriptGetCompile(c *cli.Context) error {
 	debug := ""
@@ -65,7 +260,7 @@ func ScriptGetCompile(c *cli.Context) error {
 		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
 		return nil
 	}
-	sqlFile, err := app.Script.Get(file)
+	sqlFile, getScript, err := getAt(app.Script, file, c.String("ref"))
 	if err != nil {
 		fmt.Println(cRe.Sprint("Error:"), "unable to load file", err)
 		return nil
@@ -78,12 +273,68 @@ func ScriptGetCompile(c *cli.Context) error {
 	}
 	migEnv := make(map[string][]*sqlMig.SQLMigrationStrategy)
 	migEnv[env] = mig
-	sql := sql.New(sqlFile, env, migEnv, app.Script.Get)
+	sql := sql.New(sqlFile, env, migEnv, getScript)
 	sql.Compile()
+	if sql.Err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to compile the script", sql.Err)
+		return nil
+	}
 	fmt.Println(sql.Parsed)
 	return nil
 }
 
+// ScriptRun compiles a script and runs it against the target database
+func ScriptRun(c *cli.Context) error {
+	debug := ""
+	if c.String("verbose") == "0" {
+		debug = "info"
+	} else if c.String("verbose") == "1" {
+		debug = "debug"
+	}
+	file := c.Args().First()
+	env := c.String("env")
+
+	app, err := app.New(debug)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to initialise client", err)
+		return nil
+	}
+	sqlFile, getScript, err := getAt(app.Script, file, c.String("ref"))
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to load file", err)
+		return nil
+	}
+
+	mig, err := app.Migration.GetAll(env)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to get migrations for env", err)
+		return nil
+	}
+	migEnv := make(map[string][]*sqlMig.SQLMigrationStrategy)
+	migEnv[env] = mig
+	sql := sql.New(sqlFile, env, migEnv, getScript)
+	sql.Compile()
+	if sql.Err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to compile the script", sql.Err)
+		return nil
+	}
+
+	exec, err := newExecutor(c)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to connect to the target database", err)
+		return nil
+	}
+	defer exec.Close()
+
+	rows, err := exec.Query(context.Background(), sql.Parsed)
+	if err != nil {
+		fmt.Println(cRe.Sprint("Error:"), "unable to run script", err)
+		return nil
+	}
+	script.RowsToTable(rows)
+	return nil
+}
+
 // ScriptList lists all the available scripts
 func ScriptList(c *cli.Context) error {
 	debug := ""
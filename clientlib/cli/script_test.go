@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/c-jamie/sql-manager/clientlib/script"
+)
+
+// refScript serves scripts from two repos, commits maps a repo and ref to the commit it resolves to
+type refScript struct {
+	script.Script
+	repos   map[string]int64
+	commits map[string]string
+	calls   []string
+}
+
+func (s *refScript) GetAt(name string, ref string) (*script.FileAt, error) {
+	s.calls = append(s.calls, name+"@"+ref)
+	repo := s.repos[name]
+	commit, ok := s.commits[fmt.Sprintf("%d:%s", repo, ref)]
+	if !ok {
+		return nil, fmt.Errorf("git ref not found: %s", ref)
+	}
+	return &script.FileAt{Script: name + " at " + commit, Commit: commit, GitRepoID: repo}, nil
+}
+
+func TestGetAtRepos(t *testing.T) {
+	scr := &refScript{
+		repos: map[string]int64{"root": 0, "same": 0, "other": 2, "missing": 3},
+		commits: map[string]string{
+			"0:v1":      "aaaaaaa",
+			"0:aaaaaaa": "aaaaaaa",
+			"2:v1":      "bbbbbbb",
+		},
+	}
+	sqlFile, get, err := getAt(scr, "root", "v1")
+	if err != nil || sqlFile != "root at aaaaaaa" {
+		t.Fatalf(" error root %q %v", sqlFile, err)
+	}
+
+	// the ref moves on in the root repo, a reference in the same repo stays on the commit of the root script
+	scr.commits["0:v1"] = "ccccccc"
+	testcases := []struct {
+		name   string
+		expect string
+		err    string
+	}{
+		{name: "same", expect: "same at aaaaaaa"},
+		{name: "other", expect: "other at bbbbbbb"},
+		{name: "missing", err: "another git repo"},
+	}
+	for _, tcase := range testcases {
+		out, err := get(tcase.name)
+		if tcase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tcase.err) {
+				t.Errorf(" error get %s expected %q got %v", tcase.name, tcase.err, err)
+			}
+			continue
+		}
+		if err != nil || out != tcase.expect {
+			t.Errorf(" error get %s %q %v", tcase.name, out, err)
+		}
+	}
+	// the foreign repo is never asked for a commit of the root repo
+	for _, call := range scr.calls {
+		if strings.HasPrefix(call, "other@") && call != "other@v1" {
+			t.Errorf(" error other repo asked for %s", call)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package gitrepo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/c-jamie/sql-manager/clientlib/request"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/tidwall/gjson"
+)
+
+// RepoInfo represents a git repo which projects can be bound to
+type RepoInfo struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	URL            string     `json:"url"`
+	Branch         string     `json:"branch"`
+	CredentialsRef string     `json:"credentials_ref"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
+
+// GitRepo represents the interface for managing the git repos known to the server
+type GitRepo interface {
+	// Add registers a git repo, credentialsRef names the environment variables on the server holding its credentials
+	Add(name string, url string, branch string, credentialsRef string) (*RepoInfo, error)
+	// List returns every git repo
+	List() ([]*RepoInfo, error)
+	// Delete removes a git repo which no project is bound to
+	Delete(name string) error
+}
+
+type gitRepo struct {
+	BaseURL string
+}
+
+const (
+	Repos = "git/repos"
+)
+
+// New creates a new git repo object
+func New(url string) GitRepo {
+	return &gitRepo{BaseURL: url}
+}
+
+func (app *gitRepo) makeRequest(url string, payload []byte, how string) ([]byte, error) {
+	client := request.Client{BaseURL: app.BaseURL}
+	var body []byte
+	var resp *http.Response
+	var err error
+	if how == http.MethodGet {
+		body, resp, err = client.GetReq(url, payload, true)
+	} else {
+		body, resp, err = client.PostReq(url, payload, true, how)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to make request %s", string(body))
+	}
+	return body, nil
+}
+
+func (app *gitRepo) Add(name string, url string, branch string, credentialsRef string) (*RepoInfo, error) {
+	payload, err := json.Marshal(struct {
+		Name           string `json:"name"`
+		URL            string `json:"url"`
+		Branch         string `json:"branch"`
+		CredentialsRef string `json:"credentials_ref"`
+	}{name, url, branch, credentialsRef})
+	if err != nil {
+		return nil, err
+	}
+	body, err := app.makeRequest("/"+Repos, payload, http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+	var repo RepoInfo
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "repo").String()), &repo)
+	if err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+func (app *gitRepo) List() ([]*RepoInfo, error) {
+	body, err := app.makeRequest("/"+Repos, nil, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	var repos []*RepoInfo
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "repos").String()), &repos)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list git repos %w", err)
+	}
+	return repos, nil
+}
+
+func (app *gitRepo) Delete(name string) error {
+	payload, err := json.Marshal(struct {
+		Name string `json:"name"`
+	}{name})
+	if err != nil {
+		return err
+	}
+	_, err = app.makeRequest("/"+Repos, payload, http.MethodDelete)
+	return err
+}
+
+// ReposToTable prints a text table of git repos
+func ReposToTable(repos []*RepoInfo) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "Name", "URL", "Branch", "Credentials"})
+	for i, r := range repos {
+		t.AppendRow(table.Row{i, r.Name, r.URL, r.Branch, r.CredentialsRef})
+	}
+	t.Render()
+}
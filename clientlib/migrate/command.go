@@ -0,0 +1,253 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommandExecutor runs SQL by piping it to a command line client such as psql, sqlcmd or bq query,
+// so databases without a database/sql driver can still be migrated
+type CommandExecutor struct {
+	// Command is run with sh -c and receives the SQL on its stdin
+	Command string
+	// Header is set when the client prints a header row before the rows of a query
+	Header  bool
+	dialect string
+}
+
+// NewCommandExecutor creates an executor which pipes SQL to a command, queries are expected to print csv
+func NewCommandExecutor(driver string, command string) (*CommandExecutor, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("no command provided")
+	}
+	// drivers without a database/sql counterpart, such as bigquery, use the default dialect
+	dialect, err := DialectOf(driver)
+	if err != nil {
+		dialect = driver
+	}
+	return &CommandExecutor{Command: command, dialect: dialect}, nil
+}
+
+// run pipes sql to the command and returns its stdout
+func (ex *CommandExecutor) run(ctx context.Context, sql string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", ex.Command)
+	cmd.Stdin = strings.NewReader(sql)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return nil, fmt.Errorf("unable to run command: %w: %s", err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (ex *CommandExecutor) Exec(ctx context.Context, query string, args ...interface{}) error {
+	sql, err := ex.inline(query, args)
+	if err != nil {
+		return err
+	}
+	_, err = ex.run(ctx, terminate(sql))
+	return err
+}
+
+func (ex *CommandExecutor) Query(ctx context.Context, query string, args ...interface{}) ([][]string, error) {
+	sql, err := ex.inline(query, args)
+	if err != nil {
+		return nil, err
+	}
+	out, err := ex.run(ctx, terminate(sql))
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(out))
+	r.FieldsPerRecord = -1
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read command output: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	if ex.Header && len(rows) > 0 {
+		rows = rows[1:]
+	}
+	return rows, nil
+}
+
+// Begin starts a transaction which is sent to the command as a single script on commit
+func (ex *CommandExecutor) Begin(ctx context.Context) (Tx, error) {
+	return &commandTx{ex: ex, ctx: ctx}, nil
+}
+
+func (ex *CommandExecutor) Close() error {
+	return nil
+}
+
+func (ex *CommandExecutor) Dialect() string {
+	return ex.dialect
+}
+
+// commandTx buffers statements, which run under the context of Begin when they are committed,
+// cut short by the earliest deadline any statement was buffered with
+type commandTx struct {
+	ex         *CommandExecutor
+	ctx        context.Context
+	statements []string
+	deadline   time.Time
+	done       bool
+}
+
+func (tx *commandTx) Exec(ctx context.Context, query string, args ...interface{}) error {
+	if tx.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+	sql, err := tx.ex.inline(query, args)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && (tx.deadline.IsZero() || deadline.Before(tx.deadline)) {
+		tx.deadline = deadline
+	}
+	tx.statements = append(tx.statements, terminate(sql))
+	return nil
+}
+
+func (tx *commandTx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+	tx.done = true
+	if len(tx.statements) == 0 {
+		return nil
+	}
+	begin, commit := "begin;\n", "commit;\n"
+	if tx.ex.dialect == SQLServer {
+		begin, commit = "begin transaction;\n", "commit transaction;\n"
+	}
+	ctx := tx.ctx
+	if !tx.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, tx.deadline)
+		defer cancel()
+	}
+	_, err := tx.ex.run(ctx, begin+strings.Join(tx.statements, "")+commit)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && tx.ctx.Err() == nil {
+		return fmt.Errorf("statement timed out: %w", err)
+	}
+	return err
+}
+
+// Rollback discards the buffered statements, nothing has been sent to the command yet
+func (tx *commandTx) Rollback() error {
+	tx.done = true
+	tx.statements = nil
+	return nil
+}
+
+// terminate ends a statement with a semicolon so statements can be concatenated into a script
+func terminate(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if !strings.HasSuffix(sql, ";") {
+		sql += ";"
+	}
+	return sql + "\n"
+}
+
+// inline replaces the $N, @pN and ? placeholders of a query with literals, as a command line client takes no bind parameters
+func (ex *CommandExecutor) inline(query string, args []interface{}) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// copy quoted strings untouched, '' is an escaped quote
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+			b.WriteString(query[i : j+1])
+			i = j
+			continue
+		case c == '?':
+			if next >= len(args) {
+				return "", fmt.Errorf("query has more placeholders than arguments")
+			}
+			b.WriteString(ex.literal(args[next]))
+			next++
+			continue
+		case c == '$' || (c == '@' && i+1 < len(query) && query[i+1] == 'p'):
+			start := i + 1
+			if c == '@' {
+				start++
+			}
+			end := start
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			if end > start {
+				n, _ := strconv.Atoi(query[start:end])
+				if n < 1 || n > len(args) {
+					return "", fmt.Errorf("query references argument %d of %d", n, len(args))
+				}
+				b.WriteString(ex.literal(args[n-1]))
+				i = end - 1
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+// literal returns a value as a SQL literal
+func (ex *CommandExecutor) literal(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + strings.ReplaceAll(t, "'", "''") + "'"
+	case []byte:
+		return "'" + strings.ReplaceAll(string(t), "'", "''") + "'"
+	case time.Time:
+		return "'" + t.Format("2006-01-02 15:04:05.999999") + "'"
+	case bool:
+		if ex.dialect == SQLServer {
+			if t {
+				return "1"
+			}
+			return "0"
+		}
+		return strconv.FormatBool(t)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-jamie/sql-manager/clientlib/log"
+)
+
+func TestInline(t *testing.T) {
+	at := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	testcases := []struct {
+		dialect string
+		in      string
+		args    []interface{}
+		out     string
+	}{
+		{Postgres, "select $1, $2, '$1'", []interface{}{"it's", 2}, "select 'it''s', 2, '$1'"},
+		{SQLServer, "select @p2, @p1", []interface{}{true, nil}, "select null, 1"},
+		{SQLite, "insert into t values (?, ?, '?')", []interface{}{at, false}, "insert into t values ('2021-03-04 05:06:07', false, '?')"},
+		{Postgres, "select 1", nil, "select 1"},
+	}
+	for _, tcase := range testcases {
+		ex := CommandExecutor{dialect: tcase.dialect}
+		out, err := ex.inline(tcase.in, tcase.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tcase.out {
+			t.Errorf(" error inline %s %q", tcase.dialect, out)
+		}
+	}
+
+	ex := CommandExecutor{dialect: Postgres}
+	_, err := ex.inline("select $3", []interface{}{1})
+	if err == nil {
+		t.Errorf(" error inline expected missing argument error")
+	}
+}
+
+func TestCommandExecutorQuery(t *testing.T) {
+	ex, err := NewCommandExecutor("bigquery", `cat > /dev/null; printf 'name,total\na,1\n"b,c",2\n'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.Header = true
+	if ex.Dialect() != "bigquery" {
+		t.Errorf(" error dialect %s", ex.Dialect())
+	}
+	rows, err := ex.Query(context.Background(), "select name, total from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][0] != "b,c" || rows[1][1] != "2" {
+		t.Errorf(" error query rows %q", rows)
+	}
+
+	ex, err = NewCommandExecutor("postgres", "echo failed >&2; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ex.Exec(context.Background(), "select 1")
+	if err == nil {
+		t.Errorf(" error exec expected command failure")
+	}
+}
+
+func TestCommandExecutorSQLite(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	log.InitLog("info")
+	ex, err := NewCommandExecutor("sqlite", "sqlite3 -bail -csv "+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mig := NewWithExecutor(ex)
+	defer mig.CloseDB()
+
+	sql := `
+-- +migrate Up
+create table orders (id integer primary key, name text not null);
+create index ix_orders_name on orders (name);
+
+-- +migrate Down
+drop table orders;
+`
+	err = mig.Execute(sql, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := mig.Introspect("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 2 || schema.Columns[1].Nullable || len(schema.Indexes) != 1 {
+		t.Errorf(" error introspect %+v", schema)
+	}
+
+	err = mig.InitLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mig.Log(&LogEntry{FileID: "dir1-1-init-sql", Checksum: "abc", Direction: "up", AppliedAt: time.Now().UTC(), AppliedBy: "o'brien"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := mig.LatestLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := entries["dir1-1-init-sql"]
+	if !ok || entry.AppliedBy != "o'brien" || entry.AppliedAt.IsZero() {
+		t.Errorf(" error log %+v", entries)
+	}
+
+	// a failing statement rolls back the whole file as it is sent in one transaction
+	err = mig.Execute("-- +migrate Up\ncreate table items (id int);\ninsert into missing values (1);\n", "up")
+	if err == nil {
+		t.Fatal(" error execute expected failure")
+	}
+	rows, err := ex.Query(context.Background(), "select count(*) from sqlite_master where name = 'items'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0][0] != "0" {
+		t.Errorf(" error rollback %q", rows)
+	}
+}
+
+func TestCommandExecutorTimeout(t *testing.T) {
+	log.InitLog("info")
+	ex, err := NewCommandExecutor("postgres", "cat > /dev/null; exec sleep 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mig := NewWithExecutor(ex)
+	mig.StatementTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = mig.Execute("-- +migrate Up\ncreate table orders (id int);\n", "up")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf(" error execute expected timeout %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf(" error the statement timeout was not applied on commit, took %s", time.Since(start))
+	}
+}
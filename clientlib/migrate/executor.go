@@ -0,0 +1,201 @@
+package migrate
+
+import (
+	"context"
+	db "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Executor runs SQL against a target database
+type Executor interface {
+	// Exec runs a statement which returns no rows
+	Exec(ctx context.Context, query string, args ...interface{}) error
+	// Query runs a statement and returns its rows, with every value as text
+	Query(ctx context.Context, query string, args ...interface{}) ([][]string, error)
+	// Begin starts a transaction
+	Begin(ctx context.Context) (Tx, error)
+	// Close releases the connection to the target database
+	Close() error
+	// Dialect returns the SQL dialect of the target database
+	Dialect() string
+}
+
+// Tx is a transaction started by an Executor
+type Tx interface {
+	// Exec runs a statement inside the transaction
+	Exec(ctx context.Context, query string, args ...interface{}) error
+	// Commit commits the transaction
+	Commit() error
+	// Rollback aborts the transaction
+	Rollback() error
+}
+
+// DialectOf returns the SQL dialect of a driver
+func DialectOf(driver string) (string, error) {
+	switch driver {
+	case "postgres":
+		return Postgres, nil
+	case "mssql", "sqlserver":
+		return SQLServer, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	case "mysql":
+		return MySQL, nil
+	}
+	return "", fmt.Errorf("unsupported driver %s", driver)
+}
+
+// SQLExecutor runs SQL through a database/sql driver
+type SQLExecutor struct {
+	DB      *db.DB
+	dialect string
+}
+
+// NewSQLExecutor opens a connection to the target database with a database/sql driver
+func NewSQLExecutor(driver string, connection string) (*SQLExecutor, error) {
+	dialect, err := DialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
+	switch dialect {
+	case SQLite:
+		driver = "sqlite3"
+	case MySQL:
+		// the migration log scans timestamps into time.Time
+		cfg, err := mysql.ParseDSN(connection)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ParseTime = true
+		connection = cfg.FormatDSN()
+	}
+	db, err := db.Open(driver, connection)
+	if err != nil {
+		return nil, err
+	}
+	db.Ping()
+	return &SQLExecutor{DB: db, dialect: dialect}, nil
+}
+
+func (ex *SQLExecutor) Exec(ctx context.Context, query string, args ...interface{}) error {
+	return execContext(ctx, ex.DB, query, args...)
+}
+
+func (ex *SQLExecutor) Query(ctx context.Context, query string, args ...interface{}) ([][]string, error) {
+	rows, err := ex.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var out [][]string
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		err := rows.Scan(ptrs...)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, len(cols))
+		for i, v := range values {
+			row[i] = text(v)
+		}
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (ex *SQLExecutor) Begin(ctx context.Context) (Tx, error) {
+	tx, err := ex.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx}, nil
+}
+
+func (ex *SQLExecutor) Close() error {
+	return ex.DB.Close()
+}
+
+func (ex *SQLExecutor) Dialect() string {
+	return ex.dialect
+}
+
+type sqlTx struct {
+	tx *db.Tx
+}
+
+func (tx *sqlTx) Exec(ctx context.Context, query string, args ...interface{}) error {
+	return execContext(ctx, tx.tx, query, args...)
+}
+
+func (tx *sqlTx) Commit() error {
+	return tx.tx.Commit()
+}
+
+func (tx *sqlTx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+// execer is satisfied by both a DB and a Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (db.Result, error)
+}
+
+func execContext(ctx context.Context, ex execer, query string, args ...interface{}) error {
+	_, err := ex.ExecContext(ctx, query, args...)
+	return err
+}
+
+// text returns a value scanned from a database as text
+func text(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case bool:
+		if t {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprint(v)
+}
+
+// parseTime reads a timestamp returned as text by an Executor
+func parseTime(value string) (time.Time, error) {
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999-07",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+	}
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse time %s", value)
+}
@@ -2,38 +2,64 @@ package migrate
 
 import (
 	"context"
-	db "database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/c-jamie/sql-manager/clientlib/log"
 	"github.com/rubenv/sql-migrate/sqlparse"
-	
-	_ "github.com/denisenkom/go-mssqldb"
-	_ "github.com/lib/pq"
+)
+
+// LogTable is the table used to record migration runs in the target database
+const LogTable = "sqlm_migration_log"
+
+// ErrNoLog is returned when the target database has no migration log, as no migration has been run against it
+var ErrNoLog = errors.New("the target database has no migration log")
+
+// The SQL dialects a migration can be executed against
+const (
+	Postgres  = "postgres"
+	SQLServer = "sqlserver"
+	SQLite    = "sqlite"
+	MySQL     = "mysql"
 )
 
 // Migration executes a migration 
 type Migration struct {
-	CTX context.Context
-	DB  *db.DB
+	CTX      context.Context
+	Executor Executor
+	Dialect  string
+	// StatementTimeout cancels a single statement which runs for longer, zero means no timeout
+	StatementTimeout time.Duration
 }
 
-// New creates a new Migration struct
+// LogEntry represents a single migration run recorded in the target database
+type LogEntry struct {
+	FileID    string
+	Checksum  string
+	Direction string
+	AppliedAt time.Time
+	AppliedBy string
+}
+
+// New creates a new Migration struct which connects with a database/sql driver
 func New(driver string, connection string) (*Migration, error) {
-	var mig Migration
-	db, err := db.Open(driver, connection)
+	exec, err := NewSQLExecutor(driver, connection)
 	if err != nil {
 		return nil, err
 	}
-	mig.DB = db
-	mig.DB.Ping()
-	return &mig, nil
+	return NewWithExecutor(exec), nil
+}
+
+// NewWithExecutor creates a new Migration struct which runs its SQL through an Executor
+func NewWithExecutor(exec Executor) *Migration {
+	return &Migration{CTX: context.Background(), Executor: exec, Dialect: exec.Dialect()}
 }
 
 func (mig *Migration) parse(sql string) (*sqlparse.ParsedMigration, error) {
 
-	migration, err := sqlparse.ParseMigration(strings.NewReader(sql))
+	migration, err := sqlparse.ParseMigration(strings.NewReader(Split(mig.Dialect, sql)))
 	if err != nil {
 		return nil, fmt.Errorf("migrate unable to build migration: %w", err)
 	}
@@ -42,51 +68,229 @@ func (mig *Migration) parse(sql string) (*sqlparse.ParsedMigration, error) {
 
 // Execute runs migrations in a provided direction
 func (mig *Migration) Execute(sql string, dir string) error {
+	return mig.Apply(sql, dir, nil)
+}
 
-	if dir == "up" {
-		migrations, err := mig.parse(sql)
-		if err != nil {
-			return err
-		}
-		for _, m := range migrations.UpStatements {
-			log.Debug("executing up statement")
-			err = mig.execute(m)
+// Apply runs migrations in a provided direction and records the run in the migration log,
+// the log row is written in the same transaction so a failed migration is never logged
+func (mig *Migration) Apply(sql string, dir string, entry *LogEntry) error {
+	migrations, err := mig.parse(sql)
+	if err != nil {
+		return err
+	}
+
+	statements := migrations.UpStatements
+	noTransaction := migrations.DisableTransactionUp
+	if dir == "down" {
+		statements = migrations.DownStatements
+		noTransaction = migrations.DisableTransactionDown
+	} else if dir != "up" {
+		return nil
+	}
+
+	// mysql commits implicitly after ddl so a transaction would not roll it back
+	if noTransaction || mig.Dialect == MySQL {
+		for _, m := range statements {
+			if err := mig.CTX.Err(); err != nil {
+				return fmt.Errorf("migration cancelled: %w", err)
+			}
+			log.Debug("executing ", dir, " statement")
+			err = mig.exec(mig.Executor, m)
 			if err != nil {
 				return err
 			}
 		}
+		if entry != nil {
+			return mig.Log(entry)
+		}
+		return nil
 	}
-	if dir == "down" {
-		migrations, err := mig.parse(sql)
+
+	if err := mig.CTX.Err(); err != nil {
+		return fmt.Errorf("migration cancelled: %w", err)
+	}
+	tx, err := mig.Executor.Begin(mig.CTX)
+	if err != nil {
+		return err
+	}
+	for _, m := range statements {
+		log.Debug("executing ", dir, " statement")
+		err = mig.exec(tx, m)
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
-		for _, m := range migrations.DownStatements {
-			log.Debug("executing down statement")
-			err = mig.execute(m)
-			if err != nil {
-				return err
-			}
+	}
+	if entry != nil {
+		query, args := mig.logQuery(entry)
+		err = tx.Exec(mig.CTX, query, args...)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to write migration log: %w", err)
 		}
 	}
-	return nil
+	return tx.Commit()
 }
 
 // CloseDB shuts the DB connection
 func (mig *Migration) CloseDB() error {
-	err := mig.DB.Close()
+	err := mig.Executor.Close()
 	return err
 }
 
-func (mig *Migration) execute(sql string) error {
-	result, err := mig.DB.Exec(sql)
+// InitLog creates the migration log table in the target database if it does not exist
+func (mig *Migration) InitLog() error {
+	var query string
+	switch mig.Dialect {
+	case SQLServer:
+		query = fmt.Sprintf(`
+			if object_id('%[1]s', 'U') is null
+			create table %[1]s (
+				id 				int identity(1,1) primary key
+				, file_id 		nvarchar(450) not null
+				, checksum 		varchar(64) null
+				, direction 	varchar(4) not null
+				, applied_at 	datetime2 not null
+				, applied_by 	nvarchar(255) null
+			)
+		`, LogTable)
+	case SQLite:
+		query = fmt.Sprintf(`
+			create table if not exists %s (
+				id 				integer primary key autoincrement
+				, file_id 		text not null
+				, checksum 		varchar(64) null
+				, direction 	varchar(4) not null
+				, applied_at 	timestamp not null
+				, applied_by 	text null
+			)
+		`, LogTable)
+	case MySQL:
+		query = fmt.Sprintf(`
+			create table if not exists %s (
+				id 				int auto_increment primary key
+				, file_id 		varchar(450) not null
+				, checksum 		varchar(64) null
+				, direction 	varchar(4) not null
+				, applied_at 	datetime(6) not null
+				, applied_by 	varchar(255) null
+			)
+		`, LogTable)
+	default:
+		query = fmt.Sprintf(`
+			create table if not exists %s (
+				id 				serial primary key
+				, file_id 		text not null
+				, checksum 		varchar(64) null
+				, direction 	varchar(4) not null
+				, applied_at 	timestamp not null
+				, applied_by 	text null
+			)
+		`, LogTable)
+	}
+	err := mig.Executor.Exec(mig.CTX, query)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to create migration log: %w", err)
 	}
-	rows, err := result.RowsAffected()
+	return nil
+}
+
+// HasLog reports whether the migration log table exists in the target database, without creating it
+func (mig *Migration) HasLog() (bool, error) {
+	schema, err := mig.Introspect(LogTable)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("unable to check migration log: %w", err)
+	}
+	return len(schema.Columns) > 0, nil
+}
+
+// Log records a migration run in the target database
+func (mig *Migration) Log(entry *LogEntry) error {
+	query, args := mig.logQuery(entry)
+	// a migration which has been committed is always logged, even when the run has been cancelled since
+	err := mig.Executor.Exec(context.Background(), query, args...)
+	if err != nil {
+		return fmt.Errorf("unable to write migration log: %w", err)
 	}
-	log.Debug(rows, " rows affected")
 	return nil
 }
+
+// logQuery returns the insert of a log entry
+func (mig *Migration) logQuery(entry *LogEntry) (string, []interface{}) {
+	query := fmt.Sprintf(`
+		insert into %s(file_id, checksum, direction, applied_at, applied_by)
+		values 		(%s, %s, %s, %s, %s)
+	`, LogTable, mig.placeholder(1), mig.placeholder(2), mig.placeholder(3), mig.placeholder(4), mig.placeholder(5))
+	return query, []interface{}{entry.FileID, entry.Checksum, entry.Direction, entry.AppliedAt, entry.AppliedBy}
+}
+
+// LatestLog returns the most recent log entry for every file recorded in the target database
+func (mig *Migration) LatestLog() (map[string]*LogEntry, error) {
+	query := fmt.Sprintf(`
+		select 		l.file_id
+					, coalesce(l.checksum, '')
+					, l.direction
+					, l.applied_at
+					, coalesce(l.applied_by, '')
+		from 		%s as l
+		order by 	l.id asc
+	`, LogTable)
+
+	rows, err := mig.Executor.Query(mig.CTX, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migration log: %w", err)
+	}
+
+	entries := make(map[string]*LogEntry)
+	for _, row := range rows {
+		if len(row) != 5 {
+			return nil, fmt.Errorf("unable to read migration log: expected 5 columns, got %d", len(row))
+		}
+		appliedAt, err := parseTime(row[3])
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration log: %w", err)
+		}
+		entries[row[0]] = &LogEntry{
+			FileID:    row[0],
+			Checksum:  row[1],
+			Direction: row[2],
+			AppliedAt: appliedAt,
+			AppliedBy: row[4],
+		}
+	}
+	return entries, nil
+}
+
+// statementExecer is satisfied by both an Executor and a Tx
+type statementExecer interface {
+	Exec(ctx context.Context, query string, args ...interface{}) error
+}
+
+// exec runs a single statement of a migration, cancelling it after the statement timeout
+func (mig *Migration) exec(ex statementExecer, statement string) error {
+	ctx := mig.CTX
+	if mig.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mig.StatementTimeout)
+		defer cancel()
+	}
+	err := ex.Exec(ctx, statement)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && mig.CTX.Err() == nil {
+		return fmt.Errorf("statement timed out after %s: %w", mig.StatementTimeout, err)
+	}
+	if err != nil && mig.CTX.Err() != nil {
+		return fmt.Errorf("migration cancelled: %w", err)
+	}
+	return err
+}
+
+// placeholder returns the bind parameter for the i-th argument of a query
+func (mig *Migration) placeholder(i int) string {
+	switch mig.Dialect {
+	case SQLServer:
+		return fmt.Sprintf("@p%d", i)
+	case SQLite, MySQL:
+		return "?"
+	}
+	return fmt.Sprintf("$%d", i)
+}
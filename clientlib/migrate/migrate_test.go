@@ -0,0 +1,239 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-jamie/sql-manager/clientlib/log"
+)
+
+func setupSQLite(t *testing.T) *Migration {
+	log.InitLog("info")
+	mig, err := New("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mig
+}
+
+func TestExecuteSQLite(t *testing.T) {
+	mig := setupSQLite(t)
+	defer mig.CloseDB()
+
+	sql := `
+-- +migrate Up
+create table orders (id integer primary key, name text, updated_at timestamp);
+create index ix_orders_name on orders (name);
+create trigger tr_orders after update on orders
+begin
+	update orders set updated_at = current_timestamp where id = new.id;
+end;
+
+-- +migrate Down
+drop trigger tr_orders;
+drop table orders;
+`
+	err := mig.Execute(sql, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := mig.Introspect("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 3 || schema.Columns[1].Name != "name" || !schema.Columns[1].Nullable || schema.Columns[0].Nullable {
+		t.Errorf(" error columns %v", schema.Columns)
+	}
+	if len(schema.Indexes) != 1 || schema.Indexes[0].Name != "ix_orders_name" {
+		t.Errorf(" error indexes %v", schema.Indexes)
+	}
+
+	err = mig.Execute(sql, "down")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err = mig.Introspect("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 0 {
+		t.Errorf(" error columns after down %v", schema.Columns)
+	}
+}
+
+func TestExecuteSQLiteRollback(t *testing.T) {
+	mig := setupSQLite(t)
+	defer mig.CloseDB()
+
+	sql := `
+-- +migrate Up
+create table orders (id integer primary key);
+insert into missing values (1);
+
+-- +migrate Down
+drop table orders;
+`
+	err := mig.Execute(sql, "up")
+	if err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	schema, err := mig.Introspect("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 0 {
+		t.Errorf(" error the failed migration was not rolled back %v", schema.Columns)
+	}
+}
+
+func TestLogSQLite(t *testing.T) {
+	mig := setupSQLite(t)
+	defer mig.CloseDB()
+
+	hasLog, err := mig.HasLog()
+	if err != nil || hasLog {
+		t.Fatalf(" error has log before init %t %v", hasLog, err)
+	}
+	err = mig.InitLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasLog, err = mig.HasLog()
+	if err != nil || !hasLog {
+		t.Fatalf(" error has log after init %t %v", hasLog, err)
+	}
+	for _, dir := range []string{"up", "down"} {
+		err = mig.Log(&LogEntry{FileID: "dir1-1-init-sql", Checksum: "abc", Direction: dir, AppliedAt: time.Now().UTC(), AppliedBy: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := mig.LatestLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries["dir1-1-init-sql"] == nil || entries["dir1-1-init-sql"].Direction != "down" {
+		t.Errorf(" error latest log %v", entries)
+	}
+}
+
+func TestApplyLogSQLite(t *testing.T) {
+	mig := setupSQLite(t)
+	defer mig.CloseDB()
+
+	err := mig.InitLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := "-- +migrate Up\ncreate table orders (id integer primary key);\ninsert into missing values (1);\n"
+	err = mig.Apply(failed, "up", &LogEntry{FileID: "dir1-1-init-sql", Checksum: "abc", Direction: "up", AppliedAt: time.Now().UTC(), AppliedBy: "test"})
+	if err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	entries, err := mig.LatestLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf(" error a failed migration was logged %v", entries)
+	}
+
+	err = mig.Apply("-- +migrate Up\ncreate table orders (id integer primary key);\n", "up", &LogEntry{FileID: "dir1-1-init-sql", Checksum: "abc", Direction: "up", AppliedAt: time.Now().UTC(), AppliedBy: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = mig.LatestLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries["dir1-1-init-sql"] == nil || entries["dir1-1-init-sql"].Direction != "up" {
+		t.Errorf(" error latest log %v", entries)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	testcases := []struct {
+		dialect string
+		in      string
+		up      []string
+	}{
+		{
+			dialect: MySQL,
+			in: strings.Join([]string{
+				"-- +migrate Up",
+				"create table orders (id int);",
+				"DELIMITER $$",
+				"create procedure p()",
+				"begin",
+				"  select 1;",
+				"end$$",
+				"DELIMITER ;",
+				"-- +migrate Down",
+				"drop table orders;",
+			}, "\n"),
+			up: []string{"create table orders (id int);\n", "create procedure p()\nbegin\n  select 1;\nend\n"},
+		},
+		{
+			dialect: SQLServer,
+			in: strings.Join([]string{
+				"-- +migrate Up",
+				"create table orders (id int)",
+				"GO",
+				"create view v as select id from orders;",
+				"GO",
+				"-- +migrate Down",
+				"drop table orders;",
+			}, "\n"),
+			up: []string{"create table orders (id int)\n", "create view v as select id from orders;\n"},
+		},
+	}
+
+	for _, tcase := range testcases {
+		mig := Migration{Dialect: tcase.dialect}
+		parsed, err := mig.parse(tcase.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(parsed.UpStatements, "|") != strings.Join(tcase.up, "|") {
+			t.Errorf(" error split %s %q", tcase.dialect, parsed.UpStatements)
+		}
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	mig := setupSQLite(t)
+	defer mig.CloseDB()
+	mig.StatementTimeout = 50 * time.Millisecond
+
+	sql := `
+-- +migrate Up
+create table orders (id integer primary key);
+create table numbers as with recursive c(x) as (select 1 union all select x + 1 from c where x < 1000000000) select x from c;
+
+-- +migrate Down
+drop table numbers;
+drop table orders;
+`
+	err := mig.Execute(sql, "up")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf(" error execute expected timeout %v", err)
+	}
+	schema, err := mig.Introspect("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 0 {
+		t.Errorf(" error timeout did not roll back %+v", schema)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mig.CTX = ctx
+	err = mig.Execute("-- +migrate Up\ncreate table orders (id integer primary key);\n", "up")
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf(" error execute expected cancellation %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	createTable = regexp.MustCompile(`(?is)^create\s+table\s+(?:if\s+not\s+exists\s+)?([\w."\[\]]+)`)
+	addColumn   = regexp.MustCompile(`(?is)^alter\s+table\s+(?:if\s+exists\s+)?([\w."\[\]]+)\s+add\s+(?:column\s+)?(?:if\s+not\s+exists\s+)?([\w"\[\]]+)`)
+	createIndex = regexp.MustCompile(`(?is)^create\s+(?:unique\s+)?(?:nonclustered\s+|clustered\s+)?index\s+(?:concurrently\s+)?(?:if\s+not\s+exists\s+)?([\w."\[\]]+)\s+on\s+([\w."\[\]]+)`)
+	fileName    = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// addKeywords are the words which follow add in an alter table but do not name a column
+var addKeywords = map[string]bool{"constraint": true, "primary": true, "foreign": true, "unique": true, "check": true, "index": true}
+
+// FileName returns the file name for a new migration, such as 3_add_orders.sql
+func FileName(order int, name string) string {
+	name = strings.Trim(fileName.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	return fmt.Sprintf("%d_%s.sql", order, name)
+}
+
+// Scaffold returns a migration file with Up and Down sections, generating the Down statements for simple DDL
+func Scaffold(driver string, up string) string {
+	var ups, downs []string
+	for _, stmt := range strings.Split(up, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		ups = append(ups, stmt+";")
+		down, ok := Inverse(driver, stmt)
+		if !ok {
+			down = "-- TODO: undo " + strings.Join(strings.Fields(stmt), " ")
+		}
+		// undo in the reverse order to the up statements
+		downs = append([]string{down}, downs...)
+	}
+	if len(ups) == 0 {
+		ups = []string{"-- write the up migration here"}
+		downs = []string{"-- write the down migration here"}
+	}
+	return "-- +migrate Up\n" + strings.Join(ups, "\n") + "\n\n-- +migrate Down\n" + strings.Join(downs, "\n") + "\n"
+}
+
+// Inverse returns the statement undoing a CREATE TABLE, ADD COLUMN or CREATE INDEX statement
+func Inverse(driver string, stmt string) (string, bool) {
+	stmt = strings.TrimSpace(stmt)
+	if m := createTable.FindStringSubmatch(stmt); m != nil {
+		return fmt.Sprintf("drop table %s;", m[1]), true
+	}
+	if m := addColumn.FindStringSubmatch(stmt); m != nil {
+		if addKeywords[strings.ToLower(m[2])] {
+			return "", false
+		}
+		return fmt.Sprintf("alter table %s drop column %s;", m[1], m[2]), true
+	}
+	if m := createIndex.FindStringSubmatch(stmt); m != nil {
+		if driver == "sqlserver" || driver == "mssql" || driver == "mysql" {
+			return fmt.Sprintf("drop index %s on %s;", m[1], m[2]), true
+		}
+		return fmt.Sprintf("drop index %s;", m[1]), true
+	}
+	return "", false
+}
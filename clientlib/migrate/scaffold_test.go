@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"testing"
+)
+
+func TestInverse(t *testing.T) {
+	testcases := []struct {
+		driver string
+		in     string
+		out    string
+		ok     bool
+	}{
+		{driver: "postgres", in: "create table if not exists sch.orders (id int)", out: "drop table sch.orders;", ok: true},
+		{driver: "postgres", in: "ALTER TABLE sch.orders ADD COLUMN name varchar(20)", out: "alter table sch.orders drop column name;", ok: true},
+		{driver: "postgres", in: "alter table sch.orders add name_type varchar(20)", out: "alter table sch.orders drop column name_type;", ok: true},
+		{driver: "postgres", in: "alter table sch.orders add constraint pk primary key (id)", out: "", ok: false},
+		{driver: "postgres", in: "create unique index ix_orders on sch.orders (id)", out: "drop index ix_orders;", ok: true},
+		{driver: "sqlserver", in: "create index ix_orders on sch.orders (id)", out: "drop index ix_orders on sch.orders;", ok: true},
+		{driver: "postgres", in: "update sch.orders set id = 1", out: "", ok: false},
+	}
+
+	for _, tcase := range testcases {
+		out, ok := Inverse(tcase.driver, tcase.in)
+		if out != tcase.out || ok != tcase.ok {
+			t.Errorf(" error inverse %s: %s %t", tcase.in, out, ok)
+		}
+	}
+}
+
+func TestScaffold(t *testing.T) {
+	in := "create table sch.orders (id int);\ncreate index ix_orders on sch.orders (id);"
+	expect := "-- +migrate Up\ncreate table sch.orders (id int);\ncreate index ix_orders on sch.orders (id);\n\n-- +migrate Down\ndrop index ix_orders;\ndrop table sch.orders;\n"
+	out := Scaffold("postgres", in)
+	if out != expect {
+		t.Errorf(" error scaffold %s", out)
+	}
+	if FileName(3, "Add Orders!") != "3_add_orders.sql" {
+		t.Errorf(" error file name %s", FileName(3, "Add Orders!"))
+	}
+}
@@ -0,0 +1,239 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema represents the columns and indexes of a table in the target database
+type Schema struct {
+	Table   string   `json:"table"`
+	Columns []Column `json:"columns"`
+	Indexes []Index  `json:"indexes"`
+}
+
+// Column represents a single column of a table
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// Index represents a single index of a table
+type Index struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// splitTable returns the schema and table name of a db.schema.table style name
+func (mig *Migration) splitTable(table string) (string, string) {
+	parts := strings.Split(table, ".")
+	if len(parts) > 1 {
+		return parts[len(parts)-2], parts[len(parts)-1]
+	}
+	switch mig.Dialect {
+	case SQLServer:
+		return "dbo", table
+	case SQLite:
+		return "main", table
+	case MySQL:
+		return "", table
+	}
+	return "public", table
+}
+
+// Introspect captures the columns, types, nullability and indexes of a table from the target database
+func (mig *Migration) Introspect(table string) (*Schema, error) {
+	if mig.Dialect == SQLite {
+		return mig.introspectSQLite(table)
+	}
+	schemaName, tableName := mig.splitTable(table)
+	schema := Schema{Table: table, Columns: []Column{}, Indexes: []Index{}}
+
+	// mysql calls a database a schema, so an unqualified table is looked up in the current database
+	schemaFilter := fmt.Sprintf("c.table_schema = %s", mig.placeholder(1))
+	if mig.Dialect == MySQL && schemaName == "" {
+		schemaFilter = fmt.Sprintf("c.table_schema = coalesce(nullif(%s, ''), database())", mig.placeholder(1))
+	}
+
+	query := fmt.Sprintf(`
+		select 		c.column_name
+					, c.data_type
+					, case when c.is_nullable = 'YES' then 1 else 0 end
+		from 		information_schema.columns as c
+		where 		%s
+		and 		c.table_name 	= %s
+		order by 	c.ordinal_position asc
+	`, schemaFilter, mig.placeholder(2))
+
+	err := mig.readColumns(&schema, false, query, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mig.Dialect {
+	case MySQL:
+		query = fmt.Sprintf(`
+			select 		s.index_name
+						, concat(case when s.non_unique = 0 then 'UNIQUE ' else '' end, s.index_type, ' (', group_concat(s.column_name order by s.seq_in_index separator ', '), ')')
+			from 		information_schema.statistics as s
+			where 		s.table_schema 	= coalesce(nullif(%s, ''), database())
+			and 		s.table_name 	= %s
+			group by 	s.index_name, s.non_unique, s.index_type
+			order by 	s.index_name asc
+		`, mig.placeholder(1), mig.placeholder(2))
+	case SQLServer:
+		query = fmt.Sprintf(`
+			select 		i.name
+						, i.type_desc + case when i.is_unique = 1 then ' UNIQUE' else '' end
+			from 		sys.indexes as i
+			inner join 	sys.tables as t
+			on 			t.object_id 	= i.object_id
+			inner join 	sys.schemas as s
+			on 			s.schema_id 	= t.schema_id
+			where 		s.name 			= %s
+			and 		t.name 			= %s
+			and 		i.name is not null
+			order by 	i.name asc
+		`, mig.placeholder(1), mig.placeholder(2))
+	default:
+		query = fmt.Sprintf(`
+			select 		i.indexname
+						, i.indexdef
+			from 		pg_indexes as i
+			where 		i.schemaname 	= %s
+			and 		i.tablename 	= %s
+			order by 	i.indexname asc
+		`, mig.placeholder(1), mig.placeholder(2))
+	}
+
+	err = mig.readIndexes(&schema, query, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// introspectSQLite captures a table using the sqlite pragmas, as sqlite has no information_schema
+func (mig *Migration) introspectSQLite(table string) (*Schema, error) {
+	schemaName, tableName := mig.splitTable(table)
+	schema := Schema{Table: table, Columns: []Column{}, Indexes: []Index{}}
+
+	query := fmt.Sprintf(`
+		select 		c.name
+					, c.type
+					, case when c."notnull" = 0 and c.pk = 0 then 1 else 0 end
+		from 		pragma_table_info(%[1]s, %[2]s) as c
+		order by 	c.cid asc
+	`, mig.placeholder(1), mig.placeholder(2))
+
+	err := mig.readColumns(&schema, true, query, tableName, schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(`
+		select 		i.name
+					, coalesce(i.sql, '')
+		from 		"%s".sqlite_master as i
+		where 		i.type 		= 'index'
+		and 		i.tbl_name 	= %s
+		order by 	i.name asc
+	`, strings.ReplaceAll(schemaName, `"`, `""`), mig.placeholder(1))
+
+	err = mig.readIndexes(&schema, query, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// readColumns appends the name, type and nullability rows returned by a query to a schema
+func (mig *Migration) readColumns(schema *Schema, lower bool, query string, args ...interface{}) error {
+	rows, err := mig.Executor.Query(mig.CTX, query, args...)
+	if err != nil {
+		return fmt.Errorf("unable to read table columns: %w", err)
+	}
+	for _, row := range rows {
+		if len(row) != 3 {
+			return fmt.Errorf("unable to read table columns: expected 3 columns, got %d", len(row))
+		}
+		col := Column{Name: row[0], Type: row[1], Nullable: row[2] == "1"}
+		if lower {
+			col.Type = strings.ToLower(col.Type)
+		}
+		schema.Columns = append(schema.Columns, col)
+	}
+	return nil
+}
+
+// readIndexes appends the name and definition rows returned by a query to a schema
+func (mig *Migration) readIndexes(schema *Schema, query string, args ...interface{}) error {
+	rows, err := mig.Executor.Query(mig.CTX, query, args...)
+	if err != nil {
+		return fmt.Errorf("unable to read table indexes: %w", err)
+	}
+	for _, row := range rows {
+		if len(row) != 2 {
+			return fmt.Errorf("unable to read table indexes: expected 2 columns, got %d", len(row))
+		}
+		schema.Indexes = append(schema.Indexes, Index{Name: row[0], Definition: row[1]})
+	}
+	return nil
+}
+
+// DiffSchema returns the changes between two schemas, prefixed with + for added, - for removed and ~ for changed
+func DiffSchema(from *Schema, to *Schema) []string {
+	var changes []string
+
+	fromCols := make(map[string]Column)
+	for _, c := range from.Columns {
+		fromCols[c.Name] = c
+	}
+	toCols := make(map[string]Column)
+	for _, c := range to.Columns {
+		toCols[c.Name] = c
+		old, ok := fromCols[c.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ column %s %s", c.Name, columnText(c)))
+		} else if old != c {
+			changes = append(changes, fmt.Sprintf("~ column %s %s -> %s", c.Name, columnText(old), columnText(c)))
+		}
+	}
+	for _, c := range from.Columns {
+		if _, ok := toCols[c.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("- column %s %s", c.Name, columnText(c)))
+		}
+	}
+
+	fromIdx := make(map[string]Index)
+	for _, i := range from.Indexes {
+		fromIdx[i.Name] = i
+	}
+	toIdx := make(map[string]Index)
+	for _, i := range to.Indexes {
+		toIdx[i.Name] = i
+		old, ok := fromIdx[i.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ index %s %s", i.Name, i.Definition))
+		} else if old != i {
+			changes = append(changes, fmt.Sprintf("~ index %s %s -> %s", i.Name, old.Definition, i.Definition))
+		}
+	}
+	var removed []string
+	for _, i := range from.Indexes {
+		if _, ok := toIdx[i.Name]; !ok {
+			removed = append(removed, fmt.Sprintf("- index %s %s", i.Name, i.Definition))
+		}
+	}
+	sort.Strings(removed)
+	return append(changes, removed...)
+}
+
+func columnText(c Column) string {
+	if c.Nullable {
+		return c.Type + " null"
+	}
+	return c.Type + " not null"
+}
@@ -0,0 +1,28 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	from := &Schema{
+		Table:   "db.sch.orders",
+		Columns: []Column{{Name: "id", Type: "integer"}, {Name: "name", Type: "text", Nullable: true}},
+		Indexes: []Index{{Name: "ix_name", Definition: "create index ix_name on sch.orders (name)"}},
+	}
+	to := &Schema{
+		Table:   "db.sch.orders",
+		Columns: []Column{{Name: "id", Type: "bigint"}, {Name: "name_type", Type: "text", Nullable: true}},
+	}
+	expect := []string{
+		"~ column id integer not null -> bigint not null",
+		"+ column name_type text null",
+		"- column name text null",
+		"- index ix_name create index ix_name on sch.orders (name)",
+	}
+	out := DiffSchema(from, to)
+	if strings.Join(out, "\n") != strings.Join(expect, "\n") {
+		t.Errorf(" error diff %s", out)
+	}
+}
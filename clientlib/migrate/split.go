@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	statementBegin = "-- +migrate StatementBegin"
+	statementEnd   = "-- +migrate StatementEnd"
+)
+
+var (
+	delimiter     = regexp.MustCompile(`(?i)^\s*delimiter\s+(\S+)\s*$`)
+	createTrigger = regexp.MustCompile(`(?i)^\s*create\s+(temp\s+|temporary\s+)?trigger\b`)
+	triggerEnd    = regexp.MustCompile(`(?i)\bend\s*;\s*$`)
+	batchEnd      = regexp.MustCompile(`(?i)^\s*go\s*$`)
+)
+
+// Split marks the statements of a migration which contain semicolons for the dialect, so they are not split apart.
+// MySQL DELIMITER blocks, SQLite triggers and SQL Server GO batches each become a single statement.
+func Split(dialect string, sql string) string {
+	lines := strings.Split(sql, "\n")
+	switch dialect {
+	case MySQL:
+		return strings.Join(splitDelimiters(lines), "\n")
+	case SQLite:
+		return strings.Join(splitTriggers(lines), "\n")
+	case SQLServer:
+		return strings.Join(splitBatches(lines), "\n")
+	}
+	return sql
+}
+
+// splitDelimiters turns MySQL DELIMITER blocks into single statements
+func splitDelimiters(lines []string) []string {
+	var out []string
+	delim := ";"
+	inStatement := false
+	for _, line := range lines {
+		if m := delimiter.FindStringSubmatch(line); m != nil {
+			delim = m[1]
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if delim == ";" || strings.HasPrefix(trimmed, "-- +") || (!inStatement && (trimmed == "" || strings.HasPrefix(trimmed, "--"))) {
+			out = append(out, line)
+			continue
+		}
+		if !inStatement {
+			out = append(out, statementBegin)
+			inStatement = true
+		}
+		if strings.HasSuffix(trimmed, delim) {
+			out = append(out, strings.TrimSuffix(strings.TrimRight(line, " \t\r"), delim), statementEnd)
+			inStatement = false
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// splitTriggers turns SQLite CREATE TRIGGER ... END; blocks into single statements
+func splitTriggers(lines []string) []string {
+	var out []string
+	explicit := false
+	inTrigger := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == statementBegin:
+			explicit = true
+		case trimmed == statementEnd:
+			explicit = false
+		case !explicit && !inTrigger && createTrigger.MatchString(line):
+			out = append(out, statementBegin)
+			inTrigger = true
+		}
+		out = append(out, line)
+		if inTrigger && triggerEnd.MatchString(line) {
+			out = append(out, statementEnd)
+			inTrigger = false
+		}
+	}
+	return out
+}
+
+// splitBatches turns each SQL Server GO batch into a single statement
+func splitBatches(lines []string) []string {
+	var out, batch []string
+	hasBatches := false
+	flush := func() {
+		if strings.TrimSpace(strings.Join(batch, "")) != "" {
+			if hasBatches {
+				out = append(out, statementBegin)
+				out = append(out, batch...)
+				out = append(out, statementEnd)
+			} else {
+				out = append(out, batch...)
+			}
+		}
+		batch = nil
+	}
+	section := func(lines []string) bool {
+		for _, l := range lines {
+			if strings.HasPrefix(strings.TrimSpace(l), "-- +migrate Up") || strings.HasPrefix(strings.TrimSpace(l), "-- +migrate Down") {
+				return false
+			}
+			if batchEnd.MatchString(l) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "-- +migrate Up") || strings.HasPrefix(trimmed, "-- +migrate Down") {
+			flush()
+			out = append(out, line)
+			hasBatches = section(lines[i+1:])
+			continue
+		}
+		if hasBatches && batchEnd.MatchString(line) {
+			flush()
+			continue
+		}
+		batch = append(batch, line)
+	}
+	flush()
+	return out
+}
@@ -1,26 +1,45 @@
 package migation
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/c-jamie/sql-manager/clientlib/log"
 	"github.com/c-jamie/sql-manager/clientlib/migrate"
 	"github.com/c-jamie/sql-manager/clientlib/request"
+	"github.com/c-jamie/sql-manager/clientlib/utils"
 	"github.com/jedib0t/go-pretty/table"
+	"github.com/jedib0t/go-pretty/text"
 	"github.com/tidwall/gjson"
 )
 
 const (
 	AddMigration        = "migrations"
+	AllMigration        = "migrations/all"
+	DAGMigration        = "migrations/dag"
+	DiffMigration       = "migrations/diff"
+	PromoteMigration    = "migrations/promote"
+	SyncMigration       = "migrations/sync"
+	HistoryMigration    = "migrations/latest/history"
+	UndoMigration       = "migrations/latest/undo"
+	SchemaMigration     = "migrations/schema"
 	DeleteMigration     = "migrations"
 	GetMigration        = "migrations"
 	ListMigrationTables = "migrations/table"
+	ListMigration       = "migrations/list"
 	SetMigration        = "migrations/latest"
 	UpdateMigration     = "migrations"
+	// listPageSize is the number of records fetched per request from paged endpoints
+	listPageSize = 100
 )
 
 // SQLMigrationStrategy defines the domain for a given table and env
@@ -34,18 +53,152 @@ type SQLMigrationStrategy struct {
 
 // SQLMigration defines the domain for a migration
 type SQLMigration struct {
-	Env            string     `json:"env"`
-	FileID         string     `json:"file_id"`
-	File           string     `json:"file"`
-	FileOrder      int        `json:"file_order"`
-	SourceTable    string     `json:"source_table"`
-	MigratedAt     *time.Time `json:"migrated_at"`
-	MigratedAtNull bool       `json:"migrated_at_null"`
-	ID             int        `json:"id"`
-	Script         string     `json:"script"`
-	Status         *string    `json:"status"`
+	Env             string     `json:"env"`
+	FileID          string     `json:"file_id"`
+	File            string     `json:"file"`
+	FileOrder       int        `json:"file_order"`
+	SourceTable     string     `json:"source_table"`
+	MigratedAt      *time.Time `json:"migrated_at"`
+	MigratedAtNull  bool       `json:"migrated_at_null"`
+	ID              int        `json:"id"`
+	Script          string     `json:"script"`
+	Status          *string    `json:"status"`
+	Checksum        *string    `json:"checksum"`
+	AppliedChecksum *string    `json:"applied_checksum"`
+	CurrentChecksum string     `json:"current_checksum"`
+	Changed         bool       `json:"changed"`
+	Modified        bool       `json:"modified"`
 }
 
+// RunOptions controls how migrations are applied
+type RunOptions struct {
+	// AllowModified permits running an already applied migration whose script has been edited since
+	AllowModified bool
+	// Parallel is the number of independent tables RunAll applies at the same time
+	Parallel int
+	// Context cancels the run, the migration in flight is rolled back and left unapplied
+	Context context.Context
+	// StatementTimeout cancels a single statement which runs for longer, zero means no timeout
+	StatementTimeout time.Duration
+}
+
+// The outcomes of running the migrations of a table
+const (
+	RunSuccess = "success"
+	RunFailed  = "failed"
+	RunSkipped = "skipped"
+)
+
+// RunResult is the outcome of running the migrations of a single table
+type RunResult struct {
+	Table    string
+	Status   string
+	Applied  int
+	Duration time.Duration
+	Err      error
+}
+
+
+// SQLMigrationStatus defines the state of a migration as seen by the server and by the target database
+type SQLMigrationStatus struct {
+	ID            int        `json:"id"`
+	File          string     `json:"file"`
+	FileOrder     int        `json:"file_order"`
+	ServerApplied bool       `json:"server_applied"`
+	TargetApplied bool       `json:"target_applied"`
+	AppliedAt     *time.Time `json:"applied_at"`
+	AppliedBy     string     `json:"applied_by"`
+	Drift         bool       `json:"drift"`
+}
+
+// SQLMigrationDependency records that a migration must be applied after another migration
+type SQLMigrationDependency struct {
+	ID             int  `json:"id"`
+	SQLMigrationID int  `json:"sql_migration_id"`
+	DependsOnID    int  `json:"depends_on_id"`
+	Implicit       bool `json:"implicit"`
+}
+
+// SQLMigrationDependencyRef references a migration of another table by its file order
+type SQLMigrationDependencyRef struct {
+	Table string `json:"table"`
+	Order int    `json:"order"`
+}
+
+// SQLMigrationDAG defines every migration in an env and the order they must be applied in
+type SQLMigrationDAG struct {
+	Env   string                    `json:"env"`
+	Nodes []*SQLMigration           `json:"nodes"`
+	Edges []*SQLMigrationDependency `json:"edges"`
+	Order []int                     `json:"order"`
+}
+
+// SQLMigrationTableDiff defines the differences between the migrations of a table in two envs
+type SQLMigrationTableDiff struct {
+	Table              string          `json:"table"`
+	MissingInTarget    []*SQLMigration `json:"missing_in_target"`
+	MissingInSource    []*SQLMigration `json:"missing_in_source"`
+	NotAppliedInTarget []*SQLMigration `json:"not_applied_in_target"`
+	NotAppliedInSource []*SQLMigration `json:"not_applied_in_source"`
+}
+
+// SQLMigrationDiff defines the differences between the migrations of two envs
+type SQLMigrationDiff struct {
+	Source string                   `json:"source"`
+	Target string                   `json:"target"`
+	Tables []*SQLMigrationTableDiff `json:"tables"`
+}
+
+// SQLMigrationSchema defines the schema of a table captured after a migration was applied
+type SQLMigrationSchema struct {
+	ID             int            `json:"id"`
+	SQLMigrationID int            `json:"sql_migration_id"`
+	Env            string         `json:"env"`
+	SourceTable    string         `json:"source_table"`
+	FileOrder      int            `json:"file_order"`
+	Schema         migrate.Schema `json:"schema"`
+	CapturedAt     time.Time      `json:"captured_at"`
+}
+
+// SQLMigrationDrift defines the differences between the live schema of a table and its recorded schema
+type SQLMigrationDrift struct {
+	Table          string   `json:"table"`
+	SQLMigrationID int      `json:"sql_migration_id"`
+	FileOrder      int      `json:"file_order"`
+	Recorded       bool     `json:"recorded"`
+	Changes        []string `json:"changes"`
+}
+
+// SQLMigrationsLatestHistory defines a single change to the latest migration of a table
+type SQLMigrationsLatestHistory struct {
+	ID                 int       `json:"id"`
+	Env                string    `json:"env"`
+	Table              string    `json:"table"`
+	OldSQLMigrationsID *int      `json:"old_sql_migrations_id"`
+	NewSQLMigrationsID *int      `json:"new_sql_migrations_id"`
+	ChangedBy          string    `json:"changed_by"`
+	ChangedAt          time.Time `json:"changed_at"`
+	Reason             string    `json:"reason"`
+}
+
+// SQLMigrationSync defines the result of registering a git directory
+type SQLMigrationSync struct {
+	Migrations []*SQLMigration `json:"migrations"`
+	Missing    []*SQLMigration `json:"missing"`
+}
+
+// ParseDependency parses a dependency of the form table:order
+func ParseDependency(dep string) (*SQLMigrationDependencyRef, error) {
+	i := strings.LastIndex(dep, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("dependency %s must be of the form table:order", dep)
+	}
+	order, err := strconv.Atoi(dep[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("dependency %s must be of the form table:order: %w", dep, err)
+	}
+	return &SQLMigrationDependencyRef{Table: dep[:i], Order: order}, nil
+}
 
 // MigrationTable defines the domain for all migrations associated with a table
 type MigrationTable struct {
@@ -56,31 +209,56 @@ type MigrationTable struct {
 
 // Migration represents the interface used to control migrations
 type Migration interface {
-	// Add adds / registers a new migration
-	Add(file string, env string, table string) error
+	// Add adds / registers a new migration, optionally after migrations of other tables
+	Add(file string, env string, table string, dependsOn []*SQLMigrationDependencyRef) error
 	// Get returns the migration file
 	Get(env string, table string) (*SQLMigrationStrategy, error)
 	// ListTables lists the tables for a given env
 	ListTables(env string) ([]*MigrationTable, error)
+	// List returns the migrations of a table ordered by env and file order, env and status (applied or pending) are optional
+	List(env string, table string, status string) ([]*SQLMigration, error)
 	// Delete removes a migration
 	Delete(env string, table string, migrationID int) error
-	// Update updates metadata associated with a migration
-	Update(env string, table string, migrationID int, timeStamp time.Time, timeStampNull bool) error
-	// Set defines the current latest migration
-	Set(env string, table string, migrationID int) error
+	// Update updates metadata associated with a migration, checksum is the SHA-256 of the script applied
+	Update(env string, table string, migrationID int, timeStamp time.Time, timeStampNull bool, checksum string) error
+	// Set defines the current latest migration, an id of 0 sets the table to its base
+	Set(env string, table string, migrationID int, reason string) error
+	// Drift compares the live schema of tables in the target database with the schema recorded after their latest applied migration
+	Drift(exec migrate.Executor, env string, tables []string) ([]*SQLMigrationDrift, error)
+	// AddSchema uploads the schema of a table captured after a migration was applied
+	AddSchema(migrationID int, schema *migrate.Schema) error
+	// Schemas returns the latest schema captured after each migration of a table
+	Schemas(env string, table string) ([]*SQLMigrationSchema, error)
+	// History returns the changes made to the latest migration, most recent first
+	History(env string, table string) ([]*SQLMigrationsLatestHistory, error)
+	// Undo restores the latest migration to where it was before the most recent change
+	Undo(env string, table string, reason string) error
 	// GetAll returns a all migrations for an env split by table
 	GetAll(env string) ([]*SQLMigrationStrategy, error)
+	// Diff compares the registered and applied migrations of two envs
+	Diff(source string, target string) (*SQLMigrationDiff, error)
+	// Sync registers every migration in a git directory not yet known to the server
+	Sync(dir string, env string, table string) (*SQLMigrationSync, error)
+	// Promote registers the migrations of a table missing from the target env
+	Promote(source string, target string, table string, requireApplied bool) ([]*SQLMigration, error)
+	// DAG returns every migration for an env in dependency order
+	DAG(env string) (*SQLMigrationDAG, error)
 	// Run applies migrations
-	Run(driver string, connection string, env string, table string) error
+	Run(exec migrate.Executor, env string, table string, opts RunOptions) error
+	// RunAll applies the migrations of every table in an env in dependency order
+	RunAll(exec migrate.Executor, env string, opts RunOptions) ([]*RunResult, error)
+	// Status reconciles the server's migrations with the log kept in the target database, returning migrate.ErrNoLog when there is no log
+	Status(exec migrate.Executor, env string, table string) ([]*SQLMigrationStatus, error)
 }
 
 type migration struct {
 	BaseURL string
+	User    string
 }
 
-// New creates a new migration container
-func New(url string) Migration {
-	mig := &migration{BaseURL: url}
+// New creates a new migration container, user is recorded against migrations run in the target database
+func New(url string, user string) Migration {
+	mig := &migration{BaseURL: url, User: user}
 	return mig
 }
 
@@ -110,43 +288,85 @@ func (app *migration) makeRequest(url string, payload []byte, how string) ([]byt
 	return body, nil
 }
 
-func (app *migration) List(env string) ([]*MigrationTable, error) {
-
-	unmarshal := func(body []byte) ([]*MigrationTable, error) {
-		var mig []*MigrationTable
-		jsonErr := json.Unmarshal(body, &mig)
-		if jsonErr != nil {
-			return nil, jsonErr
+func (app *migration) List(env string, table string, status string) ([]*SQLMigration, error) {
+	// the server pages the migrations of a table, fetch every page
+	var out []*SQLMigration
+	for page := 1; ; page++ {
+		qs := url.Values{
+			"env":       {env},
+			"table":     {table},
+			"status":    {status},
+			"page":      {strconv.Itoa(page)},
+			"page_size": {strconv.Itoa(listPageSize)},
+		}
+		body, err := app.makeRequest("/"+ListMigration+"?"+qs.Encode(), nil, http.MethodGet)
+		if err != nil {
+			return nil, err
+		}
+		var migs []*SQLMigration
+		err = json.Unmarshal([]byte(gjson.Get(string(body), "migrations").String()), &migs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, migs...)
+		if page >= int(gjson.Get(string(body), "metadata.last_page").Int()) {
+			break
 		}
-		return mig, nil
-	}
-	payload := []byte(fmt.Sprintf(`{"env":"%s"}`, env))
-	url := "/" + ListMigrationTables
-	body, err := app.makeRequest(url, payload, http.MethodGet)
-	if err != nil {
-		return nil, err
-	}
-	out, err := unmarshal(body)
-	if err != nil {
-		return nil, err
 	}
 	return out, nil
 }
 
-func (app *migration) Add(file string, env string, table string) error {
-	payload := []byte(fmt.Sprintf(`{"env":"%s", "table":"%s", "file": "%s"}`, env, table, file))
+func (app *migration) Add(file string, env string, table string, dependsOn []*SQLMigrationDependencyRef) error {
+	payload, err := json.Marshal(struct {
+		Env       string                       `json:"env"`
+		Table     string                       `json:"table"`
+		File      string                       `json:"file"`
+		DependsOn []*SQLMigrationDependencyRef `json:"depends_on"`
+	}{env, table, file, dependsOn})
+	if err != nil {
+		return err
+	}
 	url := "/" + AddMigration
-	_, err := app.makeRequest(url, payload, http.MethodPost)
+	_, err = app.makeRequest(url, payload, http.MethodPost)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (app *migration) Sync(dir string, env string, table string) (*SQLMigrationSync, error) {
+	payload, err := json.Marshal(struct {
+		Dir   string `json:"dir"`
+		Env   string `json:"env"`
+		Table string `json:"table"`
+	}{dir, env, table})
+	if err != nil {
+		return nil, err
+	}
+	url := "/" + SyncMigration
+	body, err := app.makeRequest(url, payload, http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+	var sync SQLMigrationSync
+	err = json.Unmarshal(body, &sync)
+	if err != nil {
+		return nil, err
+	}
+	return &sync, nil
+}
+
 func (app *migration) Delete(env string, table string, migrationID int) error {
-	payload := []byte(fmt.Sprintf(`{"env":"%s", "table":"%s", "sql_migration_id": %d}`, env, table, migrationID))
+	payload, err := json.Marshal(struct {
+		Env            string `json:"env"`
+		Table          string `json:"table"`
+		SQLMigrationID int    `json:"sql_migration_id"`
+	}{env, table, migrationID})
+	if err != nil {
+		return err
+	}
 	url := "/" + DeleteMigration
-	_, err := app.makeRequest(url, payload, http.MethodDelete)
+	_, err = app.makeRequest(url, payload, http.MethodDelete)
 	if err != nil {
 		return err
 	}
@@ -162,7 +382,7 @@ func (app *migration) Get(env string, table string) (*SQLMigrationStrategy, erro
 		}
 		return &mig, nil
 	}
-	url := "/" + GetMigration + "?env=" + env + "&table=" + table
+	url := "/" + GetMigration + "?" + url.Values{"env": {env}, "table": {table}}.Encode()
 	body, err := app.makeRequest(url, nil, http.MethodGet)
 	if err != nil {
 		return nil, err
@@ -185,39 +405,61 @@ func (app *migration) ListTables(env string) ([]*MigrationTable, error) {
 		}
 		return mig, nil
 	}
-	url := "/" + ListMigrationTables + "?env=" + env
-	body, err := app.makeRequest(url, nil, http.MethodGet)
-	json := gjson.Get(string(body), "migrations.tables").String()
-	if err != nil {
-		return nil, err
-	}
-	out, err := unmarshal([]byte(json))
-	if err != nil {
-		return nil, err
+	// the server pages its tables, fetch every page
+	var out []*MigrationTable
+	for page := 1; ; page++ {
+		qs := url.Values{"env": {env}, "page": {strconv.Itoa(page)}, "page_size": {strconv.Itoa(listPageSize)}}
+		url := "/" + ListMigrationTables + "?" + qs.Encode()
+		body, err := app.makeRequest(url, nil, http.MethodGet)
+		if err != nil {
+			return nil, err
+		}
+		json := gjson.Get(string(body), "migrations.tables").String()
+		tables, err := unmarshal([]byte(json))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tables...)
+		if page >= int(gjson.Get(string(body), "metadata.last_page").Int()) {
+			break
+		}
 	}
 	return out, nil
 }
 
-func (app *migration) Update(env string, table string, migrationID int, timeStamp time.Time, timeStampNull bool) error {
-	payload := []byte(fmt.Sprintf(`{"env":"%s", "table":"%s", "sql_migration_id": %d, "migrated_at": "%s", "migrated_at_null": %t}`,
-		env,
-		table,
-		migrationID,
-		timeStamp,
-		timeStampNull,
-	))
+func (app *migration) Update(env string, table string, migrationID int, timeStamp time.Time, timeStampNull bool, checksum string) error {
+	payload, err := json.Marshal(struct {
+		Env            string    `json:"env"`
+		Table          string    `json:"table"`
+		SQLMigrationID int       `json:"sql_migration_id"`
+		MigratedAt     time.Time `json:"migrated_at"`
+		MigratedAtNull bool      `json:"migrated_at_null"`
+		Checksum       string    `json:"checksum,omitempty"`
+	}{env, table, migrationID, timeStamp, timeStampNull, checksum})
+	if err != nil {
+		return err
+	}
 	url := "/" + UpdateMigration
-	_, err := app.makeRequest(url, payload, http.MethodPatch)
+	_, err = app.makeRequest(url, payload, http.MethodPatch)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (app *migration) Set(env string, table string, migrationID int) error {
-	payload := []byte(fmt.Sprintf(`{"env":"%s", "table":"%s", "sql_migration_id": %d}`, env, table, migrationID))
+func (app *migration) Set(env string, table string, migrationID int, reason string) error {
+	payload, err := json.Marshal(struct {
+		Env            string `json:"env"`
+		Table          string `json:"table"`
+		SQLMigrationID int    `json:"sql_migration_id"`
+		Base           bool   `json:"base"`
+		Reason         string `json:"reason"`
+	}{env, table, migrationID, migrationID == 0, reason})
+	if err != nil {
+		return err
+	}
 	url := "/" + SetMigration
-	_, err := app.makeRequest(url, payload, http.MethodPost)
+	_, err = app.makeRequest(url, payload, http.MethodPost)
 	if err != nil {
 		return err
 	}
@@ -225,72 +467,522 @@ func (app *migration) Set(env string, table string, migrationID int) error {
 
 }
 
+func (app *migration) History(env string, table string) ([]*SQLMigrationsLatestHistory, error) {
+	url := "/" + HistoryMigration + "?" + url.Values{"env": {env}, "table": {table}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	var hist []*SQLMigrationsLatestHistory
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "history").String()), &hist)
+	if err != nil {
+		return nil, err
+	}
+	return hist, nil
+}
+
+func (app *migration) Undo(env string, table string, reason string) error {
+	payload, err := json.Marshal(struct {
+		Env    string `json:"env"`
+		Table  string `json:"table"`
+		Reason string `json:"reason"`
+	}{env, table, reason})
+	if err != nil {
+		return err
+	}
+	url := "/" + UndoMigration
+	_, err = app.makeRequest(url, payload, http.MethodPost)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (app *migration) GetAll(env string) ([]*SQLMigrationStrategy, error) {
+	url := "/" + AllMigration + "?" + url.Values{"env": {env}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
 	var out []*SQLMigrationStrategy
-	tables, err := app.ListTables(env)
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "migrations").String()), &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
 
+func (app *migration) DAG(env string) (*SQLMigrationDAG, error) {
+	url := "/" + DAGMigration + "?" + url.Values{"env": {env}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
 	if err != nil {
 		return nil, err
 	}
+	var dag SQLMigrationDAG
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "dag").String()), &dag)
+	if err != nil {
+		return nil, err
+	}
+	return &dag, nil
+}
 
-	for _, t := range tables {
-		mig, err := app.Get(env, t.Table)
-		if err != nil {
-			return nil, err
-		}
-		out = append(out, mig)
+func (app *migration) Diff(source string, target string) (*SQLMigrationDiff, error) {
+	url := "/" + DiffMigration + "?" + url.Values{"source": {source}, "target": {target}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
+	if err != nil {
+		return nil, err
 	}
-	return out, nil
+	var diff SQLMigrationDiff
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "diff").String()), &diff)
+	if err != nil {
+		return nil, err
+	}
+	return &diff, nil
 }
 
-func (app *migration) Run(driver string, connection string, env string, table string) error {
-	migrator, err := migrate.New(driver, connection)
+func (app *migration) Promote(source string, target string, table string, requireApplied bool) ([]*SQLMigration, error) {
+	payload, err := json.Marshal(struct {
+		Source         string `json:"source"`
+		Target         string `json:"target"`
+		Table          string `json:"table"`
+		RequireApplied bool   `json:"require_applied"`
+	}{source, target, table, requireApplied})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	url := "/" + PromoteMigration
+	body, err := app.makeRequest(url, payload, http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+	var migs []*SQLMigration
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "migrations").String()), &migs)
+	if err != nil {
+		return nil, err
+	}
+	return migs, nil
+}
+
+func (app *migration) Run(exec migrate.Executor, env string, table string, opts RunOptions) error {
 	migrations, err := app.Get(env, table)
 	if err != nil {
 		return err
 	}
-	log.Debug("loading migrations for ", driver, env, table)
+	err = checkModified(migrations.MigrationsDown, opts)
+	if err != nil {
+		return err
+	}
+	migrator := newMigrator(exec, opts)
+	err = migrator.InitLog()
+	if err != nil {
+		return err
+	}
+	log.Debug("loading migrations for ", exec.Dialect(), env, table)
 	if migrations.MigrationsDown != nil {
 		for _, sql := range migrations.MigrationsDown {
-			log.Debug("migration down id", sql.ID, sql.MigratedAtNull)
-			if !sql.MigratedAtNull {
-				err = migrator.Execute(sql.Script, "down")
-				if err != nil {
-					return err
-				}
-				err = app.Update(env, table, sql.ID, time.Now(), true)
-				if err != nil {
-					return err
-				}
-			} else {
-				log.Debug("migration ", sql.ID, " is already down")
+			err = app.down(migrator, env, sql)
+			if err != nil {
+				return err
 			}
 		}
 	}
 	if migrations.MigrationsUp != nil {
 		for _, sql := range migrations.MigrationsUp {
-			log.Debug("migration up id ", sql.ID, sql.MigratedAtNull)
-			if sql.MigratedAtNull {
-				err = migrator.Execute(sql.Script, "up")
-
-				if err != nil {
-					return err
-				}
-				err = app.Update(env, table, sql.ID, time.Now(), false)
-				if err != nil {
-					return err
-				}
-			} else {
-				log.Debug("migration ", sql.ID, " already up")
+			err = app.up(migrator, env, sql)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (app *migration) RunAll(exec migrate.Executor, env string, opts RunOptions) ([]*RunResult, error) {
+	strategies, err := app.GetAll(env)
+	if err != nil {
+		return nil, err
+	}
+	dag, err := app.DAG(env)
+	if err != nil {
+		return nil, err
+	}
+
+	ups := make(map[int]*SQLMigration)
+	downs := make(map[int]*SQLMigration)
+	tableOf := make(map[int]string)
+	for _, s := range strategies {
+		err = checkModified(s.MigrationsDown, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range s.MigrationsUp {
+			ups[m.ID] = m
+			tableOf[m.ID] = s.Table
+		}
+		for _, m := range s.MigrationsDown {
+			downs[m.ID] = m
+			tableOf[m.ID] = s.Table
+		}
+	}
+
+	for _, e := range dag.Edges {
+		if _, ok := ups[e.SQLMigrationID]; !ok {
+			continue
+		}
+		if dep, ok := downs[e.DependsOnID]; ok {
+			return nil, fmt.Errorf("migration %d depends on migration %d (%s) which is not set to be applied", e.SQLMigrationID, dep.ID, dep.File)
+		}
+	}
+
+	migrator := newMigrator(exec, opts)
+	err = migrator.InitLog()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := runGroups(strategies, dag, tableOf)
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	jobs := make(chan *runGroup)
+	var mu sync.Mutex
+	var results []*RunResult
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range jobs {
+				res := app.runGroup(migrator, env, g, ups, downs)
+				mu.Lock()
+				results = append(results, res...)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, g := range groups {
+		jobs <- g
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Table < results[j].Table
+	})
+	return results, nil
+}
+
+// runGroup is a set of tables whose migrations depend on each other, so they are applied together in dependency order
+type runGroup struct {
+	tables []string
+	order  []int
+}
+
+// runGroups splits the tables of an env into groups with no dependencies between them
+func runGroups(strategies []*SQLMigrationStrategy, dag *SQLMigrationDAG, tableOf map[int]string) []*runGroup {
+	parent := make(map[string]string)
+	var find func(t string) string
+	find = func(t string) string {
+		if parent[t] != t {
+			parent[t] = find(parent[t])
+		}
+		return parent[t]
+	}
+	for _, s := range strategies {
+		parent[s.Table] = s.Table
+	}
+	for _, e := range dag.Edges {
+		from, ok := tableOf[e.SQLMigrationID]
+		if !ok {
+			continue
+		}
+		to, ok := tableOf[e.DependsOnID]
+		if !ok {
+			continue
+		}
+		parent[find(from)] = find(to)
+	}
+
+	byRoot := make(map[string]*runGroup)
+	var groups []*runGroup
+	for _, s := range strategies {
+		root := find(s.Table)
+		g, ok := byRoot[root]
+		if !ok {
+			g = &runGroup{}
+			byRoot[root] = g
+			groups = append(groups, g)
+		}
+		g.tables = append(g.tables, s.Table)
+	}
+	for _, id := range dag.Order {
+		if t, ok := tableOf[id]; ok {
+			g := byRoot[find(t)]
+			g.order = append(g.order, id)
+		}
+	}
+	return groups
+}
+
+// runGroup applies the migrations of a group, stopping at the first failure and skipping the work left in the group
+func (app *migration) runGroup(migrator *migrate.Migration, env string, g *runGroup, ups map[int]*SQLMigration, downs map[int]*SQLMigration) []*RunResult {
+	results := make(map[string]*RunResult)
+	pending := make(map[string]int)
+	for _, t := range g.tables {
+		results[t] = &RunResult{Table: t, Status: RunSuccess}
+	}
+	for _, id := range g.order {
+		if sql, ok := downs[id]; ok && !sql.MigratedAtNull {
+			pending[sql.SourceTable]++
+		}
+		if sql, ok := ups[id]; ok && sql.MigratedAtNull {
+			pending[sql.SourceTable]++
+		}
+	}
+
+	apply := func(sql *SQLMigration, dir string) bool {
+		res := results[sql.SourceTable]
+		if res == nil {
+			return true
+		}
+		if (dir == "up") != sql.MigratedAtNull {
+			return true
+		}
+		logger := log.Log.WithField("component", sql.SourceTable)
+		logger.Info("applying migration ", sql.ID, " (", sql.File, ") ", dir)
+		start := time.Now()
+		var err error
+		if dir == "up" {
+			err = app.up(migrator, env, sql)
+		} else {
+			err = app.down(migrator, env, sql)
+		}
+		res.Duration += time.Since(start)
+		if err != nil {
+			logger.Error("migration ", sql.ID, " failed: ", err)
+			res.Status = RunFailed
+			res.Err = err
+			return false
+		}
+		res.Applied++
+		pending[sql.SourceTable]--
+		return true
+	}
+
+	ok := true
+	for i := len(g.order) - 1; i >= 0 && ok; i-- {
+		if sql, found := downs[g.order[i]]; found {
+			ok = apply(sql, "down")
+		}
+	}
+	for i := 0; i < len(g.order) && ok; i++ {
+		if sql, found := ups[g.order[i]]; found {
+			ok = apply(sql, "up")
+		}
+	}
+
+	var out []*RunResult
+	for _, t := range g.tables {
+		res := results[t]
+		if !ok && res.Status != RunFailed && pending[t] > 0 {
+			res.Status = RunSkipped
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+// newMigrator creates a migrator which runs under the context and statement timeout of the options
+func newMigrator(exec migrate.Executor, opts RunOptions) *migrate.Migration {
+	migrator := migrate.NewWithExecutor(exec)
+	if opts.Context != nil {
+		migrator.CTX = opts.Context
+	}
+	migrator.StatementTimeout = opts.StatementTimeout
+	return migrator
+}
+
+// checkModified refuses to roll back applied migrations which have been edited since, unless allowed. Only the
+// downs are checked as applied ups are skipped, an edit to one must not hold back the pending migrations
+func checkModified(migrations []*SQLMigration, opts RunOptions) error {
+	if opts.AllowModified {
+		return nil
+	}
+	for _, sql := range migrations {
+		if !sql.MigratedAtNull && sql.Modified {
+			return fmt.Errorf("migration %d (%s) has been modified since it was applied, use --allow-modified to roll it back", sql.ID, sql.File)
+		}
+	}
+	return nil
+}
+
+// up applies a migration if it has not been applied yet
+func (app *migration) up(migrator *migrate.Migration, env string, sql *SQLMigration) error {
+	log.Debug("migration up id ", sql.ID, sql.MigratedAtNull)
+	if !sql.MigratedAtNull {
+		log.Debug("migration ", sql.ID, " already up")
+		return nil
+	}
+	entry := app.logEntry(sql, "up")
+	err := migrator.Apply(sql.Script, "up", entry)
+	if err != nil {
+		return err
+	}
+	// the checksum of the script which ran is recorded, the file in git may have changed since it was fetched
+	err = app.Update(env, sql.SourceTable, sql.ID, time.Now(), false, entry.Checksum)
+	if err != nil {
+		return err
+	}
+	// a failed snapshot must not fail a migration which has already been applied
+	schema, err := migrator.Introspect(sql.SourceTable)
+	if err != nil {
+		log.Error("unable to capture schema for migration ", sql.ID, " ", err)
+		return nil
+	}
+	err = app.AddSchema(sql.ID, schema)
+	if err != nil {
+		log.Error("unable to upload schema for migration ", sql.ID, " ", err)
+	}
+	return nil
+}
+
+func (app *migration) Drift(exec migrate.Executor, env string, tables []string) ([]*SQLMigrationDrift, error) {
+	migrator := migrate.NewWithExecutor(exec)
+
+	var out []*SQLMigrationDrift
+	for _, table := range tables {
+		migrations, err := app.Get(env, table)
+		if err != nil {
+			return nil, err
+		}
+		var latest *SQLMigration
+		for _, sql := range append(append([]*SQLMigration{}, migrations.MigrationsUp...), migrations.MigrationsDown...) {
+			if !sql.MigratedAtNull && (latest == nil || sql.FileOrder > latest.FileOrder) {
+				latest = sql
 			}
 		}
+		if latest == nil {
+			continue
+		}
+		drift := SQLMigrationDrift{Table: table, SQLMigrationID: latest.ID, FileOrder: latest.FileOrder}
+
+		schemas, err := app.Schemas(env, table)
+		if err != nil {
+			return nil, err
+		}
+		var recorded *SQLMigrationSchema
+		for _, s := range schemas {
+			if s.SQLMigrationID == latest.ID {
+				recorded = s
+			}
+		}
+		if recorded != nil {
+			live, err := migrator.Introspect(table)
+			if err != nil {
+				return nil, err
+			}
+			drift.Recorded = true
+			drift.Changes = migrate.DiffSchema(&recorded.Schema, live)
+		}
+		out = append(out, &drift)
+	}
+	return out, nil
+}
+
+func (app *migration) AddSchema(migrationID int, schema *migrate.Schema) error {
+	payload, err := json.Marshal(struct {
+		SQLMigrationID int             `json:"sql_migration_id"`
+		Schema         *migrate.Schema `json:"schema"`
+	}{migrationID, schema})
+	if err != nil {
+		return err
+	}
+	url := "/" + SchemaMigration
+	_, err = app.makeRequest(url, payload, http.MethodPost)
+	if err != nil {
+		return err
 	}
 	return nil
 }
 
+func (app *migration) Schemas(env string, table string) ([]*SQLMigrationSchema, error) {
+	url := "/" + SchemaMigration + "?" + url.Values{"env": {env}, "table": {table}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	var schemas []*SQLMigrationSchema
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "schemas").String()), &schemas)
+	if err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
+
+// down rolls back a migration if it has been applied
+func (app *migration) down(migrator *migrate.Migration, env string, sql *SQLMigration) error {
+	log.Debug("migration down id", sql.ID, sql.MigratedAtNull)
+	if sql.MigratedAtNull {
+		log.Debug("migration ", sql.ID, " is already down")
+		return nil
+	}
+	err := migrator.Apply(sql.Script, "down", app.logEntry(sql, "down"))
+	if err != nil {
+		return err
+	}
+	return app.Update(env, sql.SourceTable, sql.ID, time.Now(), true, "")
+}
+
+// logEntry is the record of a migration run written to the target database
+func (app *migration) logEntry(sql *SQLMigration, dir string) *migrate.LogEntry {
+	return &migrate.LogEntry{
+		FileID:    sql.FileID,
+		Checksum:  utils.SHA256Hex(sql.Script),
+		Direction: dir,
+		AppliedAt: time.Now().UTC(),
+		AppliedBy: app.User,
+	}
+}
+
+func (app *migration) Status(exec migrate.Executor, env string, table string) ([]*SQLMigrationStatus, error) {
+	// status only reads the target database, a missing log is reported rather than created
+	migrator := migrate.NewWithExecutor(exec)
+	hasLog, err := migrator.HasLog()
+	if err != nil {
+		return nil, err
+	}
+	if !hasLog {
+		return nil, migrate.ErrNoLog
+	}
+	entries, err := migrator.LatestLog()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := app.Get(env, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*SQLMigrationStatus
+	for _, sql := range append(migrations.MigrationsUp, migrations.MigrationsDown...) {
+		status := SQLMigrationStatus{
+			ID:            sql.ID,
+			File:          sql.File,
+			FileOrder:     sql.FileOrder,
+			ServerApplied: !sql.MigratedAtNull,
+		}
+		if entry, ok := entries[sql.FileID]; ok {
+			status.TargetApplied = entry.Direction == "up"
+			status.AppliedAt = &entry.AppliedAt
+			status.AppliedBy = entry.AppliedBy
+		}
+		status.Drift = status.ServerApplied != status.TargetApplied
+		out = append(out, &status)
+	}
+	return out, nil
+}
 
 // MigrationTablesToTable returns a text table of all migrations for an env
 func MigrationTablesToTable(mit []*MigrationTable) {
@@ -308,15 +1000,150 @@ func MigrationTablesToTable(mit []*MigrationTable) {
 func MigrationsToTable(mit SQLMigrationStrategy) {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"#", "Dir", "ID", "File", "File Order", "Migrated At"})
+	t.AppendHeader(table.Row{"#", "Dir", "ID", "File", "File Order", "Migrated At", "Checksum"})
 	if mit.MigrationsUp != nil {
 		for i, k := range mit.MigrationsUp {
-			t.AppendRow(table.Row{i, "UP", k.ID, k.File, k.FileOrder, k.MigratedAt})
+			t.AppendRow(table.Row{i, "UP", k.ID, k.File, k.FileOrder, k.MigratedAt, checksumText(k)})
 		}
 	}
 	if mit.MigrationsDown != nil {
 		for i, k := range mit.MigrationsDown {
-			t.AppendRow(table.Row{i, "DOWN", k.ID, k.File, k.FileOrder, k.MigratedAt})
+			t.AppendRow(table.Row{i, "DOWN", k.ID, k.File, k.FileOrder, k.MigratedAt, checksumText(k)})
+		}
+	}
+	t.Render()
+}
+
+// checksumText describes whether a migration's script has been edited after it was added or applied
+func checksumText(mig *SQLMigration) string {
+	if mig.Modified {
+		return text.FgRed.Sprint("modified since applied")
+	}
+	if mig.Changed {
+		return text.FgYellow.Sprint("changed since added")
+	}
+	return "ok"
+}
+
+
+// MigrationStatusToTable returns a text table comparing the server and target database migration state
+func MigrationStatusToTable(mis []*SQLMigrationStatus) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "ID", "File", "File Order", "Server", "Target", "Logged At", "Logged By", "Status"})
+	for i, k := range mis {
+		status := "OK"
+		if k.Drift {
+			status = text.FgRed.Sprint("DRIFT")
+		}
+		t.AppendRow(table.Row{i, k.ID, k.File, k.FileOrder, appliedText(k.ServerApplied), appliedText(k.TargetApplied), k.AppliedAt, k.AppliedBy, status})
+	}
+	t.Render()
+}
+
+func appliedText(applied bool) string {
+	if applied {
+		return "applied"
+	}
+	return "pending"
+}
+
+// RunResultsToTable returns a text table summarising a run of every table in an env
+func RunResultsToTable(results []*RunResult) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "Table", "Status", "Applied", "Duration", "Error"})
+	counts := make(map[string]int)
+	for i, r := range results {
+		errMsg := ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		counts[r.Status]++
+		t.AppendRow(table.Row{i, r.Table, r.Status, r.Applied, r.Duration.Round(time.Millisecond), errMsg})
+	}
+	t.AppendFooter(table.Row{"", "", fmt.Sprintf("%d %s, %d %s, %d %s", counts[RunSuccess], RunSuccess, counts[RunFailed], RunFailed, counts[RunSkipped], RunSkipped)})
+	t.Render()
+}
+
+// MigrationDAGToTable returns a text table of the migrations for an env in the order they are applied
+func MigrationDAGToTable(dag SQLMigrationDAG) {
+	nodes := make(map[int]*SQLMigration)
+	for _, n := range dag.Nodes {
+		nodes[n.ID] = n
+	}
+	dependsOn := make(map[int][]string)
+	for _, e := range dag.Edges {
+		if dep, ok := nodes[e.DependsOnID]; ok && !e.Implicit {
+			dependsOn[e.SQLMigrationID] = append(dependsOn[e.SQLMigrationID], fmt.Sprintf("%s:%d", dep.SourceTable, dep.FileOrder))
+		}
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "ID", "Table", "File", "File Order", "Depends On", "Migrated At"})
+	for i, id := range dag.Order {
+		k := nodes[id]
+		t.AppendRow(table.Row{i, k.ID, k.SourceTable, k.File, k.FileOrder, strings.Join(dependsOn[id], ", "), k.MigratedAt})
+	}
+	t.Render()
+}
+
+// MigrationHistoryToTable returns a text table of the changes to the latest migration
+func MigrationHistoryToTable(hist []*SQLMigrationsLatestHistory) {
+	pointer := func(id *int) string {
+		if id == nil {
+			return "base"
+		}
+		return strconv.Itoa(*id)
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Changed At", "From", "To", "Changed By", "Reason"})
+	for _, h := range hist {
+		t.AppendRow(table.Row{h.ChangedAt, pointer(h.OldSQLMigrationsID), pointer(h.NewSQLMigrationsID), h.ChangedBy, h.Reason})
+	}
+	t.Render()
+}
+
+// MigrationSchemaToTable returns a text table of the columns and indexes of a schema snapshot
+func MigrationSchemaToTable(schema SQLMigrationSchema) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(fmt.Sprintf("%s after migration %d (order %d)", schema.SourceTable, schema.SQLMigrationID, schema.FileOrder))
+	t.AppendHeader(table.Row{"Column", "Type", "Nullable"})
+	for _, c := range schema.Schema.Columns {
+		t.AppendRow(table.Row{c.Name, c.Type, c.Nullable})
+	}
+	t.Render()
+	if len(schema.Schema.Indexes) == 0 {
+		return
+	}
+	i := table.NewWriter()
+	i.SetOutputMirror(os.Stdout)
+	i.AppendHeader(table.Row{"Index", "Definition"})
+	for _, k := range schema.Schema.Indexes {
+		i.AppendRow(table.Row{k.Name, k.Definition})
+	}
+	i.Render()
+}
+
+// MigrationDiffToTable returns a text table of the differences between two envs
+func MigrationDiffToTable(diff SQLMigrationDiff) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Table", "File", "File Order", "Difference"})
+	for _, d := range diff.Tables {
+		for _, k := range d.MissingInTarget {
+			t.AppendRow(table.Row{d.Table, k.File, k.FileOrder, "not registered in " + diff.Target})
+		}
+		for _, k := range d.MissingInSource {
+			t.AppendRow(table.Row{d.Table, k.File, k.FileOrder, "not registered in " + diff.Source})
+		}
+		for _, k := range d.NotAppliedInTarget {
+			t.AppendRow(table.Row{d.Table, k.File, k.FileOrder, "not applied in " + diff.Target})
+		}
+		for _, k := range d.NotAppliedInSource {
+			t.AppendRow(table.Row{d.Table, k.File, k.FileOrder, "not applied in " + diff.Source})
 		}
 	}
 	t.Render()
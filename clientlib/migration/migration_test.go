@@ -0,0 +1,486 @@
+package migation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-jamie/sql-manager/clientlib/log"
+	"github.com/c-jamie/sql-manager/clientlib/migrate"
+	"github.com/c-jamie/sql-manager/clientlib/utils"
+)
+
+// fakeServer serves the migrations of an env and records the updates made to them
+type fakeServer struct {
+	mu         sync.Mutex
+	strategies []*SQLMigrationStrategy
+	dag        SQLMigrationDAG
+	schemas    []*SQLMigrationSchema
+	updates    []int
+	checksums  []string
+}
+
+func (fs *fakeServer) strategy(table string) *SQLMigrationStrategy {
+	for _, s := range fs.strategies {
+		if s.Table == table {
+			return s
+		}
+	}
+	return &SQLMigrationStrategy{Table: table}
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	query := r.URL.Query()
+	var out interface{}
+	switch {
+	case r.URL.Path == "/"+GetMigration && r.Method == http.MethodGet:
+		out = map[string]interface{}{"migrations": fs.strategy(query.Get("table"))}
+	case r.URL.Path == "/"+UpdateMigration && r.Method == http.MethodPatch:
+		var update struct {
+			ID       int    `json:"sql_migration_id"`
+			Checksum string `json:"checksum"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &update)
+		fs.updates = append(fs.updates, update.ID)
+		fs.checksums = append(fs.checksums, update.Checksum)
+		out = map[string]interface{}{"migrations": update}
+	case r.URL.Path == "/"+ListMigration:
+		// pages the migrations of a table two at a time whatever page size is asked for
+		st := fs.strategy(query.Get("table"))
+		migs := append(append([]*SQLMigration{}, st.MigrationsDown...), st.MigrationsUp...)
+		page, _ := strconv.Atoi(query.Get("page"))
+		from, to := (page-1)*2, page*2
+		if to > len(migs) {
+			to = len(migs)
+		}
+		out = map[string]interface{}{"migrations": migs[from:to], "metadata": map[string]int{"current_page": page, "last_page": (len(migs) + 1) / 2}}
+	case r.URL.Path == "/"+AllMigration:
+		out = map[string]interface{}{"migrations": fs.strategies}
+	case r.URL.Path == "/"+DAGMigration:
+		out = map[string]interface{}{"dag": fs.dag}
+	case r.URL.Path == "/"+SchemaMigration && r.Method == http.MethodGet:
+		out = map[string]interface{}{"schemas": fs.schemas}
+	case r.URL.Path == "/"+SchemaMigration:
+		out = map[string]interface{}{"schema": nil}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func setupSQLite(t *testing.T) migrate.Executor {
+	log.InitLog("info")
+	exec, err := migrate.NewSQLExecutor("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { exec.Close() })
+	return exec
+}
+
+func newMigration(id int, table string, order int, script string, applied bool) *SQLMigration {
+	checksum := utils.SHA256Hex(script)
+	return &SQLMigration{
+		ID:             id,
+		Env:            "dev",
+		FileID:         table + "-" + script,
+		File:           table + ".sql",
+		FileOrder:      order,
+		SourceTable:    table,
+		MigratedAtNull: !applied,
+		Script:         script,
+		Checksum:       &checksum,
+	}
+}
+
+func TestStatus(t *testing.T) {
+	exec := setupSQLite(t)
+	applied := newMigration(1, "orders", 1, "-- +migrate Up\ncreate table orders (id integer primary key);\n-- +migrate Down\ndrop table orders;\n", true)
+	logged := newMigration(2, "orders", 2, "-- +migrate Up\ncreate index ix_orders on orders (id);\n-- +migrate Down\ndrop index ix_orders;\n", false)
+	pending := newMigration(3, "orders", 3, "-- +migrate Up\nalter table orders add column name text;\n", false)
+	fs := &fakeServer{strategies: []*SQLMigrationStrategy{{Table: "orders", Env: "dev", MigrationsUp: []*SQLMigration{logged, pending}, MigrationsDown: []*SQLMigration{applied}}}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	migrator := migrate.NewWithExecutor(exec)
+	err := migrator.InitLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []*SQLMigration{applied, logged} {
+		err = migrator.Log(&migrate.LogEntry{FileID: sql.FileID, Direction: "up", AppliedAt: time.Now().UTC(), AppliedBy: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := New(server.URL, "test").Status(exec, "dev", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		id            int
+		serverApplied bool
+		targetApplied bool
+		drift         bool
+	}{
+		{2, false, true, true},
+		{3, false, false, false},
+		{1, true, true, false},
+	}
+	if len(status) != len(testcases) {
+		t.Fatalf(" error status %v", status)
+	}
+	for i, tcase := range testcases {
+		s := status[i]
+		if s.ID != tcase.id || s.ServerApplied != tcase.serverApplied || s.TargetApplied != tcase.targetApplied || s.Drift != tcase.drift {
+			t.Errorf(" error status %d %+v", tcase.id, s)
+		}
+	}
+	if status[0].AppliedBy != "test" || status[0].AppliedAt == nil || status[1].AppliedAt != nil {
+		t.Errorf(" error status applied %+v %+v", status[0], status[1])
+	}
+}
+
+func TestStatusNoLog(t *testing.T) {
+	exec := setupSQLite(t)
+	fs := &fakeServer{strategies: []*SQLMigrationStrategy{{Table: "orders", Env: "dev", MigrationsUp: []*SQLMigration{newMigration(1, "orders", 1, "select 1", false)}}}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	_, err := New(server.URL, "test").Status(exec, "dev", "orders")
+	if !errors.Is(err, migrate.ErrNoLog) {
+		t.Fatalf(" error status %v", err)
+	}
+	hasLog, err := migrate.NewWithExecutor(exec).HasLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasLog {
+		t.Errorf(" error status created the migration log")
+	}
+}
+
+func TestList(t *testing.T) {
+	log.InitLog("info")
+	var migs []*SQLMigration
+	for i := 1; i <= 5; i++ {
+		migs = append(migs, newMigration(i, "db.sch tb&1", i, fmt.Sprintf("select %d", i), false))
+	}
+	fs := &fakeServer{strategies: []*SQLMigrationStrategy{{Table: "db.sch tb&1", Env: "dev", MigrationsUp: migs}}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	out, err := New(server.URL, "test").List("dev", "db.sch tb&1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(migs) {
+		t.Fatalf(" error list %d", len(out))
+	}
+	for i, mig := range out {
+		if mig.ID != i+1 {
+			t.Errorf(" error list order %d %d", i, mig.ID)
+		}
+	}
+}
+
+func TestGetEscapesQuery(t *testing.T) {
+	log.InitLog("info")
+	table := `db.sch "tb"&env=prod#1`
+	fs := &fakeServer{strategies: []*SQLMigrationStrategy{{Table: table, Env: "dev", MigrationsUp: []*SQLMigration{newMigration(1, table, 1, "select 1", false)}}}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	out, err := New(server.URL, "test").Get("dev", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Table != table || len(out.MigrationsUp) != 1 {
+		t.Errorf(" error get %+v", out)
+	}
+}
+
+func TestRunLogsInTransaction(t *testing.T) {
+	exec := setupSQLite(t)
+	good := newMigration(1, "orders", 1, "-- +migrate Up\ncreate table orders (id integer primary key);\n", false)
+	bad := newMigration(2, "orders", 2, "-- +migrate Up\ninsert into missing values (1);\n", false)
+	fs := &fakeServer{strategies: []*SQLMigrationStrategy{{Table: "orders", Env: "dev", MigrationsUp: []*SQLMigration{good, bad}}}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	err := New(server.URL, "test").Run(exec, "dev", "orders", RunOptions{})
+	if err == nil {
+		t.Fatal("expected the second migration to fail")
+	}
+	entries, err := migrate.NewWithExecutor(exec).LatestLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[good.FileID] == nil {
+		t.Errorf(" error log %v", entries)
+	}
+	if len(fs.updates) != 1 || fs.updates[0] != good.ID {
+		t.Errorf(" error updates %v", fs.updates)
+	}
+	if len(fs.checksums) != 1 || fs.checksums[0] != utils.SHA256Hex(good.Script) {
+		t.Errorf(" error the checksum of the script which ran was not sent %v", fs.checksums)
+	}
+}
+
+func TestRunModified(t *testing.T) {
+	testcases := []struct {
+		name          string
+		allowModified bool
+		downModified  bool
+		upModified    bool
+		err           bool
+		updates       []int
+	}{
+		{"refuse down", false, true, false, true, nil},
+		// an applied up is not run again, so an edit to it does not hold back the pending migration
+		{"applied up", false, false, true, false, []int{2, 3}},
+		{"allow", true, true, true, false, []int{2, 3}},
+		{"unmodified", false, false, false, false, []int{2, 3}},
+	}
+	for _, tcase := range testcases {
+		exec := setupSQLite(t)
+		applied := newMigration(1, "orders", 1, "-- +migrate Up\ncreate table orders (id integer primary key);\n", true)
+		applied.Modified = tcase.upModified
+		rolledBack := newMigration(2, "orders", 2, "-- +migrate Up\ncreate table items (id integer primary key);\n-- +migrate Down\ndrop table items;\n", true)
+		rolledBack.Modified = tcase.downModified
+		pending := newMigration(3, "orders", 3, "-- +migrate Up\ncreate table customers (id integer primary key);\n", false)
+		fs := &fakeServer{strategies: []*SQLMigrationStrategy{{Table: "orders", Env: "dev", MigrationsUp: []*SQLMigration{applied, pending}, MigrationsDown: []*SQLMigration{rolledBack}}}}
+		server := httptest.NewServer(fs)
+
+		err := exec.Exec(context.Background(), "create table items (id integer primary key)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = New(server.URL, "test").Run(exec, "dev", "orders", RunOptions{AllowModified: tcase.allowModified})
+		server.Close()
+		if tcase.err {
+			if err == nil || !strings.Contains(err.Error(), "modified") {
+				t.Errorf(" error %s expected a modified error %v", tcase.name, err)
+			}
+		} else if err != nil {
+			t.Errorf(" error %s %v", tcase.name, err)
+		}
+		if fmt.Sprint(fs.updates) != fmt.Sprint(tcase.updates) {
+			t.Errorf(" error %s updates %v", tcase.name, fs.updates)
+		}
+	}
+}
+
+func TestDrift(t *testing.T) {
+	exec := setupSQLite(t)
+	migrator := migrate.NewWithExecutor(exec)
+	tables := []string{"orders", "items", "customers", "notes", "pending"}
+	fs := &fakeServer{}
+	for i, table := range tables {
+		script := "-- +migrate Up\ncreate table " + table + " (id integer primary key, name text);\n"
+		sql := newMigration(i+1, table, 1, script, table != "pending")
+		fs.strategies = append(fs.strategies, &SQLMigrationStrategy{Table: table, Env: "dev", MigrationsDown: []*SQLMigration{sql}})
+		err := migrator.Execute(script, "up")
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema, err := migrator.Introspect(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if table != "notes" {
+			fs.schemas = append(fs.schemas, &SQLMigrationSchema{SQLMigrationID: sql.ID, SourceTable: table, Schema: *schema})
+		}
+	}
+	for _, statement := range []string{"alter table items add column price real", "drop table customers"} {
+		err := exec.Exec(context.Background(), statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	drifts, err := New(server.URL, "test").Drift(exec, "dev", tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		table    string
+		recorded bool
+		changes  []string
+	}{
+		{"orders", true, nil},
+		{"items", true, []string{"+ column price real null"}},
+		{"customers", true, []string{"- column id integer not null", "- column name text null"}},
+		{"notes", false, nil},
+	}
+	if len(drifts) != len(testcases) {
+		t.Fatalf(" error drift %+v", drifts)
+	}
+	for i, tcase := range testcases {
+		d := drifts[i]
+		if d.Table != tcase.table || d.Recorded != tcase.recorded || fmt.Sprint(d.Changes) != fmt.Sprint(tcase.changes) {
+			t.Errorf(" error drift %s %+v", tcase.table, d)
+		}
+	}
+}
+
+// recordingExecutor records the statements run through it, in the order they are run
+type recordingExecutor struct {
+	migrate.Executor
+	mu         sync.Mutex
+	statements []string
+}
+
+func (ex *recordingExecutor) record(query string) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.statements = append(ex.statements, strings.TrimSpace(query))
+}
+
+func (ex *recordingExecutor) Exec(ctx context.Context, query string, args ...interface{}) error {
+	ex.record(query)
+	return ex.Executor.Exec(ctx, query, args...)
+}
+
+func (ex *recordingExecutor) Begin(ctx context.Context) (migrate.Tx, error) {
+	tx, err := ex.Executor.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingTx{Tx: tx, ex: ex}, nil
+}
+
+type recordingTx struct {
+	migrate.Tx
+	ex *recordingExecutor
+}
+
+func (tx *recordingTx) Exec(ctx context.Context, query string, args ...interface{}) error {
+	tx.ex.record(query)
+	return tx.Tx.Exec(ctx, query, args...)
+}
+
+func (ex *recordingExecutor) index(statement string) int {
+	for i, s := range ex.statements {
+		if strings.HasPrefix(s, statement) {
+			return i
+		}
+	}
+	return -1
+}
+
+// runAllServer serves orders and customers, linked by a dependency, and items and notes which stand alone
+func runAllServer(customers string) *fakeServer {
+	orders := newMigration(1, "orders", 1, "-- +migrate Up\ncreate table orders (id integer primary key);\n", false)
+	fk := newMigration(2, "orders", 2, "-- +migrate Up\ncreate table order_customers (id integer primary key);\n", false)
+	cust := newMigration(3, "customers", 1, "-- +migrate Up\n"+customers+"\n", false)
+	items := newMigration(4, "items", 1, "-- +migrate Up\ncreate table items (id integer primary key);\n", false)
+	notes := newMigration(5, "notes", 1, "-- +migrate Up\ncreate table notes (id integer primary key);\n", false)
+	return &fakeServer{
+		strategies: []*SQLMigrationStrategy{
+			{Table: "orders", Env: "dev", MigrationsUp: []*SQLMigration{orders, fk}},
+			{Table: "customers", Env: "dev", MigrationsUp: []*SQLMigration{cust}},
+			{Table: "items", Env: "dev", MigrationsUp: []*SQLMigration{items}},
+			{Table: "notes", Env: "dev", MigrationsUp: []*SQLMigration{notes}},
+		},
+		dag: SQLMigrationDAG{
+			Env:   "dev",
+			Nodes: []*SQLMigration{orders, fk, cust, items, notes},
+			Edges: []*SQLMigrationDependency{
+				{SQLMigrationID: 2, DependsOnID: 1, Implicit: true},
+				{SQLMigrationID: 2, DependsOnID: 3},
+			},
+			Order: []int{3, 4, 5, 1, 2},
+		},
+	}
+}
+
+func TestRunGroups(t *testing.T) {
+	fs := runAllServer("create table customers (id integer primary key);")
+	tableOf := make(map[int]string)
+	for _, s := range fs.strategies {
+		for _, m := range s.MigrationsUp {
+			tableOf[m.ID] = s.Table
+		}
+	}
+	groups := runGroups(fs.strategies, &fs.dag, tableOf)
+	var out []string
+	for _, g := range groups {
+		out = append(out, fmt.Sprint(g.tables, g.order))
+	}
+	expect := []string{"[orders customers] [3 1 2]", "[items] [4]", "[notes] [5]"}
+	if fmt.Sprint(out) != fmt.Sprint(expect) {
+		t.Errorf(" error run groups %v", out)
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	testcases := []struct {
+		name      string
+		customers string
+		parallel  int
+		status    map[string]string
+		applied   map[string]int
+	}{
+		{
+			name:      "success",
+			customers: "create table customers (id integer primary key);",
+			parallel:  2,
+			status:    map[string]string{"customers": RunSuccess, "items": RunSuccess, "notes": RunSuccess, "orders": RunSuccess},
+			applied:   map[string]int{"customers": 1, "items": 1, "notes": 1, "orders": 2},
+		},
+		{
+			// orders waits on customers, the independent tables are still applied
+			name:      "failed group",
+			customers: "insert into missing values (1);",
+			parallel:  1,
+			status:    map[string]string{"customers": RunFailed, "items": RunSuccess, "notes": RunSuccess, "orders": RunSkipped},
+			applied:   map[string]int{"customers": 0, "items": 1, "notes": 1, "orders": 0},
+		},
+	}
+	for _, tcase := range testcases {
+		exec := &recordingExecutor{Executor: setupSQLite(t)}
+		fs := runAllServer(tcase.customers)
+		server := httptest.NewServer(fs)
+		results, err := New(server.URL, "test").RunAll(exec, "dev", RunOptions{Parallel: tcase.parallel})
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != len(tcase.status) {
+			t.Fatalf(" error %s results %+v", tcase.name, results)
+		}
+		for _, res := range results {
+			if res.Status != tcase.status[res.Table] || res.Applied != tcase.applied[res.Table] {
+				t.Errorf(" error %s result %+v", tcase.name, res)
+			}
+			if (res.Status == RunFailed) != (res.Err != nil) {
+				t.Errorf(" error %s result error %+v", tcase.name, res)
+			}
+		}
+		if tcase.status["orders"] == RunSuccess && exec.index("create table customers") > exec.index("create table order_customers") {
+			t.Errorf(" error %s orders applied before the customers it depends on %v", tcase.name, exec.statements)
+		}
+		if tcase.status["orders"] == RunSkipped && exec.index("create table orders") != -1 {
+			t.Errorf(" error %s skipped group was applied %v", tcase.name, exec.statements)
+		}
+	}
+}
@@ -3,13 +3,14 @@ package mocks
 import (
 	"time"
 
+	"github.com/c-jamie/sql-manager/clientlib/migrate"
 	mig "github.com/c-jamie/sql-manager/clientlib/migration"
 )
 
 type Migration struct {
 }
 
-func (app *Migration) Add(file string, env string, table string) error {
+func (app *Migration) Add(file string, env string, table string, dependsOn []*mig.SQLMigrationDependencyRef) error {
 	return nil
 }
 func (app *Migration) Get(env string, table string) (*mig.SQLMigrationStrategy, error) {
@@ -18,13 +19,16 @@ func (app *Migration) Get(env string, table string) (*mig.SQLMigrationStrategy,
 func (app *Migration) ListTables(env string) ([]*mig.MigrationTable, error) {
 	return nil, nil
 }
+func (app *Migration) List(env string, table string, status string) ([]*mig.SQLMigration, error) {
+	return nil, nil
+}
 func (app *Migration) Delete(env string, table string, migrationID int) error {
 	return nil
 }
-func (app *Migration) Update(env string, table string, migrationID int, timeStamp time.Time, timeStampNull bool) error {
+func (app *Migration) Update(env string, table string, migrationID int, timeStamp time.Time, timeStampNull bool, checksum string) error {
 	return nil
 }
-func (app *Migration) Set(env string, table string, migrationID int) error {
+func (app *Migration) Set(env string, table string, migrationID int, reason string) error {
 	return nil
 }
 func (app *Migration) GetAll(env string) ([]*mig.SQLMigrationStrategy, error) {
@@ -33,6 +37,39 @@ func (app *Migration) GetAll(env string) ([]*mig.SQLMigrationStrategy, error) {
 
 	return strategy, nil
 }
-func (app *Migration) Run(driver string, connection string, env string, table string) error {
+func (app *Migration) Run(exec migrate.Executor, env string, table string, opts mig.RunOptions) error {
+	return nil
+}
+func (app *Migration) Status(exec migrate.Executor, env string, table string) ([]*mig.SQLMigrationStatus, error) {
+	return nil, nil
+}
+func (app *Migration) DAG(env string) (*mig.SQLMigrationDAG, error) {
+	return nil, nil
+}
+func (app *Migration) RunAll(exec migrate.Executor, env string, opts mig.RunOptions) ([]*mig.RunResult, error) {
+	return nil, nil
+}
+func (app *Migration) Diff(source string, target string) (*mig.SQLMigrationDiff, error) {
+	return nil, nil
+}
+func (app *Migration) Promote(source string, target string, table string, requireApplied bool) ([]*mig.SQLMigration, error) {
+	return nil, nil
+}
+func (app *Migration) Sync(dir string, env string, table string) (*mig.SQLMigrationSync, error) {
+	return nil, nil
+}
+func (app *Migration) History(env string, table string) ([]*mig.SQLMigrationsLatestHistory, error) {
+	return nil, nil
+}
+func (app *Migration) Undo(env string, table string, reason string) error {
 	return nil
 }
+func (app *Migration) AddSchema(migrationID int, schema *migrate.Schema) error {
+	return nil
+}
+func (app *Migration) Schemas(env string, table string) ([]*mig.SQLMigrationSchema, error) {
+	return nil, nil
+}
+func (app *Migration) Drift(exec migrate.Executor, env string, tables []string) ([]*mig.SQLMigrationDrift, error) {
+	return nil, nil
+}
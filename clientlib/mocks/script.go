@@ -36,7 +36,35 @@ func (app *Script) Get(name string) (string, error) {
 	}
 }
 
+func (app *Script) GetAt(name string, ref string) (*scr.FileAt, error) {
+	sql, err := app.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &scr.FileAt{Script: sql, Commit: "0123456789abcdef0123456789abcdef01234567"}, nil
+}
+
 func (app *Script) Register(file string) error {
 	return nil
 
 }
+
+func (app *Script) Remove(name string) error {
+	return nil
+}
+
+func (app *Script) Move(name string, file string, project string) error {
+	return nil
+}
+
+func (app *Script) Sync() (*scr.ScriptSync, error) {
+	return &scr.ScriptSync{}, nil
+}
+
+func (app *Script) History(name string) ([]*scr.Commit, error) {
+	return nil, nil
+}
+
+func (app *Script) Diff(name string, from string, to string) (string, error) {
+	return "", nil
+}
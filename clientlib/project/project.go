@@ -0,0 +1,188 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/c-jamie/sql-manager/clientlib/request"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/tidwall/gjson"
+)
+
+// ProjectInfo represents a project which groups SQL scripts
+type ProjectInfo struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	GitRepo     string     `json:"git_repo"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+// Project represents the interface for managing projects
+type Project interface {
+	// Create creates a new project, bound to a git repo or to the server's default repo when gitRepo is empty
+	Create(name string, description string, gitRepo string) (*ProjectInfo, error)
+	// List returns every project which has not been deleted
+	List() ([]*ProjectInfo, error)
+	// Rename renames a project
+	Rename(name string, newName string) (*ProjectInfo, error)
+	// Describe sets the description of a project
+	Describe(name string, description string) (*ProjectInfo, error)
+	// Bind binds a project to a git repo, an empty gitRepo binds it to the server's default repo
+	Bind(name string, gitRepo string) (*ProjectInfo, error)
+	// Delete soft deletes a project
+	Delete(name string) error
+}
+
+type project struct {
+	BaseURL string
+}
+
+const (
+	Projects     = "projects"
+	ListProjects = "projects/list"
+	// listPageSize is the number of projects fetched per request
+	listPageSize = 100
+)
+
+// New creates a new project object
+func New(url string) Project {
+	return &project{BaseURL: url}
+}
+
+func (app *project) makeRequest(url string, payload []byte, how string) ([]byte, error) {
+	client := request.Client{BaseURL: app.BaseURL}
+	var body []byte
+	var resp *http.Response
+	var err error
+	if how == http.MethodGet {
+		body, resp, err = client.GetReq(url, payload, true)
+	} else {
+		body, resp, err = client.PostReq(url, payload, true, how)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to make request %s", string(body))
+	}
+	return body, nil
+}
+
+func (app *project) Create(name string, description string, gitRepo string) (*ProjectInfo, error) {
+	payload, err := json.Marshal(struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		GitRepo     string `json:"git_repo"`
+	}{name, description, gitRepo})
+	if err != nil {
+		return nil, err
+	}
+	body, err := app.makeRequest("/"+Projects, payload, http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalProject(body)
+}
+
+func (app *project) List() ([]*ProjectInfo, error) {
+	// the server pages its projects, fetch every page
+	var out []*ProjectInfo
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("/%s?page=%d&page_size=%d", ListProjects, page, listPageSize)
+		body, err := app.makeRequest(url, nil, http.MethodGet)
+		if err != nil {
+			return nil, err
+		}
+		var projects []*ProjectInfo
+		err = json.Unmarshal([]byte(gjson.Get(string(body), "projects").String()), &projects)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list projects %w", err)
+		}
+		out = append(out, projects...)
+		if page >= int(gjson.Get(string(body), "metadata.last_page").Int()) {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (app *project) Rename(name string, newName string) (*ProjectInfo, error) {
+	payload, err := json.Marshal(struct {
+		Name    string `json:"name"`
+		NewName string `json:"new_name"`
+	}{name, newName})
+	if err != nil {
+		return nil, err
+	}
+	body, err := app.makeRequest("/"+Projects, payload, http.MethodPatch)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalProject(body)
+}
+
+func (app *project) Describe(name string, description string) (*ProjectInfo, error) {
+	payload, err := json.Marshal(struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}{name, description})
+	if err != nil {
+		return nil, err
+	}
+	body, err := app.makeRequest("/"+Projects, payload, http.MethodPatch)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalProject(body)
+}
+
+func (app *project) Bind(name string, gitRepo string) (*ProjectInfo, error) {
+	payload, err := json.Marshal(struct {
+		Name    string `json:"name"`
+		GitRepo string `json:"git_repo"`
+	}{name, gitRepo})
+	if err != nil {
+		return nil, err
+	}
+	body, err := app.makeRequest("/"+Projects, payload, http.MethodPatch)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalProject(body)
+}
+
+func (app *project) Delete(name string) error {
+	payload, err := json.Marshal(struct {
+		Name string `json:"name"`
+	}{name})
+	if err != nil {
+		return err
+	}
+	_, err = app.makeRequest("/"+Projects, payload, http.MethodDelete)
+	return err
+}
+
+func unmarshalProject(body []byte) (*ProjectInfo, error) {
+	var proj ProjectInfo
+	err := json.Unmarshal([]byte(gjson.Get(string(body), "project").String()), &proj)
+	if err != nil {
+		return nil, err
+	}
+	return &proj, nil
+}
+
+// ProjectsToTable prints a text table of projects
+func ProjectsToTable(projects []*ProjectInfo) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "ID", "Name", "Description", "Git Repo", "Created At"})
+	for i, p := range projects {
+		t.AppendRow(table.Row{i, p.ID, p.Name, p.Description, p.GitRepo, p.CreatedAt})
+	}
+	t.Render()
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/c-jamie/sql-manager/clientlib/request"
 	"github.com/jedib0t/go-pretty/table"
@@ -22,6 +26,28 @@ type FileList struct {
 	SnippitID    int64  `json:"snippit_id"`
 }
 
+// ScriptSync lists the file locations changed when the server discovers scripts in git
+type ScriptSync struct {
+	Added   []string `json:"added"`
+	Moved   []string `json:"moved"`
+	Removed []string `json:"removed"`
+}
+
+// Commit represents a git commit which touched a script
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// FileAt is a script as it was at a git commit. GitRepoID is the repo the commit belongs to, zero for the server's repo
+type FileAt struct {
+	Script    string
+	Commit    string
+	GitRepoID int64
+}
 
 // Script represents the interface for interacting with SQL Scripts
 type Script interface {
@@ -29,8 +55,20 @@ type Script interface {
 	List(project string) ([]*FileList, error)
 	// Get returns a script for a given name
 	Get(name string) (string, error)
+	// GetAt returns a script as it was at a git branch, tag or commit, along with the resolved commit SHA and its repo
+	GetAt(name string, ref string) (*FileAt, error)
 	// Register registers a script
 	Register(file string) error
+	// Remove deregisters a script
+	Remove(name string) error
+	// Move changes the file location and project of a script, empty values are left unchanged
+	Move(name string, file string, project string) error
+	// History returns the commits which touched a script, newest first
+	History(name string) ([]*Commit, error)
+	// Diff returns a unified diff of a script between two git refs, an empty from shows the latest change
+	Diff(name string, from string, to string) (string, error)
+	// Sync registers every script in git, following moved files and removing deleted ones
+	Sync() (*ScriptSync, error)
 }
 
 type script struct {
@@ -38,7 +76,11 @@ type script struct {
 }
 
 const (
-	File = "files"
+	File         = "files"
+	SyncFile     = "sync"
+	HistoryFile  = "files/history"
+	DiffFile     = "files/diff"
+	listPageSize = 100
 )
 
 
@@ -61,6 +103,14 @@ func (app *script) makeRequest(url string, payload []byte, how string) ([]byte,
 		if resp.StatusCode != http.StatusCreated {
 			return nil, fmt.Errorf("unable to make request %s", string(body))
 		}
+	} else if how == http.MethodPatch || how == http.MethodDelete {
+		body, resp, err = client.PostReq(url, payload, true, how)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unable to make request %s", string(body))
+		}
 	} else {
 		body, resp, err = client.GetReq(url, payload, true)
 		if err != nil {
@@ -75,7 +125,7 @@ func (app *script) makeRequest(url string, payload []byte, how string) ([]byte,
 }
 
 func (app *script) Get(name string) (string, error) {
-	url := "/" + File + "?name=" + name
+	url := "/" + File + "?" + url.Values{"name": {name}}.Encode()
 	body, err := app.makeRequest(url, nil, http.MethodGet)
 	if err != nil {
 		return "", err
@@ -84,6 +134,19 @@ func (app *script) Get(name string) (string, error) {
 	return fileRe, nil
 }
 
+func (app *script) GetAt(name string, ref string) (*FileAt, error) {
+	url := "/" + File + "?" + url.Values{"name": {name}, "ref": {ref}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAt{
+		Script:    gjson.Get(string(body), File+".script").String(),
+		Commit:    gjson.Get(string(body), "commit").String(),
+		GitRepoID: gjson.Get(string(body), "git_repo_id").Int(),
+	}, nil
+}
+
 func (app *script) List(project string) ([]*FileList, error) {
 	unmarshal := func(body []byte) ([]*FileList, error) {
 		var projInf []*FileList
@@ -94,30 +157,123 @@ func (app *script) List(project string) ([]*FileList, error) {
 			return projInf, nil
 		}
 	}
-	url := "/" + File + "/list?project=" + project
-	body, err := app.makeRequest(url, make([]byte, 0), http.MethodGet)
+	// the server pages its files, fetch every page
+	var out []*FileList
+	for page := 1; ; page++ {
+		qs := url.Values{"project": {project}, "page": {strconv.Itoa(page)}, "page_size": {strconv.Itoa(listPageSize)}}
+		url := "/" + File + "/list?" + qs.Encode()
+		body, err := app.makeRequest(url, make([]byte, 0), http.MethodGet)
+		if err != nil {
+			return nil, err
+		}
+		files := gjson.Get(string(body), "files").String()
+		proInf, err := unmarshal([]byte(files))
+		if err != nil {
+			return nil, fmt.Errorf("unable to list tables %w", err)
+		}
+		out = append(out, proInf...)
+		if page >= int(gjson.Get(string(body), "metadata.last_page").Int()) {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (app *script) Remove(name string) error {
+	payload, err := json.Marshal(struct {
+		Name string `json:"name"`
+	}{name})
+	if err != nil {
+		return err
+	}
+	_, err = app.makeRequest("/"+File, payload, http.MethodDelete)
+	return err
+}
+
+func (app *script) Move(name string, file string, project string) error {
+	input := map[string]string{"name": name}
+	if file != "" {
+		input["file"] = file
+	}
+	if project != "" {
+		input["project"] = project
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	_, err = app.makeRequest("/"+File, payload, http.MethodPatch)
+	return err
+}
+
+func (app *script) History(name string) ([]*Commit, error) {
+	url := "/" + HistoryFile + "?" + url.Values{"name": {name}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
 	if err != nil {
 		return nil, err
 	}
-	files := gjson.Get(string(body), "files").String()
-	proInf, err := unmarshal([]byte(files))
+	var commits []*Commit
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "history").String()), &commits)
 	if err != nil {
-		return nil, fmt.Errorf("unable to list tables %w", err)
-	} else {
-		return proInf, nil
+		return nil, err
+	}
+	return commits, nil
+}
+
+func (app *script) Diff(name string, from string, to string) (string, error) {
+	url := "/" + DiffFile + "?" + url.Values{"name": {name}, "from": {from}, "to": {to}}.Encode()
+	body, err := app.makeRequest(url, nil, http.MethodGet)
+	if err != nil {
+		return "", err
+	}
+	return gjson.Get(string(body), "diff").String(), nil
+}
+
+func (app *script) Sync() (*ScriptSync, error) {
+	body, err := app.makeRequest("/"+SyncFile, make([]byte, 0), http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+	var sync ScriptSync
+	err = json.Unmarshal([]byte(gjson.Get(string(body), "sync").String()), &sync)
+	if err != nil {
+		return nil, err
 	}
+	return &sync, nil
 }
 
 func (app *script) Register(file string) error {
+	payload, err := json.Marshal(struct {
+		File    string `json:"file"`
+		Project string `json:"project"`
+	}{file, filepath.Dir(file)})
+	if err != nil {
+		return err
+	}
 	url := "/" + File
-	var jsonStr = []byte(fmt.Sprintf(`{"file":"%s", "project":"%s"}`, file, filepath.Dir(file)))
-	_, err := app.makeRequest(url, jsonStr, http.MethodPost)
+	_, err = app.makeRequest(url, payload, http.MethodPost)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// CommitsToTable prints the history of a script
+func CommitsToTable(commits []*Commit) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Commit", "Author", "Date", "Message"})
+	for _, k := range commits {
+		message := strings.SplitN(strings.TrimSpace(k.Message), "\n", 2)[0]
+		sha := k.SHA
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		t.AppendRow(table.Row{sha, k.Author, k.Date.Format("2006-01-02 15:04"), message})
+	}
+	t.Render()
+}
+
 func ProjectInfoToTable(proj []*FileList) {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
@@ -128,3 +284,17 @@ func ProjectInfoToTable(proj []*FileList) {
 	t.Render()
 
 }
+
+// RowsToTable prints the rows returned by running a script
+func RowsToTable(rows [][]string) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	for _, r := range rows {
+		row := make(table.Row, len(r))
+		for i, v := range r {
+			row[i] = v
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+}
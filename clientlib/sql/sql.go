@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"text/template"
 
@@ -23,6 +24,13 @@ type SQLStack struct {
 
 type getter func(table string) (string, error)
 
+// MigrationState represents the applied state of a table's migrations in an env
+type MigrationState struct {
+	Latest  int
+	Applied []int
+	Pending []int
+}
+
 
 // SQLMngr represents the domain of a SQL scripts combined with any migrations for that table
 type SQLMngr struct {
@@ -147,24 +155,24 @@ func (sql *SQLMngr) mergeFragments() {
 		log.Debug("merge ", i)
 		stk := sql.stackPop()
 		nestedSQL, keywords := sql.parseDirectives(stk.Directives)
-		t := template.Must(template.New("sql").Parse(stk.SQL))
+		t := template.Must(sql.template().Parse(stk.SQL))
 		var out bytes.Buffer
 		insert := make(map[string]string)
 		if stk.Level != 0 {
-			if nestedSQL == nil {
-				t.Execute(&out, keywords)
-				insert[stk.SQuery.Key] = out.String()
-				context[stk.Level] = insert
-			} else {
-				t := template.Must(template.New("sql").Parse(stk.SQL))
+			if nestedSQL != nil {
 				log.Debug("stk.level", stk.Level)
 				for k, v := range context[stk.Level+1] {
 					keywords[k] = v
 				}
-				t.Execute(&out, keywords)
-				insert[stk.SQuery.Key] = out.String()
-				context[stk.Level] = insert
 			}
+			data, err := sql.templateContext(keywords)
+			if err != nil {
+				sql.Err = err
+				return
+			}
+			t.Execute(&out, data)
+			insert[stk.SQuery.Key] = out.String()
+			context[stk.Level] = insert
 		}
 	}
 	if len(sql.Stack) > 1 {
@@ -172,6 +180,63 @@ func (sql *SQLMngr) mergeFragments() {
 	}
 }
 
+// migrationStates returns the applied state of each table's migrations in the env
+func (sql *SQLMngr) migrationStates() map[string]*MigrationState {
+	states := make(map[string]*MigrationState)
+	for _, v := range sql.Migrations[sql.Env] {
+		state := &MigrationState{Applied: []int{}, Pending: []int{}}
+		for _, j := range append(append([]*sqlMig.SQLMigration{}, v.MigrationsUp...), v.MigrationsDown...) {
+			if j.MigratedAt != nil {
+				state.Applied = append(state.Applied, j.FileOrder)
+				if j.FileOrder > state.Latest {
+					state.Latest = j.FileOrder
+				}
+			}
+		}
+		for _, j := range v.MigrationsUp {
+			if j.MigratedAt == nil {
+				state.Pending = append(state.Pending, j.FileOrder)
+			}
+		}
+		sort.Ints(state.Applied)
+		sort.Ints(state.Pending)
+		states[v.Table] = state
+	}
+	return states
+}
+
+// templateContext returns the keywords of a script along with the applied state of the migrations in the env
+func (sql *SQLMngr) templateContext(keywords map[string]string) (map[string]interface{}, error) {
+	context := make(map[string]interface{})
+	for k, v := range keywords {
+		context[k] = v
+	}
+	if _, ok := context["migrations"]; ok {
+		return nil, fmt.Errorf("the keyword migrations is reserved for the applied state of migrations, rename it")
+	}
+	context["migrations"] = sql.migrationStates()
+	return context, nil
+}
+
+// template returns a new template with the SQL manager functions available
+func (sql *SQLMngr) template() *template.Template {
+	states := sql.migrationStates()
+	return template.New("sql").Funcs(template.FuncMap{
+		"migrationApplied": func(table string, order int) bool {
+			state, ok := states[table]
+			if !ok {
+				return false
+			}
+			for _, o := range state.Applied {
+				if o == order {
+					return true
+				}
+			}
+			return false
+		},
+	})
+}
+
 // finalise generates the final SQL script
 func (sql *SQLMngr) finalise() {
 	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
@@ -185,7 +250,7 @@ func (sql *SQLMngr) finalise() {
 		keywords = make(map[string]string)
 	}
 	log.Debug(sql.Root)
-	t := template.Must(template.New("sql").Parse(sql.Raw))
+	t := template.Must(sql.template().Parse(sql.Raw))
 	var out bytes.Buffer
 
 	_, topKey := sql.parseDirectives(sql.Directives)
@@ -197,15 +262,25 @@ func (sql *SQLMngr) finalise() {
 	for k, v := range sql.DirectiveKeyOverrides {
 		keywords[k] = v
 	}
+	// the legacy <table>_<order> keywords are "true" once a migration is applied and empty until then
 	if sql.Migrations[sql.Env] != nil {
 		for _, v := range sql.Migrations[sql.Env] {
-			for _, j := range v.MigrationsUp {
+			for _, j := range append(append([]*sqlMig.SQLMigration{}, v.MigrationsUp...), v.MigrationsDown...) {
 				table := reg.ReplaceAllString(j.SourceTable, "_") + "_" + strconv.Itoa(j.FileOrder)
-				keywords[table] = "true"
+				if j.MigratedAt != nil {
+					keywords[table] = "true"
+				} else {
+					keywords[table] = ""
+				}
 			}
 		}
 	}
-	t.Execute(&out, keywords)
+	context, err := sql.templateContext(keywords)
+	if err != nil {
+		sql.Err = err
+		return
+	}
+	t.Execute(&out, context)
 	sql.Parsed = out.String()
 }
 
@@ -215,6 +290,9 @@ func (sql *SQLMngr) Compile() string {
 	sql.parseRawDirectives()
 	sql.compileFragments(sql.Raw, 0, false, nil)
 	sql.mergeFragments()
+	if sql.Err != nil {
+		return ""
+	}
 	sql.finalise()
 	return sql.Parsed
 }
@@ -3,6 +3,7 @@ package sql
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/c-jamie/sql-manager/clientlib/app"
 	sqlMig "github.com/c-jamie/sql-manager/clientlib/migration"
@@ -33,7 +34,7 @@ func setupApp() *app.App {
 func TestSQLLoadFile(t *testing.T) {
 	setup()
 	app := setupApp()
-	app.Migration.Add("proj1/1_mig.sql", "dev", "a.b.c")
+	app.Migration.Add("proj1/1_mig.sql", "dev", "a.b.c", nil)
 	testcases := []struct {
 		sql string
 		env string
@@ -60,7 +61,7 @@ func TestSQLLoadFile(t *testing.T) {
 func TestSQLLoadServer(t *testing.T) {
 	setup()
 	app := setupApp()
-	err := app.Migration.Add("proj1/1_mig.sql", "dev", "a.b.c")
+	err := app.Migration.Add("proj1/1_mig.sql", "dev", "a.b.c", nil)
 	if err != nil {
 		panic(err)
 	}
@@ -90,3 +91,106 @@ func TestSQLLoadServer(t *testing.T) {
 		}
 	}
 }
+
+func TestSQLMigrationApplied(t *testing.T) {
+	setup()
+	app := setupApp()
+	now := time.Now()
+	testcases := []struct {
+		sql        string
+		env        string
+		migrations []*sqlMig.SQLMigrationStrategy
+		out        []string
+		notOut     []string
+	}{{
+		sql: "../../resources/sql/test6.sql",
+		env: "dev",
+		migrations: []*sqlMig.SQLMigrationStrategy{{
+			Table: "a.b.c",
+			Env:   "dev",
+			MigrationsUp: []*sqlMig.SQLMigration{
+				{ID: 1, SourceTable: "a.b.c", FileOrder: 1, MigratedAt: &now},
+				{ID: 2, SourceTable: "a.b.c", FileOrder: 2},
+			},
+		}},
+		out:    []string{"select name from A.B.C", "latest 1 pending [2]"},
+		notOut: []string{"name_type"},
+	}}
+
+	for _, test := range testcases {
+		sqlScript, _ := utils.ReadFile(test.sql)
+		migEnv := make(map[string][]*sqlMig.SQLMigrationStrategy)
+		migEnv[test.env] = test.migrations
+		sql := New(string(sqlScript), test.env, migEnv, app.Script.Get)
+		parsed := sql.Compile()
+		for _, o := range test.out {
+			if !strings.Contains(parsed, o) {
+				t.Error(parsed)
+			}
+		}
+		for _, o := range test.notOut {
+			if strings.Contains(parsed, o) {
+				t.Error(parsed)
+			}
+		}
+	}
+}
+
+func TestSQLMigrationContext(t *testing.T) {
+	setup()
+	now := time.Now()
+	migEnv := map[string][]*sqlMig.SQLMigrationStrategy{"dev": {{
+		Table: "a.b.c",
+		Env:   "dev",
+		MigrationsUp: []*sqlMig.SQLMigration{
+			{ID: 1, SourceTable: "a.b.c", FileOrder: 1, MigratedAt: &now},
+			{ID: 2, SourceTable: "a.b.c", FileOrder: 2},
+		},
+	}}}
+	fragment := func(keywords string, body string) string {
+		return "/*\n[sqlmbegin]\n[script]\n\t- description: \"test\"\n[dev]\n" + keywords + "[sqlmend]\n*/\n" + body
+	}
+	scripts := map[string]string{
+		"proj1-nested-sql":   fragment("\t- table1: \"A.B.C\"\n", "nested latest {{(index .migrations \"a.b.c\").Latest}}"),
+		"proj1-reserved-sql": fragment("\t- migrations: \"A.B.C\"\n", "select 1"),
+	}
+	get := func(name string) (string, error) {
+		return scripts[name], nil
+	}
+
+	testcases := []struct {
+		sql    string
+		out    []string
+		notOut []string
+		err    bool
+	}{
+		// the legacy keywords follow the applied state
+		{sql: fragment("", "{{if .a_b_c_1}}one{{end}} {{if .a_b_c_2}}two{{end}}"), out: []string{"one"}, notOut: []string{"two"}},
+		{sql: fragment("\t- ref1: sqlmref(\"proj1-nested-sql\")\n", "{{.ref1}}"), out: []string{"nested latest 1"}},
+		{sql: fragment("\t- migrations: \"A.B.C\"\n", "select 1"), err: true},
+		{sql: fragment("\t- ref1: sqlmref(\"proj1-reserved-sql\")\n", "{{.ref1}}"), err: true},
+	}
+	for _, test := range testcases {
+		sql := New(test.sql, "dev", migEnv, get)
+		parsed := sql.Compile()
+		if test.err {
+			if sql.Err == nil || !strings.Contains(sql.Err.Error(), "reserved") {
+				t.Errorf(" error expected a reserved keyword error %q %v", parsed, sql.Err)
+			}
+			continue
+		}
+		if sql.Err != nil {
+			t.Errorf(" error compile %v", sql.Err)
+		}
+		for _, o := range test.out {
+			if !strings.Contains(parsed, o) {
+				t.Errorf(" error expected %q in %q", o, parsed)
+			}
+		}
+		for _, o := range test.notOut {
+			if strings.Contains(parsed, o) {
+				t.Errorf(" error unexpected %q in %q", o, parsed)
+			}
+		}
+	}
+}
@@ -69,6 +69,92 @@ func main() {
 				},
 				Action: smcli.Register,
 			},
+			{
+				Name:  "project",
+				Usage: "manage the projects which group your SQL",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "create",
+						Usage:     "create a project",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "description",
+								Usage: "what the project is for",
+							},
+							&cli.StringFlag{
+								Name:  "git-repo",
+								Usage: "the git repo holding the project's scripts, defaults to the server's repo",
+							},
+						},
+						Action: smcli.ProjectCreate,
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "list every project",
+						Action:  smcli.ProjectList,
+					},
+					{
+						Name:      "rename",
+						Usage:     "rename a project",
+						ArgsUsage: "<name> <new name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "description",
+								Usage: "also set the description of the project",
+							},
+						},
+						Action: smcli.ProjectRename,
+					},
+					{
+						Name:      "bind",
+						Usage:     "bind a project to a git repo, or to the server's repo when no repo is given",
+						ArgsUsage: "<name> [repo]",
+						Action:    smcli.ProjectBind,
+					},
+					{
+						Name:      "delete",
+						Usage:     "delete a project, its name can then be reused",
+						ArgsUsage: "<name>",
+						Action:    smcli.ProjectDelete,
+					},
+				},
+			},
+			{
+				Name:  "repo",
+				Usage: "manage the git repos which projects can be bound to",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "add a git repo, the server clones it straight away",
+						ArgsUsage: "<name> <url>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "branch",
+								Usage: "the branch to serve scripts from, defaults to the repo's default branch",
+							},
+							&cli.StringFlag{
+								Name:  "credentials-ref",
+								Usage: "the prefix of the environment variables on the server holding the credentials, e.g. ANALYTICS_GIT for ANALYTICS_GIT_USERNAME and ANALYTICS_GIT_TOKEN or ANALYTICS_GIT_SSH_KEY_FILE, leave it out for a public repo",
+							},
+						},
+						Action: smcli.RepoAdd,
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "list every git repo",
+						Action:  smcli.RepoList,
+					},
+					{
+						Name:      "delete",
+						Usage:     "delete a git repo which no project is bound to",
+						ArgsUsage: "<name>",
+						Action:    smcli.RepoDelete,
+					},
+				},
+			},
 			{
 				Name:  "script",
 				Usage: "work with your SQL",
@@ -80,13 +166,55 @@ func main() {
 						Action:  smcli.ScriptRegister,
 					},
 					{
-						Name:    "remove",
-						Aliases: []string{"rm"},
-						Usage:   "deregister a file from the application",
-						Action: func(c *cli.Context) error {
-							fmt.Println("completed task: ", c.Args().First())
-							return nil
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						Usage:     "deregister a file from the application",
+						ArgsUsage: "<script>",
+						Action:    smcli.ScriptRemove,
+					},
+					{
+						Name:      "log",
+						Usage:     "show the git commits which changed a script",
+						ArgsUsage: "<script>",
+						Action:    smcli.ScriptLog,
+					},
+					{
+						Name:      "diff",
+						Usage:     "show the changes to a script between two git refs, by default its latest change",
+						ArgsUsage: "<script>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "from",
+								Usage: "the branch, tag or commit to diff from, defaults to the version before the latest change",
+							},
+							&cli.StringFlag{
+								Name:  "to",
+								Usage: "the branch, tag or commit to diff to, defaults to the latest commit",
+							},
+						},
+						Action: smcli.ScriptDiff,
+					},
+					{
+						Name:   "sync",
+						Usage:  "register every script in git which has a sqlm block, following moved and deleted files",
+						Action: smcli.ScriptSync,
+					},
+					{
+						Name:      "move",
+						Aliases:   []string{"mv"},
+						Usage:     "point a script at a new file location, or move it to another project",
+						ArgsUsage: "<script>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "file",
+								Usage: "the new location of the file in git, the script keeps its name",
+							},
+							&cli.StringFlag{
+								Name:  "project",
+								Usage: "the project to move the script to",
+							},
 						},
+						Action: smcli.ScriptMove,
 					},
 					{
 						Name:    "get",
@@ -121,9 +249,51 @@ func main() {
 								Value:    "none",
 								Usage:    "environment",
 							},
+							&cli.StringFlag{
+								Name:  "ref",
+								Usage: "compile the script as it was at a git branch, tag or commit, e.g. v1.2.0",
+							},
 						},
 						Action: smcli.ScriptGetCompile,
 					},
+					{
+						Name:      "run",
+						Usage:     "compile a script and run it against the target database",
+						ArgsUsage: "<script>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Required: true,
+								Aliases:  []string{"e"},
+								Usage:    "environment",
+							},
+							&cli.StringFlag{
+								Name:    "connection",
+								Aliases: []string{"c"},
+								Usage:   "the connection string, required unless --exec-cmd is set",
+							},
+							&cli.StringFlag{
+								Name:     "driver",
+								Aliases:  []string{"d"},
+								Required: true,
+								Usage:    "the driver, one of postgres, sqlserver, mssql, sqlite3 (or sqlite) and mysql, or the dialect used with --exec-cmd",
+							},
+							&cli.StringFlag{
+								Name:  "exec-cmd",
+								Usage: "a command which reads SQL on stdin and prints query results as csv, e.g. 'psql -q -t --csv -v ON_ERROR_STOP=1 mydb'",
+							},
+							&cli.BoolFlag{
+								Name:  "exec-header",
+								Value: false,
+								Usage: "the --exec-cmd prints a header row before query results",
+							},
+							&cli.StringFlag{
+								Name:  "ref",
+								Usage: "compile the script as it was at a git branch, tag or commit, e.g. v1.2.0",
+							},
+						},
+						Action: smcli.ScriptRun,
+					},
 				},
 			},
 			{
@@ -147,9 +317,62 @@ func main() {
 								Required: true,
 								Usage:    "the env",
 							},
+							&cli.StringSliceFlag{
+								Name:  "depends-on",
+								Usage: "a migration of another table this migration depends on, as table:order",
+							},
 						},
 						Action: smcli.MigrationAdd,
 					},
+					{
+						Name:      "new",
+						Usage:     "write a new migration file for a table",
+						ArgsUsage: "<table> <name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env used to number the migration",
+							},
+							&cli.StringFlag{
+								Name:  "dir",
+								Value: ".",
+								Usage: "the directory to write the migration to",
+							},
+							&cli.StringFlag{
+								Name:  "up",
+								Usage: "the up statements, the down statements are generated for create table, add column and create index",
+							},
+							&cli.StringFlag{
+								Name:    "driver",
+								Aliases: []string{"d"},
+								Value:   "postgres",
+								Usage:   "the database driver the down statements are written for",
+							},
+						},
+						Action: smcli.MigrationNew,
+					},
+					{
+						Name:      "sync",
+						Usage:     "register every migration in a git directory",
+						ArgsUsage: "<git dir>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "table",
+								Aliases:  []string{"t"},
+								Required: true,
+								Usage:    "the table name to associate",
+							},
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env",
+							},
+						},
+						Action: smcli.MigrationSync,
+					},
 					{
 						Name:    "list",
 						Aliases: []string{"ls"},
@@ -165,16 +388,105 @@ func main() {
 						Action: smcli.MigrationList,
 					},
 					{
-						Name:    "set",
-						Aliases: []string{"s"},
-						Usage:   "list migrations",
-						Action:  smcli.MigrationSet,
+						Name:      "set",
+						Aliases:   []string{"s"},
+						Usage:     "set the latest migration",
+						ArgsUsage: "<env>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "table",
+								Aliases: []string{"t"},
+								Usage:   "the table name, prompted for when missing",
+							},
+							&cli.IntFlag{
+								Name:  "id",
+								Usage: "the id of the migration",
+							},
+							&cli.StringFlag{
+								Name:  "file",
+								Usage: "the file of the migration",
+							},
+							&cli.IntFlag{
+								Name:  "order",
+								Usage: "the order of the migration",
+							},
+							&cli.StringFlag{
+								Name:  "to",
+								Usage: "set to a relative migration, one of latest, previous or base",
+							},
+							&cli.BoolFlag{
+								Name:  "undo",
+								Value: false,
+								Usage: "restore the latest migration to where it was before the most recent change",
+							},
+							&cli.StringFlag{
+								Name:  "reason",
+								Usage: "the reason for the change, kept in the migration history",
+							},
+						},
+						Action: smcli.MigrationSet,
+					},
+					{
+						Name:      "schema",
+						Usage:     "show the schema of a table captured after a migration was applied",
+						ArgsUsage: "<table>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env",
+							},
+							&cli.IntFlag{
+								Name:  "at",
+								Usage: "the migration id to show the schema after, defaults to the latest",
+							},
+							&cli.IntFlag{
+								Name:  "diff",
+								Usage: "a migration id to show the schema changes from",
+							},
+						},
+						Action: smcli.MigrationSchema,
 					},
 					{
-						Name:    "delete",
-						Aliases: []string{"d"},
-						Usage:   "delete migration",
-						Action:  smcli.MigrationDelete,
+						Name:      "history",
+						Usage:     "list the changes made to the latest migration of a table",
+						ArgsUsage: "<table>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env",
+							},
+						},
+						Action: smcli.MigrationHistory,
+					},
+					{
+						Name:      "delete",
+						Aliases:   []string{"d"},
+						Usage:     "delete migration",
+						ArgsUsage: "<env>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "table",
+								Aliases: []string{"t"},
+								Usage:   "the table name, prompted for when missing",
+							},
+							&cli.IntFlag{
+								Name:  "id",
+								Usage: "the id of the migration",
+							},
+							&cli.StringFlag{
+								Name:  "file",
+								Usage: "the file of the migration",
+							},
+							&cli.IntFlag{
+								Name:  "order",
+								Usage: "the order of the migration",
+							},
+						},
+						Action: smcli.MigrationDelete,
 					},
 					{
 						Name:    "list-tables",
@@ -194,20 +506,151 @@ func main() {
 								Usage:    "the env",
 							},
 							&cli.StringFlag{
-								Name:     "connection",
-								Aliases:  []string{"c"},
-								Required: true,
-								Usage:    "the connection string",
+								Name:    "connection",
+								Aliases: []string{"c"},
+								Usage:   "the connection string, required unless --exec-cmd is set",
 							},
 							&cli.StringFlag{
 								Name:     "driver",
 								Aliases:  []string{"d"},
 								Required: true,
-								Usage:    "the driver",
+								Usage:    "the driver, one of postgres, sqlserver, mssql, sqlite3 (or sqlite) and mysql, or the dialect used with --exec-cmd",
+							},
+							&cli.StringFlag{
+								Name:  "exec-cmd",
+								Usage: "a command which reads SQL on stdin and prints query results as csv, e.g. 'psql -q -t --csv -v ON_ERROR_STOP=1 mydb'",
+							},
+							&cli.BoolFlag{
+								Name:  "exec-header",
+								Value: false,
+								Usage: "the --exec-cmd prints a header row before query results",
+							},
+							&cli.BoolFlag{
+								Name:  "allow-modified",
+								Value: false,
+								Usage: "roll back applied migrations even if their script has changed since",
+							},
+							&cli.BoolFlag{
+								Name:  "all",
+								Value: false,
+								Usage: "run the migrations of every table in dependency order",
+							},
+							&cli.IntFlag{
+								Name:  "parallel",
+								Value: 1,
+								Usage: "with --all, the number of independent tables migrated at the same time",
+							},
+							&cli.DurationFlag{
+								Name:  "statement-timeout",
+								Usage: "cancel and roll back a migration when one of its statements runs for longer, e.g. 5m",
+							},
+							&cli.DurationFlag{
+								Name:  "total-timeout",
+								Usage: "cancel the run and roll back the migration in flight after this long, e.g. 1h",
 							},
 						},
 						Action: smcli.DoMigrations,
 					},
+					{
+						Name:  "dag",
+						Usage: "list the migrations of an env in dependency order",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env",
+							},
+						},
+						Action: smcli.MigrationDAG,
+					},
+					{
+						Name:      "diff",
+						Usage:     "show the migrations which differ between two envs",
+						ArgsUsage: "<source env> <target env>",
+						Action:    smcli.MigrationDiff,
+					},
+					{
+						Name:      "promote",
+						Usage:     "register the migrations of a table missing from the target env",
+						ArgsUsage: "<source env> <target env> <table>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "require-applied",
+								Value: false,
+								Usage: "only promote migrations which have been applied in the source env",
+							},
+						},
+						Action: smcli.MigrationPromote,
+					},
+					{
+						Name:    "status",
+						Aliases: []string{"st"},
+						Usage:   "compare server migrations with the log in the target database",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env",
+							},
+							&cli.StringFlag{
+								Name:    "connection",
+								Aliases: []string{"c"},
+								Usage:   "the connection string, required unless --exec-cmd is set",
+							},
+							&cli.StringFlag{
+								Name:     "driver",
+								Aliases:  []string{"d"},
+								Required: true,
+								Usage:    "the driver, one of postgres, sqlserver, mssql, sqlite3 (or sqlite) and mysql, or the dialect used with --exec-cmd",
+							},
+							&cli.StringFlag{
+								Name:  "exec-cmd",
+								Usage: "a command which reads SQL on stdin and prints query results as csv, e.g. 'psql -q -t --csv -v ON_ERROR_STOP=1 mydb'",
+							},
+							&cli.BoolFlag{
+								Name:  "exec-header",
+								Value: false,
+								Usage: "the --exec-cmd prints a header row before query results",
+							},
+						},
+						Action: smcli.MigrationStatus,
+					},
+					{
+						Name:      "drift",
+						Usage:     "compare the live schema of tables with the schema recorded after their latest migration",
+						ArgsUsage: "[table...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "env",
+								Aliases:  []string{"e"},
+								Required: true,
+								Usage:    "the env",
+							},
+							&cli.StringFlag{
+								Name:    "connection",
+								Aliases: []string{"c"},
+								Usage:   "the connection string, required unless --exec-cmd is set",
+							},
+							&cli.StringFlag{
+								Name:     "driver",
+								Aliases:  []string{"d"},
+								Required: true,
+								Usage:    "the driver, one of postgres, sqlserver, mssql, sqlite3 (or sqlite) and mysql, or the dialect used with --exec-cmd",
+							},
+							&cli.StringFlag{
+								Name:  "exec-cmd",
+								Usage: "a command which reads SQL on stdin and prints query results as csv, e.g. 'psql -q -t --csv -v ON_ERROR_STOP=1 mydb'",
+							},
+							&cli.BoolFlag{
+								Name:  "exec-header",
+								Value: false,
+								Usage: "the --exec-cmd prints a header row before query results",
+							},
+						},
+						Action: smcli.MigrationDrift,
+					},
 				},
 			},
 			{
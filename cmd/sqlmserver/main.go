@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"github.com/c-jamie/sql-manager/serverlib/api"
 	"github.com/c-jamie/sql-manager/serverlib/db"
@@ -22,16 +26,24 @@ func main() {
 	if !ok {
 		log.Fatal("unable to load SQLM_SER_AUTH")
 	}
+	// one of token, ssh or anonymous, by default it is inferred from the credentials which are set
+	gitAuth := os.Getenv("SQLM_SER_GIT_AUTH")
 	gitUserName, ok := os.LookupEnv("SQLM_SER_GIT_USERNAME")
-	if !ok {
+	if !ok && gitAuth == "token" {
 		log.Fatal("unable to load SQLM_SER_GIT_USERNAME")
 	}
 	gitToken, ok := os.LookupEnv("SQLM_SER_GIT_TOKEN")
-	if !ok {
+	if !ok && gitAuth == "token" {
 		log.Fatal("unable to load SQLM_SER_GIT_TOKEN")
 	}
+	gitKeyFile, ok := os.LookupEnv("SQLM_SER_GIT_SSH_KEY_FILE")
+	if !ok && gitAuth == "ssh" {
+		log.Fatal("unable to load SQLM_SER_GIT_SSH_KEY_FILE")
+	}
+	// a directory of scripts served as they are on disk, in place of the git url
+	gitDir := os.Getenv("SQLM_SER_GIT_DIR")
 	gitUrl, ok := os.LookupEnv("SQLM_SER_GIT_URL")
-	if !ok {
+	if !ok && gitDir == "" {
 		log.Fatal("unable to load SQLM_SER_GIT_URL")
 	}
 	dbHost, ok := os.LookupEnv("SQLM_SER_DB_HOST")
@@ -66,11 +78,25 @@ func main() {
 	} else {
 		dbConnStr = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s", dbUser, dbPW, dbHost, dbPort, dbName, ssl)
 	}
-	log.Debug("db conn str ", dbConnStr)
 	cfg := api.Config{}
 	cfg.GitUserName = gitUserName
 	cfg.GitToken = gitToken
 	cfg.GitURL = gitUrl
+	cfg.GitDir = gitDir
+	cfg.GitAuth = gitAuth
+	cfg.GitSSHKeyFile = gitKeyFile
+	cfg.GitSSHKeyPassphrase = os.Getenv("SQLM_SER_GIT_SSH_KEY_PASSPHRASE")
+	cfg.GitKnownHosts = os.Getenv("SQLM_SER_GIT_KNOWN_HOSTS")
+	cfg.GitSyncOnPull = os.Getenv("SQLM_SER_GIT_SYNC_ON_PULL") == "true"
+	cfg.GitSyncInterval = time.Minute
+	if interval, ok := os.LookupEnv("SQLM_SER_GIT_SYNC_INTERVAL"); ok {
+		syncInterval, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal("unable to parse SQLM_SER_GIT_SYNC_INTERVAL: ", err)
+		}
+		cfg.GitSyncInterval = syncInterval
+	}
+	cfg.GitWebhookSecret = os.Getenv("SQLM_SER_GIT_WEBHOOK_SECRET")
 	cfg.Auth = auth 
 	cfg.Version = "v1"
 	cfg.DB.ConnStr = dbConnStr
@@ -82,7 +108,11 @@ func main() {
 		log.Fatal("unable to start db: ", err)
 	}
 
-	app, err := api.NewApplication(db, &cfg)
+	// ctrl-c or a SIGTERM stops the server and its background pulls
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := api.NewApplication(ctx, db, &cfg)
 
 	if err != nil {
 		log.Fatal(err)
@@ -92,5 +122,20 @@ func main() {
 	address := ":" + addr
 	log.Info("listening on address: ", address)
 	service := &http.Server{Addr: address, Handler: app.Routes(), ReadTimeout: 8 * time.Second, WriteTimeout: 8 * time.Second}
-	log.Fatal(service.ListenAndServe())
+	go func() {
+		err := service.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = service.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Error("unable to shut down: ", err)
+	}
+	app.Wait()
 }
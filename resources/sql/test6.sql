@@ -0,0 +1,15 @@
+/*
+  [sqlmbegin]
+  [script]
+    - description: "selects from a.b.c based on the applied migrations"
+  [dev]
+    - table1: "A.B.C"
+  [sqlmend]
+*/
+{{if migrationApplied "a.b.c" 1}}
+select name from {{.table1}}
+{{end}}
+{{if migrationApplied "a.b.c" 2}}
+select name, name_type from {{.table1}}
+{{end}}
+-- latest {{(index .migrations "a.b.c").Latest}} pending {{(index .migrations "a.b.c").Pending}}
@@ -1,67 +1,1046 @@
 package api
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/c-jamie/sql-manager/serverlib/internal/data"
+	"github.com/c-jamie/sql-manager/serverlib/internal/git"
 	"github.com/c-jamie/sql-manager/serverlib/internal/validator"
+	"github.com/c-jamie/sql-manager/serverlib/log"
 	"github.com/gin-gonic/gin"
 )
 
 func (app *Application) listFilesHandeler(c *gin.Context) {
 	qs := c.Request.URL.Query()
 	name := app.readString(qs, "project", "")
+	prefix := app.readString(qs, "prefix", "")
 
 	v := validator.New()
 	v.Check(name != "", "project", "must not be empty")
 
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "file_location"),
+		SortSafelist: []string{"file_location", "snippit_name", "-file_location", "-snippit_name"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+	sqlScript, metadata, err := app.Models.SQLScript.GetAll(name, prefix, filters)
+
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": sqlScript, "metadata": metadata})
+}
+
+func (app *Application) getFilesHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	name := app.readString(qs, "name", "")
+	ref := app.readString(qs, "ref", "")
+
+	v := validator.New()
+	v.Check(name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+	sqlScript, err := app.Models.SQLScript.Get(name)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	repo, err := app.repoFor(sqlScript.GitRepoID)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	commit, err := repo.Resolve(ref)
+	if err != nil {
+		app.gitError(c, err)
+		return
+	}
+
+	sql, err := repo.GetFileAt(sqlScript.FileLocation, commit)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	sqlScript.Script = sql
+
+	c.JSON(http.StatusOK, gin.H{"files": sqlScript, "commit": commit, "git_repo_id": sqlScript.GitRepoID})
+}
+
+func (app *Application) getFileHistoryHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	name := app.readString(qs, "name", "")
+
+	v := validator.New()
+	v.Check(name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+	sqlScript, err := app.Models.SQLScript.Get(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	repo, err := app.repoFor(sqlScript.GitRepoID)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	commits, err := repo.History(sqlScript.FileLocation)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": commits})
+}
+
+func (app *Application) diffFilesHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	name := app.readString(qs, "name", "")
+	from := app.readString(qs, "from", "")
+	to := app.readString(qs, "to", "")
+
+	v := validator.New()
+	v.Check(name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+	sqlScript, err := app.Models.SQLScript.Get(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	repo, err := app.repoFor(sqlScript.GitRepoID)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	toCommit, err := repo.Resolve(to)
+	if err != nil {
+		app.gitError(c, err)
+		return
+	}
+	if from == "" {
+		// without a from the diff shows the latest change to the file
+		commits, err := repo.History(sqlScript.FileLocation)
+		if err != nil {
+			app.badRequest(c, err)
+			return
+		}
+		v.Check(len(commits) > 1, "from", "must be provided, the file has no earlier version")
+		if !v.Valid() {
+			app.failedValidationResponse(c, v.Errors)
+			return
+		}
+		from = commits[1].SHA
+	}
+	fromCommit, err := repo.Resolve(from)
+	if err != nil {
+		app.gitError(c, err)
+		return
+	}
+
+	diff, err := repo.Diff(sqlScript.FileLocation, fromCommit, toCommit)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"diff": diff, "from": fromCommit, "to": toCommit})
+}
+
+func (app *Application) registerFilesHandeler(c *gin.Context) {
+	var input struct {
+		File    string `json:"file"`
+		Project string `json:"project"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+	}
+
+	v := validator.New()
+	v.Check(input.File != "", "file", "must not be empty")
+	v.Check(input.Project != "", "project", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	sqlScript := data.SQLScript{Project: input.Project, FileLocation: input.File}
+	err := app.Models.SQLScript.Register(&sqlScript)
+
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"files": sqlScript})
+
+}
+
+func (app *Application) updateFilesHandeler(c *gin.Context) {
+	var input struct {
+		Name    string  `json:"name"`
+		File    *string `json:"file"`
+		Project *string `json:"project"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+	v.Check(input.File == nil || *input.File != "", "file", "must not be empty")
+	v.Check(input.Project == nil || *input.Project != "", "project", "must not be empty")
+	v.Check(input.File != nil || input.Project != nil, "file", "one of file or project must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	sqlScript, err := app.Models.SQLScript.Get(input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	// the name follows the file location, a moved script is referenced by its new location
+	if input.File != nil {
+		sqlScript.FileLocation = strings.Trim(*input.File, "/")
+	}
+	if input.Project != nil {
+		sqlScript.Project = *input.Project
+		project, err := app.Models.Project.Get(sqlScript.Project)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrProjectNotFound):
+				v.AddError("project", "must exist")
+				app.failedValidationResponse(c, v.Errors)
+			default:
+				app.badRequest(c, err)
+			}
+			return
+		}
+		sqlScript.GitRepoID = project.GitRepoID
+	}
+
+	// the file must exist in the repo of the project the script ends up in
+	repo, err := app.repoFor(sqlScript.GitRepoID)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+	_, err = repo.GetFile(sqlScript.FileLocation)
+	if err != nil {
+		v.AddError("file", "must exist in git")
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	err = app.Models.SQLScript.Update(sqlScript)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		case errors.Is(err, data.ErrProjectNotFound):
+			v.AddError("project", "must exist")
+			app.failedValidationResponse(c, v.Errors)
+		case errors.Is(err, data.ErrDuplicateScript):
+			v.AddError("file", "is already registered")
+			app.failedValidationResponse(c, v.Errors)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": sqlScript})
+}
+
+func (app *Application) deleteFilesHandeler(c *gin.Context) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	sqlScript, err := app.Models.SQLScript.Get(input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	err = app.Models.SQLScript.Remove(sqlScript)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrScriptNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "script successfully removed"})
+}
+
+func (app *Application) syncFilesHandeler(c *gin.Context) {
+	sync, err := app.syncScripts()
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"sync": sync})
+}
+
+// scriptSync lists the file locations changed by discovering scripts in git
+type scriptSync struct {
+	Added   []string `json:"added"`
+	Moved   []string `json:"moved"`
+	Removed []string `json:"removed"`
+}
+
+// syncScripts registers the sql files in the default repo which contain a [sqlmbegin] block under a project named
+// after their directory, follows files which have been renamed and removes scripts whose file has been deleted.
+// Files at the root of the repo have no directory to name a project after and are skipped.
+func (app *Application) syncScripts() (*scriptSync, error) {
+	app.syncMu.Lock()
+	defer app.syncMu.Unlock()
+
+	files, err := app.GIT.Files()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list git files %w", err)
+	}
+	registered, err := app.Models.SQLScript.List()
+	if err != nil {
+		return nil, err
+	}
+
+	inGit := make(map[string]bool)
+	checksums := make(map[string]string)
+	var discovered []string
+	for _, f := range files {
+		inGit[f] = true
+		if path.Ext(f) != ".sql" || path.Dir(f) == "." {
+			continue
+		}
+		sql, err := app.GIT.GetFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s %w", f, err)
+		}
+		if strings.Contains(sql, "[sqlmbegin]") {
+			discovered = append(discovered, f)
+			checksums[f] = data.Checksum(sql)
+		}
+	}
+
+	known := make(map[string]bool)
+	var missing []*data.SQLScript
+	for _, s := range registered {
+		// scripts of projects bound to another repo are left alone
+		if s.GitRepoID != 0 {
+			continue
+		}
+		known[s.FileLocation] = true
+		if !inGit[s.FileLocation] {
+			missing = append(missing, s)
+		}
+	}
+
+	// a file is treated as renamed when exactly one missing script had the same content as exactly one new file
+	var added []string
+	newByChecksum := make(map[string][]string)
+	for _, f := range discovered {
+		if known[f] {
+			continue
+		}
+		added = append(added, f)
+		newByChecksum[checksums[f]] = append(newByChecksum[checksums[f]], f)
+	}
+	missingChecksums := make(map[*data.SQLScript]string)
+	missingByChecksum := make(map[string]int)
+	for _, s := range missing {
+		if sql, ok := app.lastContent(s.FileLocation); ok {
+			missingChecksums[s] = data.Checksum(sql)
+			missingByChecksum[missingChecksums[s]]++
+		}
+	}
+
+	out := scriptSync{Added: []string{}, Moved: []string{}, Removed: []string{}}
+	moved := make(map[string]bool)
+	for _, s := range missing {
+		checksum, ok := missingChecksums[s]
+		if ok && missingByChecksum[checksum] == 1 && len(newByChecksum[checksum]) == 1 {
+			to := newByChecksum[checksum][0]
+			from := s.FileLocation
+			s.FileLocation = to
+			err := app.Models.SQLScript.Update(s)
+			if err != nil {
+				return nil, err
+			}
+			moved[to] = true
+			out.Moved = append(out.Moved, from+" -> "+to)
+			continue
+		}
+		err := app.Models.SQLScript.Remove(s)
+		if err != nil && !errors.Is(err, data.ErrScriptNotFound) {
+			return nil, err
+		}
+		out.Removed = append(out.Removed, s.FileLocation)
+	}
+
+	for _, f := range added {
+		if moved[f] {
+			continue
+		}
+		script := data.SQLScript{Project: path.Dir(f), FileLocation: f}
+		err := app.Models.SQLScript.Register(&script)
+		if err != nil {
+			return nil, err
+		}
+		out.Added = append(out.Added, f)
+	}
+
+	log.Info("scripts synced: ", len(out.Added), " added, ", len(out.Moved), " moved, ", len(out.Removed), " removed")
+	return &out, nil
+}
+
+// lastContent returns a file of the default repo as it was in the newest commit which still had it
+func (app *Application) lastContent(file string) (string, bool) {
+	commits, err := app.GIT.History(file)
+	if err != nil {
+		return "", false
+	}
+	for _, c := range commits {
+		sql, err := app.GIT.GetFileAt(file, c.SHA)
+		if err == nil {
+			return sql, true
+		}
+	}
+	return "", false
+}
+
+func (app *Application) getProjectsHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	name := app.readString(qs, "name", "")
+
+	v := validator.New()
+	v.Check(name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+	project, err := app.Models.Project.Get(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrProjectNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": project})
+}
+
+func (app *Application) listProjectsHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+
+	v := validator.New()
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "name"),
+		SortSafelist: []string{"name", "created_at", "-name", "-created_at"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	projects, metadata, err := app.Models.Project.GetAll(filters)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"projects": projects, "metadata": metadata})
+}
+
+func (app *Application) addProjectHandeler(c *gin.Context) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		GitRepo     string `json:"git_repo"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	if !app.checkGitRepo(c, v, input.GitRepo) {
+		return
+	}
+
+	project := data.Project{Name: input.Name, Description: input.Description, GitRepo: input.GitRepo}
+	err := app.Models.Project.Insert(&project)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateProject):
+			v.AddError("name", err.Error())
+			app.failedValidationResponse(c, v.Errors)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"project": project})
+}
+
+func (app *Application) updateProjectHandeler(c *gin.Context) {
+	var input struct {
+		Name        string  `json:"name"`
+		NewName     *string `json:"new_name"`
+		Description *string `json:"description"`
+		GitRepo     *string `json:"git_repo"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+	v.Check(input.NewName == nil || *input.NewName != "", "new_name", "must not be empty")
+	v.Check(input.NewName != nil || input.Description != nil || input.GitRepo != nil, "new_name", "one of new_name, description or git_repo must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	// an empty git_repo binds the project back to the default repo
+	if input.GitRepo != nil && !app.checkGitRepo(c, v, *input.GitRepo) {
+		return
+	}
+
+	project, err := app.Models.Project.Get(input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrProjectNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	if input.NewName != nil {
+		project.Name = *input.NewName
+	}
+	if input.Description != nil {
+		project.Description = *input.Description
+	}
+	if input.GitRepo != nil {
+		project.GitRepo = *input.GitRepo
+	}
+
+	err = app.Models.Project.Update(project)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateProject):
+			v.AddError("new_name", err.Error())
+			app.failedValidationResponse(c, v.Errors)
+		case errors.Is(err, data.ErrProjectNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"project": project})
+}
+
+// checkGitRepo responds with a failed validation when a project is bound to a git repo which does not exist
+func (app *Application) checkGitRepo(c *gin.Context, v *validator.Validator, name string) bool {
+	if name == "" {
+		return true
+	}
+	_, err := app.Models.GitRepo.Get(name)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, data.ErrGitRepoNotFound):
+		v.AddError("git_repo", "must exist")
+		app.failedValidationResponse(c, v.Errors)
+	default:
+		app.badRequest(c, err)
+	}
+	return false
+}
+
+func (app *Application) deleteProjectHandeler(c *gin.Context) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	err := app.Models.Project.Delete(input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrProjectNotFound):
+			app.notFound(c, err)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "project successfully deleted"})
+}
+
+func (app *Application) listGitReposHandeler(c *gin.Context) {
+	repos, err := app.Models.GitRepo.GetAll()
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"repos": repos})
+}
+
+func (app *Application) addGitRepoHandeler(c *gin.Context) {
+	var input struct {
+		Name           string `json:"name"`
+		URL            string `json:"url"`
+		Branch         string `json:"branch"`
+		CredentialsRef string `json:"credentials_ref"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+	v.Check(input.URL != "", "url", "must not be empty")
+	v.Check(!git.IsLocal(input.URL), "url", "must be a remote url, not a path on the server")
+	v.Check(input.CredentialsRef == "" || validCredentialsRef(input.CredentialsRef), "credentials_ref", "must be upper case letters, digits and underscores and not name a server variable")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	gitRepo := data.GitRepo{Name: input.Name, URL: input.URL, Branch: input.Branch, CredentialsRef: input.CredentialsRef}
+
+	// clone up front so a bad url or missing credentials are reported now rather than on first use
+	remote, err := remoteFor(&gitRepo)
+	if err == nil {
+		_, err = app.Repos.Get(remote)
+	}
+	if err != nil {
+		v.AddError("url", fmt.Sprintf("unable to clone: %s", err))
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	err = app.Models.GitRepo.Insert(&gitRepo)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGitRepo):
+			v.AddError("name", err.Error())
+			app.failedValidationResponse(c, v.Errors)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"repo": gitRepo})
+}
+
+func (app *Application) deleteGitRepoHandeler(c *gin.Context) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	err := app.Models.GitRepo.Delete(input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGitRepoNotFound):
+			app.notFound(c, err)
+		case errors.Is(err, data.ErrGitRepoInUse):
+			v.AddError("name", err.Error())
+			app.failedValidationResponse(c, v.Errors)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "git repo successfully deleted"})
+}
+
+func (app *Application) addMigrationsHandeler(c *gin.Context) {
+	var input struct {
+		File      string `json:"file"`
+		Env       string `json:"env"`
+		Table     string `json:"table"`
+		DependsOn []struct {
+			Table string `json:"table"`
+			Order int    `json:"order"`
+		} `json:"depends_on"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+	}
+
+	v := validator.New()
+	v.Check(input.File != "", "file", "must not be empty")
+	v.Check(input.Env != "", "env", "must not be empty")
+	v.Check(input.Table != "", "table", "must not be empty")
+	for _, d := range input.DependsOn {
+		v.Check(d.Table != "", "depends_on", "table must not be empty")
+		v.Check(d.Table != input.Table, "depends_on", "must reference another table")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	var dependsOn []*data.SQLMigration
+	for _, d := range input.DependsOn {
+		dep, err := app.Models.SQLMigration.GetByOrder(input.Env, d.Table, d.Order)
+		if err != nil {
+			app.badRequest(c, err)
+			return
+		}
+		dependsOn = append(dependsOn, dep)
+	}
+
+	mig := data.SQLMigration{File: input.File, Env: input.Env, SourceTable: input.Table, ChangedBy: app.contextGetUserEmail(c)}
+	err := app.addMigration(&mig, dependsOn)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMigrationCycle):
+			v.AddError("depends_on", err.Error())
+			app.failedValidationResponse(c, v.Errors)
+		default:
+			app.badRequest(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"migrations": mig})
+}
+
+// addMigration registers a migration with the checksum of its script and any dependencies
+func (app *Application) addMigration(mig *data.SQLMigration, dependsOn []*data.SQLMigration) error {
+	err := app.setChecksum(mig)
+	if err != nil {
+		return err
+	}
+	mig.DependsOn = dependsOn
+	return app.Models.SQLMigration.Add(mig)
+}
+
+// setChecksum records the checksum of the script of a migration as it is in git
+func (app *Application) setChecksum(mig *data.SQLMigration) error {
+	sql, err := app.GIT.GetFile(mig.File)
+	if err != nil {
+		return fmt.Errorf("unable to checksum migration %s: %w", mig.File, err)
+	}
+	checksum := data.Checksum(sql)
+	mig.Checksum = &checksum
+	return nil
+}
+
+func (app *Application) getMigrationDAGHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	env := app.readString(qs, "env", "")
+
+	v := validator.New()
+	v.Check(env != "", "env", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	dag, err := app.Models.SQLMigrationDAG.Get(env)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dag": dag})
+}
+
+func (app *Application) getMigrationTablesHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	env := app.readString(qs, "env", "")
+	prefix := app.readString(qs, "table", "")
+	status := app.readString(qs, "status", "")
+
+	v := validator.New()
+	v.Check(env != "", "env", "must not be empty")
+	v.Check(status == "" || validator.In(status, "applied", "pending"), "status", "must be applied or pending")
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "source_table"),
+		SortSafelist: []string{"source_table", "-source_table"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	migTables, metadata, err := app.Models.SQLMigrationTables.Get(env, prefix, data.SQLMigrationFilter{Status: status}, filters)
+
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrations": migTables, "metadata": metadata})
+}
+
+func (app *Application) listMigrationsHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	env := app.readString(qs, "env", "")
+	table := app.readString(qs, "table", "")
+	status := app.readString(qs, "status", "")
+
+	v := validator.New()
+	v.Check(table != "", "table", "must not be empty")
+	v.Check(status == "" || validator.In(status, "applied", "pending"), "status", "must be applied or pending")
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "file_order"),
+		SortSafelist: data.SQLMigrationSortSafelist,
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	migs, metadata, err := app.Models.SQLMigration.GetAll(table, data.SQLMigrationFilter{Env: env, Status: status}, filters)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrations": migs, "metadata": metadata})
+}
+
+func (app *Application) getMigrationsHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	env := app.readString(qs, "env", "")
+	table := app.readString(qs, "table", "")
+	ref := app.readString(qs, "ref", "")
+
+	v := validator.New()
+	v.Check(env != "", "env", "must not be empty")
+	v.Check(table != "", "table", "must not be empty")
+
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
-	sqlScript, err := app.Models.SQLScript.GetAll(name)
 
+	commit, err := app.GIT.Resolve(ref)
+	if err != nil {
+		app.gitError(c, err)
+		return
+	}
+
+	migs, err := app.Models.SQLMigrationGroup.Get(env, table)
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"files": sqlScript})
+	app.setScripts(migs, commit)
+
+	c.JSON(http.StatusOK, gin.H{"migrations": migs, "commit": commit})
 }
 
-func (app *Application) getFilesHandeler(c *gin.Context) {
+func (app *Application) getAllMigrationsHandeler(c *gin.Context) {
 	qs := c.Request.URL.Query()
-	name := app.readString(qs, "name", "")
+	env := app.readString(qs, "env", "")
+	ref := app.readString(qs, "ref", "")
 
 	v := validator.New()
-	v.Check(name != "", "name", "must not be empty")
+	v.Check(env != "", "env", "must not be empty")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
-	sqlScript, err := app.Models.SQLScript.Get(name)
 
+	commit, err := app.GIT.Resolve(ref)
 	if err != nil {
-		app.badRequest(c, err)
+		app.gitError(c, err)
 		return
 	}
 
-	sql, err := app.GIT.GetFile(sqlScript.FileLocation)
+	groups, err := app.Models.SQLMigrationGroup.GetAll(env)
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	sqlScript.Script = sql
+	for _, migs := range groups {
+		app.setScripts(migs, commit)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"files": sqlScript})
+	c.JSON(http.StatusOK, gin.H{"migrations": groups, "commit": commit})
 }
 
-func (app *Application) registerFilesHandeler(c *gin.Context) {
+// setScripts loads the script of every migration in a group from git as it was at a commit
+func (app *Application) setScripts(migs *data.SQLMigrationGroup, commit string) {
+	for _, m := range append(append([]*data.SQLMigration{}, migs.MigrationsUp...), migs.MigrationsDown...) {
+		sql, err := app.GIT.GetFileAt(m.File, commit)
+
+		if err != nil {
+			m.SetScript("")
+		} else {
+			m.SetScript(sql)
+		}
+	}
+}
+
+func (app *Application) setLatestMigrationHandeler(c *gin.Context) {
 	var input struct {
-		File    string `json:"file"`
-		Project string `json:"project"`
+		SQLMigrationID int    `json:"sql_migration_id"`
+		Env            string `json:"env"`
+		Table          string `json:"table"`
+		Base           bool   `json:"base"`
+		Reason         string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -69,50 +1048,72 @@ func (app *Application) registerFilesHandeler(c *gin.Context) {
 	}
 
 	v := validator.New()
-	v.Check(input.File != "", "file", "must not be empty")
-	v.Check(input.Project != "", "project", "must not be empty")
+	v.Check(input.SQLMigrationID != 0 || input.Base, "sql_migration_id", "must not be empty")
+	v.Check(input.SQLMigrationID == 0 || !input.Base, "base", "must not be set with sql_migration_id")
+	v.Check(input.Env != "", "env", "must not be empty")
+	v.Check(input.Table != "", "table", "must not be empty")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
 
-	sqlScript := data.SQLScript{Project: input.Project, FileLocation: input.File}
-	err := app.Models.SQLScript.Register(&sqlScript)
+	mig := data.SQLMigrationsLatest{
+		SQLMigrationsID: input.SQLMigrationID,
+		Env:             input.Env,
+		Table:           input.Table,
+		ChangedBy:       app.contextGetUserEmail(c),
+		Reason:          input.Reason,
+	}
+	err := app.Models.SQLMigrationsLatest.Update(&mig)
 
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"files": sqlScript})
-
+	c.JSON(http.StatusOK, gin.H{"migrations_latest": mig})
 }
 
-func (app *Application) getProjectsHandeler(c *gin.Context) {
-	qs := c.Request.URL.Query()
-	name := app.readString(qs, "name", "")
+func (app *Application) deleteMigrationsHandeler(c *gin.Context) {
+	var input struct {
+		SQLMigrationID int    `json:"sql_migration_id"`
+		Env            string `json:"env"`
+		Table          string `json:"table"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+	}
 
 	v := validator.New()
-	v.Check(name != "", "name", "must not be empty")
+	v.Check(input.SQLMigrationID != 0, "sql_migration_id", "must not be empty")
+	v.Check(input.Env != "", "env", "must not be empty")
+	v.Check(input.Table != "", "table", "must not be empty")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
-	project, err := app.Models.Project.Get(name)
+
+	mig := data.SQLMigration{ID: input.SQLMigrationID, Env: input.Env, SourceTable: input.Table, ChangedBy: app.contextGetUserEmail(c)}
+	err := app.Models.SQLMigration.Remove(&mig)
+
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"projects": project})
+
+	c.JSON(http.StatusOK, gin.H{"migrations": mig})
 }
 
-func (app *Application) addMigrationsHandeler(c *gin.Context) {
+func (app *Application) updateMigrationsHandeler(c *gin.Context) {
 	var input struct {
-		File  string `json:"file"`
-		Env   string `json:"env"`
-		Table string `json:"table"`
+		SQLMigrationID int    `json:"sql_migration_id"`
+		Env            string `json:"env"`
+		MigratedAtNull bool   `json:"migrated_at_null"`
+		// Checksum is the SHA-256 of the script the client applied
+		Checksum string `json:"checksum"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -120,103 +1121,179 @@ func (app *Application) addMigrationsHandeler(c *gin.Context) {
 	}
 
 	v := validator.New()
-	v.Check(input.File != "", "file", "must not be empty")
+	v.Check(input.SQLMigrationID != 0, "sql_migration_id", "must not be empty")
 	v.Check(input.Env != "", "env", "must not be empty")
-	v.Check(input.Table != "", "table", "must not be empty")
+	v.Check(input.Checksum == "" || validator.Matches(input.Checksum, checksumRX), "checksum", "must be a hex encoded SHA-256")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
 
-	mig := data.SQLMigration{File: input.File, Env: input.Env, SourceTable: input.Table}
-	err := app.Models.SQLMigration.Add(&mig)
+	// the migration has already run against the database, so recording it never fails on git. Clients which do
+	// not send the checksum of the script they ran get the checksum of the file at HEAD when it can be read
+	mig := data.SQLMigration{ID: input.SQLMigrationID, Env: input.Env, MigratedAtNull: input.MigratedAtNull}
+	if !input.MigratedAtNull {
+		checksum := input.Checksum
+		if checksum == "" {
+			applied, err := app.Models.SQLMigration.Get(input.SQLMigrationID)
+			if err == nil {
+				var sql string
+				sql, err = app.GIT.GetFile(applied.File)
+				checksum = data.Checksum(sql)
+			}
+			if err != nil {
+				log.Error("unable to checksum applied migration ", input.SQLMigrationID, ": ", err)
+				checksum = ""
+			}
+		}
+		if checksum != "" {
+			mig.AppliedChecksum = &checksum
+		}
+	}
+	err := app.Models.SQLMigration.Update(&mig)
 
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"migrations": mig})
+	c.JSON(http.StatusOK, gin.H{"migrations": mig})
 }
 
-func (app *Application) getMigrationTablesHandeler(c *gin.Context) {
+func (app *Application) diffMigrationsHandeler(c *gin.Context) {
 	qs := c.Request.URL.Query()
-	env := app.readString(qs, "env", "")
+	source := app.readString(qs, "source", "")
+	target := app.readString(qs, "target", "")
 
 	v := validator.New()
-	v.Check(env != "", "env", "must not be empty")
+	v.Check(source != "", "source", "must not be empty")
+	v.Check(target != "", "target", "must not be empty")
+	v.Check(source != target, "target", "must be different to source")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
 
-	migTables, err := app.Models.SQLMigrationTables.Get(env)
-
+	diff, err := app.Models.SQLMigrationDiff.Get(source, target)
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"migrations": migTables})
+	c.JSON(http.StatusOK, gin.H{"diff": diff})
 }
 
-func (app *Application) getMigrationsHandeler(c *gin.Context) {
-	qs := c.Request.URL.Query()
-	env := app.readString(qs, "env", "")
-	table := app.readString(qs, "table", "")
+func (app *Application) promoteMigrationsHandeler(c *gin.Context) {
+	var input struct {
+		Source         string `json:"source"`
+		Target         string `json:"target"`
+		Table          string `json:"table"`
+		RequireApplied bool   `json:"require_applied"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		app.badRequest(c, err)
+	}
 
 	v := validator.New()
-	v.Check(env != "", "env", "must not be empty")
-	v.Check(table != "", "table", "must not be empty")
+	v.Check(input.Source != "", "source", "must not be empty")
+	v.Check(input.Target != "", "target", "must not be empty")
+	v.Check(input.Table != "", "table", "must not be empty")
+	v.Check(input.Source != input.Target, "target", "must be different to source")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
 
-	migs, err := app.Models.SQLMigrationGroup.Get(env, table)
+	diff, err := app.Models.SQLMigrationDiff.Get(input.Source, input.Target)
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	for _, m := range migs.MigrationsUp {
-		sql, err := app.GIT.GetFile(m.File)
-
-		if err != nil {
-			m.Script = ""
-		} else {
-			m.Script = sql
+	var missing []*data.SQLMigration
+	for _, t := range diff.Tables {
+		if t.Table == input.Table {
+			missing = t.MissingInTarget
 		}
 	}
 
-	for _, m := range migs.MigrationsDown {
-		sql, err := app.GIT.GetFile(m.File)
-
+	sourceDAG, err := app.Models.SQLMigrationDAG.Get(input.Source)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+	position := make(map[int]int)
+	for i, id := range sourceDAG.Order {
+		position[id] = i
+	}
+	// promote in the order of the source env so a migration is added after any it depends on
+	sort.SliceStable(missing, func(i, j int) bool {
+		return position[missing[i].ID] < position[missing[j].ID]
+	})
+
+	// every migration is registered in a single transaction so a failed promotion registers nothing,
+	// a dependency on a migration promoted in the same batch points at its new registration
+	promotedFrom := make(map[int]*data.SQLMigration)
+	var promoted []*data.SQLMigration
+	for _, m := range missing {
+		if input.RequireApplied && m.MigratedAt == nil {
+			app.badRequest(c, fmt.Errorf("migration %s has not been applied in %s", m.File, input.Source))
+			return
+		}
+		mig := data.SQLMigration{File: m.File, Env: input.Target, SourceTable: m.SourceTable, ChangedBy: app.contextGetUserEmail(c)}
+		err = app.setChecksum(&mig)
 		if err != nil {
-			m.Script = ""
-		} else {
-			m.Script = sql
+			app.badRequest(c, err)
+			return
 		}
-
-		m.Script = sql
-
+		for _, d := range sourceDAG.Edges {
+			if d.SQLMigrationID != m.ID || d.Implicit {
+				continue
+			}
+			if batched, ok := promotedFrom[d.DependsOnID]; ok {
+				mig.DependsOn = append(mig.DependsOn, batched)
+				continue
+			}
+			dep, err := app.Models.SQLMigration.Get(d.DependsOnID)
+			if err != nil {
+				app.badRequest(c, err)
+				return
+			}
+			targetDep, err := app.Models.SQLMigration.GetByOrder(input.Target, dep.SourceTable, dep.FileOrder)
+			if err != nil {
+				app.badRequest(c, fmt.Errorf("promote %s to %s first: %w", dep.SourceTable, input.Target, err))
+				return
+			}
+			mig.DependsOn = append(mig.DependsOn, targetDep)
+		}
+		promotedFrom[m.ID] = &mig
+		promoted = append(promoted, &mig)
 	}
+
+	err = app.Models.SQLMigration.AddAll(promoted)
 	if err != nil {
-		app.badRequest(c, err)
+		switch {
+		case errors.Is(err, data.ErrMigrationCycle):
+			v.AddError("table", err.Error())
+			app.failedValidationResponse(c, v.Errors)
+		default:
+			app.badRequest(c, err)
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"migrations": migs})
+	c.JSON(http.StatusCreated, gin.H{"migrations": promoted})
 }
 
-func (app *Application) setLatestMigrationHandeler(c *gin.Context) {
+func (app *Application) syncMigrationsHandeler(c *gin.Context) {
 	var input struct {
-		SQLMigrationID int    `json:"sql_migration_id"`
-		Env            string `json:"env"`
-		Table          string `json:"table"`
+		Dir   string `json:"dir"`
+		Env   string `json:"env"`
+		Table string `json:"table"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -224,7 +1301,7 @@ func (app *Application) setLatestMigrationHandeler(c *gin.Context) {
 	}
 
 	v := validator.New()
-	v.Check(input.SQLMigrationID != 0, "sql_migration_id", "must not be empty")
+	v.Check(input.Dir != "", "dir", "must not be empty")
 	v.Check(input.Env != "", "env", "must not be empty")
 	v.Check(input.Table != "", "table", "must not be empty")
 
@@ -233,22 +1310,126 @@ func (app *Application) setLatestMigrationHandeler(c *gin.Context) {
 		return
 	}
 
-	mig := data.SQLMigrationsLatest{SQLMigrationsID: input.SQLMigrationID, Env: input.Env, Table: input.Table}
-	err := app.Models.SQLMigrationsLatest.Update(&mig)
+	dir := strings.Trim(input.Dir, "/")
+	files, err := app.GIT.ListDir(dir)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
 
+	existing, _, err := app.Models.SQLMigration.GetAll(input.Table, data.SQLMigrationFilter{Env: input.Env}, data.Filters{Sort: "file_order", SortSafelist: data.SQLMigrationSortSafelist})
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"migrations_latest": mig})
+	known := make(map[string]*data.SQLMigration)
+	for _, m := range existing {
+		known[m.File] = m
+	}
+
+	// check the numbering of the whole directory before registering anything
+	orders := make(map[int]string)
+	inGit := make(map[string]bool)
+	var unknown []string
+	for _, f := range files {
+		if !migrationFile.MatchString(path.Base(f)) {
+			continue
+		}
+		order, err := data.FileOrder(f)
+		if err != nil {
+			app.badRequest(c, err)
+			return
+		}
+		if other, ok := orders[order]; ok {
+			app.badRequest(c, fmt.Errorf("migrations %s and %s share order %d", other, f, order))
+			return
+		}
+		orders[order] = f
+		inGit[f] = true
+		if _, ok := known[f]; !ok {
+			unknown = append(unknown, f)
+		}
+	}
+	for _, m := range known {
+		if other, ok := orders[m.FileOrder]; ok && other != m.File {
+			app.badRequest(c, fmt.Errorf("migration %s has the same order as registered migration %s", other, m.File))
+			return
+		}
+	}
+	// numbering may start anywhere, for a directory whose early migrations have been squashed
+	var sorted []int
+	for order := range orders {
+		sorted = append(sorted, order)
+	}
+	sort.Ints(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] != sorted[i-1]+1 {
+			app.badRequest(c, fmt.Errorf("migrations in %s have a gap at order %d", dir, sorted[i-1]+1))
+			return
+		}
+	}
+
+	sort.Slice(unknown, func(i, j int) bool {
+		a, _ := data.FileOrder(unknown[i])
+		b, _ := data.FileOrder(unknown[j])
+		return a < b
+	})
+
+	var registered []*data.SQLMigration
+	for _, f := range unknown {
+		mig := data.SQLMigration{File: f, Env: input.Env, SourceTable: input.Table, ChangedBy: app.contextGetUserEmail(c)}
+		err = app.setChecksum(&mig)
+		if err != nil {
+			app.badRequest(c, err)
+			return
+		}
+		registered = append(registered, &mig)
+	}
+	err = app.Models.SQLMigration.AddAll(registered)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	var missing []*data.SQLMigration
+	for _, m := range existing {
+		if m.Env == input.Env && path.Dir(m.File) == dir && !inGit[m.File] {
+			missing = append(missing, m)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrations": registered, "missing": missing})
 }
 
-func (app *Application) deleteMigrationsHandeler(c *gin.Context) {
+func (app *Application) getLatestMigrationHistoryHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	env := app.readString(qs, "env", "")
+	table := app.readString(qs, "table", "")
+
+	v := validator.New()
+	v.Check(env != "", "env", "must not be empty")
+	v.Check(table != "", "table", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	hist, err := app.Models.SQLMigrationsLatestHistory.GetByEnv(env, table)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": hist})
+}
+
+func (app *Application) undoLatestMigrationHandeler(c *gin.Context) {
 	var input struct {
-		SQLMigrationID int    `json:"sql_migration_id"`
-		Env            string `json:"env"`
-		Table          string `json:"table"`
+		Env    string `json:"env"`
+		Table  string `json:"table"`
+		Reason string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -256,7 +1437,6 @@ func (app *Application) deleteMigrationsHandeler(c *gin.Context) {
 	}
 
 	v := validator.New()
-	v.Check(input.SQLMigrationID != 0, "sql_migration_id", "must not be empty")
 	v.Check(input.Env != "", "env", "must not be empty")
 	v.Check(input.Table != "", "table", "must not be empty")
 
@@ -265,22 +1445,29 @@ func (app *Application) deleteMigrationsHandeler(c *gin.Context) {
 		return
 	}
 
-	mig := data.SQLMigration{ID: input.SQLMigrationID, Env: input.Env, SourceTable: input.Table}
-	err := app.Models.SQLMigration.Remove(&mig)
+	mig := data.SQLMigrationsLatest{
+		Env:       input.Env,
+		Table:     input.Table,
+		ChangedBy: app.contextGetUserEmail(c),
+		Reason:    "undo",
+	}
+	if input.Reason != "" {
+		mig.Reason = "undo: " + input.Reason
+	}
+	err := app.Models.SQLMigrationsLatest.Undo(&mig)
 
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"migrations": mig})
+	c.JSON(http.StatusOK, gin.H{"migrations_latest": mig})
 }
 
-func (app *Application) updateMigrationsHandeler(c *gin.Context) {
+func (app *Application) addMigrationSchemaHandeler(c *gin.Context) {
 	var input struct {
-		SQLMigrationID int    `json:"sql_migration_id"`
-		Env            string `json:"env"`
-		MigratedAtNull bool   `json:"migrated_at_null"`
+		SQLMigrationID int             `json:"sql_migration_id"`
+		Schema         json.RawMessage `json:"schema"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -289,20 +1476,94 @@ func (app *Application) updateMigrationsHandeler(c *gin.Context) {
 
 	v := validator.New()
 	v.Check(input.SQLMigrationID != 0, "sql_migration_id", "must not be empty")
-	v.Check(input.Env != "", "env", "must not be empty")
+	v.Check(len(input.Schema) != 0, "schema", "must not be empty")
 
 	if !v.Valid() {
 		app.failedValidationResponse(c, v.Errors)
 		return
 	}
 
-	mig := data.SQLMigration{ID: input.SQLMigrationID, Env: input.Env, MigratedAtNull: input.MigratedAtNull}
-	err := app.Models.SQLMigration.Update(&mig)
+	mig, err := app.Models.SQLMigration.Get(input.SQLMigrationID)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
 
+	schema := data.SQLMigrationSchema{
+		SQLMigrationID: mig.ID,
+		Env:            mig.Env,
+		SourceTable:    mig.SourceTable,
+		FileOrder:      mig.FileOrder,
+		Schema:         input.Schema,
+	}
+	err = app.Models.SQLMigrationSchema.Add(&schema)
 	if err != nil {
 		app.badRequest(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"migrations": mig})
+	c.JSON(http.StatusCreated, gin.H{"schema": schema})
+}
+
+func (app *Application) getMigrationSchemasHandeler(c *gin.Context) {
+	qs := c.Request.URL.Query()
+	env := app.readString(qs, "env", "")
+	table := app.readString(qs, "table", "")
+
+	v := validator.New()
+	v.Check(env != "", "env", "must not be empty")
+	v.Check(table != "", "table", "must not be empty")
+
+	if !v.Valid() {
+		app.failedValidationResponse(c, v.Errors)
+		return
+	}
+
+	schemas, err := app.Models.SQLMigrationSchema.GetAll(env, table)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schemas": schemas})
+}
+
+func (app *Application) gitStatusHandeler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"git": app.GIT.Status(), "repos": app.Repos.Status()})
+}
+
+func (app *Application) gitPullHandeler(c *gin.Context) {
+	err := app.Repos.Pull()
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"git": app.GIT.Status(), "repos": app.Repos.Status()})
+}
+
+// maxWebhookBody is the largest webhook payload read, push events are well below it
+const maxWebhookBody = 1 << 20
+
+// gitWebhookHandeler pulls when the git host reports a push, the body must be signed with the webhook secret
+// in the X-Hub-Signature-256 header
+func (app *Application) gitWebhookHandeler(c *gin.Context) {
+	// the route is public and the body is read before its signature is checked, so its size is capped
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody)
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		app.badRequest(c, err)
+		return
+	}
+	if app.Config.GitWebhookSecret == "" {
+		app.notFound(c, errors.New("the git webhook is not enabled"))
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(app.Config.GitWebhookSecret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Hub-Signature-256"))) {
+		app.invalidSignatureResponse(c)
+		return
+	}
+	app.gitPullHandeler(c)
 }
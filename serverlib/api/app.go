@@ -1,12 +1,16 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/c-jamie/sql-manager/serverlib/internal/data"
 	"github.com/c-jamie/sql-manager/serverlib/internal/git"
 	"github.com/c-jamie/sql-manager/serverlib/internal/migrations"
+	"github.com/c-jamie/sql-manager/serverlib/log"
 )
 
 type Application struct {
@@ -14,17 +18,42 @@ type Application struct {
 	Models     data.Models
 	Middleware Middleware
 	Migrations migrations.Migrations
-	GIT        git.Repo
+	// GIT is the default repo, used by migrations and by projects which are not bound to a repo
+	GIT git.Repo
+	// Repos holds a clone of every repo in use, including the default
+	Repos *git.Pool
+	// syncMu stops two script syncs registering the same file
+	syncMu sync.Mutex
+	// ctx stops the background work when it is done
+	ctx context.Context
+	// bgMu guards starting background work against Wait
+	bgMu sync.Mutex
+	// bg tracks the background pulls and script syncs
+	bg sync.WaitGroup
 }
 
 type Config struct {
 	Port        int
 	Env         string
 	Version     string
+	// GitURL is cloned into memory, a file:// url is read from a git repo or plain directory on disk
 	GitURL      string
 	GitUserName string
 	GitToken    string
-	Auth        string
+	// GitAuth is one of token, ssh or anonymous, by default it is inferred from the credentials which are set
+	GitAuth             string
+	GitSSHKeyFile       string
+	GitSSHKeyPassphrase string
+	GitKnownHosts       string
+	// GitDir serves the scripts in a directory as they are on disk, in place of GitURL
+	GitDir string
+	// GitSyncOnPull discovers scripts each time the repo pulls new commits
+	GitSyncOnPull bool
+	// GitSyncInterval is how often the repo is pulled in the background, zero disables it
+	GitSyncInterval time.Duration
+	// GitWebhookSecret signs pushes sent to the git webhook, which is disabled when empty
+	GitWebhookSecret string
+	Auth             string
 
 	DB struct {
 		ConnStr      string
@@ -34,18 +63,85 @@ type Config struct {
 	}
 }
 
-func NewApplication(db *sql.DB, cfg *Config) (*Application, error) {
-	git, err := git.New(cfg.GitURL, cfg.GitUserName, cfg.GitToken)
+// NewApplication opens the default repo and starts the background pulls and script syncs, which stop once ctx is done
+func NewApplication(ctx context.Context, db *sql.DB, cfg *Config) (*Application, error) {
+	auth, err := git.ParseAuthKind(cfg.GitAuth)
 	if err != nil {
 		return nil, fmt.Errorf("unable to start app %w", err)
 	}
+	remote := git.Remote{
+		URL:           cfg.GitURL,
+		Auth:          auth,
+		Username:      cfg.GitUserName,
+		Key:           cfg.GitToken,
+		KeyFile:       cfg.GitSSHKeyFile,
+		KeyPassphrase: cfg.GitSSHKeyPassphrase,
+		KnownHosts:    cfg.GitKnownHosts,
+		// no repo can be registered with this ref, so the default repo's clone is never shared
+		CredentialsRef: "SQLM_SER_GIT",
+	}
+	var repo git.Repo
+	if cfg.GitDir != "" {
+		remote = git.Remote{URL: "file://" + cfg.GitDir, CredentialsRef: "SQLM_SER_GIT"}
+		repo, err = git.OpenDir(cfg.GitDir)
+	} else {
+		repo, err = git.Open(remote)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to start app %w", err)
+	}
+	repos := &git.Pool{}
+	repos.Add(remote, repo)
 	app := Application{
 		Config:     cfg,
 		Models:     data.NewModels(db),
-		GIT:        git,
+		GIT:        repo,
+		Repos:      repos,
 		Middleware: NewMiddelware(cfg.Auth, db),
 		Migrations: migrations.Migrations{DB: db},
+		ctx:        ctx,
+	}
+
+	if cfg.GitSyncOnPull {
+		// sync in the background so a webhook is answered once the pull is done
+		repo.OnPull(func() {
+			app.background(func() {
+				_, err := app.syncScripts()
+				if err != nil {
+					log.Error("unable to sync scripts: ", err)
+				}
+			})
+		})
+	}
+
+	if cfg.GitSyncInterval > 0 {
+		app.background(func() {
+			repos.Watch(ctx, cfg.GitSyncInterval)
+		})
 	}
 
 	return &app, nil
 }
+
+// background runs fn in a goroutine which Wait waits for, nothing is started once the app's context is done
+func (app *Application) background(fn func()) {
+	app.bgMu.Lock()
+	defer app.bgMu.Unlock()
+	if app.ctx.Err() != nil {
+		return
+	}
+	app.bg.Add(1)
+	go func() {
+		defer app.bg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until the background pulls and script syncs have finished, it is called once the context passed to
+// NewApplication is done
+func (app *Application) Wait() {
+	// once the lock is released no more background work can start
+	app.bgMu.Lock()
+	app.bgMu.Unlock()
+	app.bg.Wait()
+}
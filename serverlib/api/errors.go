@@ -1,8 +1,11 @@
 package api
 
 import (
-	"github.com/gin-gonic/gin"
+	"errors"
 	"net/http"
+
+	"github.com/c-jamie/sql-manager/serverlib/internal/git"
+	"github.com/gin-gonic/gin"
 )
 
 func (app *Application) failedValidationResponse(c *gin.Context, errors map[string]string) {
@@ -11,4 +14,21 @@ func (app *Application) failedValidationResponse(c *gin.Context, errors map[stri
 
 func (app *Application) badRequest(c *gin.Context, err error) {
 	c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-}
\ No newline at end of file
+}
+
+func (app *Application) notFound(c *gin.Context, err error) {
+	c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+}
+
+func (app *Application) invalidSignatureResponse(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing webhook signature"})
+}
+
+// gitError responds with a 404 when a git ref does not exist
+func (app *Application) gitError(c *gin.Context, err error) {
+	if errors.Is(err, git.ErrRefNotFound) {
+		app.notFound(c, err)
+		return
+	}
+	app.badRequest(c, err)
+}
@@ -1,6 +1,25 @@
 package api
 
-import "net/url"
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/c-jamie/sql-manager/serverlib/internal/data"
+	"github.com/c-jamie/sql-manager/serverlib/internal/git"
+	"github.com/c-jamie/sql-manager/serverlib/internal/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// migrationFile matches migration files named N_name.sql
+var migrationFile = regexp.MustCompile(`^\d+_.*\.sql$`)
+
+// checksumRX matches a hex encoded SHA-256
+var checksumRX = regexp.MustCompile(`^[0-9a-f]{64}$`)
 
 func (app *Application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
@@ -8,4 +27,81 @@ func (app *Application) readString(qs url.Values, key string, defaultValue strin
 		return defaultValue
 	}
 	return s
-}
\ No newline at end of file
+}
+
+func (app *Application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// contextGetUserEmail returns the email of the authenticated user, or an empty string when there is none
+func (app *Application) contextGetUserEmail(c *gin.Context) string {
+	user, ok := c.Value(string(userContextKey)).(*UserAccount)
+	if !ok || user == nil {
+		return ""
+	}
+	return user.Email
+}
+
+// repoFor returns the clone of the git repo a project is bound to, or the default repo for a zero id
+func (app *Application) repoFor(gitRepoID int) (git.Repo, error) {
+	if gitRepoID == 0 {
+		return app.GIT, nil
+	}
+	gitRepo, err := app.Models.GitRepo.GetByID(gitRepoID)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := remoteFor(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	return app.Repos.Get(remote)
+}
+
+// credentialsPrefix is the prefix of the environment variables a credentials_ref is read from, it keeps refs away
+// from the variables of the server itself, the default repo's SQLM_SER_GIT_* among them
+const credentialsPrefix = "SQLM_SER_REPO_"
+
+// credentialsRef matches the refs a repo may be registered with
+var credentialsRef = regexp.MustCompile(`^[A-Z0-9_]+$`)
+
+// validCredentialsRef reports whether a credentials_ref can be used, refs naming the server's own variables are
+// refused even though the prefix keeps them apart, as they can only be a mistake for the default repo's credentials
+func validCredentialsRef(ref string) bool {
+	return validator.Matches(ref, credentialsRef) && !strings.HasPrefix(ref, "SQLM_SER_")
+}
+
+// remoteFor reads the credentials of a git repo from the environment variables prefixed by SQLM_SER_REPO_<ref>:
+// _USERNAME and _TOKEN over https, _SSH_KEY_FILE, _SSH_KEY_PASSPHRASE and _KNOWN_HOSTS over ssh, and _AUTH to
+// pick between them. A repo without a credentials_ref is cloned anonymously
+func remoteFor(gitRepo *data.GitRepo) (git.Remote, error) {
+	remote := git.Remote{URL: gitRepo.URL, Branch: gitRepo.Branch, Auth: git.AuthAnonymous}
+	if gitRepo.CredentialsRef == "" {
+		return remote, nil
+	}
+	if !validCredentialsRef(gitRepo.CredentialsRef) {
+		return git.Remote{}, fmt.Errorf("invalid credentials ref %s", gitRepo.CredentialsRef)
+	}
+	prefix := credentialsPrefix + gitRepo.CredentialsRef
+	auth, err := git.ParseAuthKind(os.Getenv(prefix + "_AUTH"))
+	if err != nil {
+		return git.Remote{}, err
+	}
+	remote.Auth = auth
+	remote.Username = os.Getenv(prefix + "_USERNAME")
+	remote.Key = os.Getenv(prefix + "_TOKEN")
+	remote.KeyFile = os.Getenv(prefix + "_SSH_KEY_FILE")
+	remote.KeyPassphrase = os.Getenv(prefix + "_SSH_KEY_PASSPHRASE")
+	remote.KnownHosts = os.Getenv(prefix + "_KNOWN_HOSTS")
+	remote.CredentialsRef = gitRepo.CredentialsRef
+	return remote, nil
+}
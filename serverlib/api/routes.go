@@ -57,6 +57,8 @@ func (app *Application) Routes() *gin.Engine {
 		c.JSON(200, gin.H{"version": app.Config.Version})
 	})
 
+	public.POST("/git/webhook", app.gitWebhookHandeler)
+
 	private := router.Group("/" + app.Config.Version)
 
 	authenticate := func() gin.HandlerFunc { return app.Middleware.Authenticate }
@@ -68,15 +70,40 @@ func (app *Application) Routes() *gin.Engine {
 	private.GET("/files/list", app.Middleware.Authorize("/users-read"), app.listFilesHandeler)
 	private.GET("/files", app.Middleware.Authorize("/users-write"), app.getFilesHandeler)
 	private.POST("/files", app.Middleware.Authorize("/users-write"), app.registerFilesHandeler)
+	private.PATCH("/files", app.Middleware.Authorize("/users-write"), app.updateFilesHandeler)
+	private.DELETE("/files", app.Middleware.Authorize("/users-write"), app.deleteFilesHandeler)
+	private.GET("/files/history", app.Middleware.Authorize("/users-read"), app.getFileHistoryHandeler)
+	private.GET("/files/diff", app.Middleware.Authorize("/users-read"), app.diffFilesHandeler)
+	private.POST("/sync", app.Middleware.Authorize("/users-write"), app.syncFilesHandeler)
+
+	private.GET("/git/status", app.Middleware.Authorize("/users-read"), app.gitStatusHandeler)
+	private.POST("/git/pull", app.Middleware.Authorize("/users-write"), app.gitPullHandeler)
+	private.GET("/git/repos", app.Middleware.Authorize("/users-read"), app.listGitReposHandeler)
+	private.POST("/git/repos", app.Middleware.Authorize("/users-write"), app.addGitRepoHandeler)
+	private.DELETE("/git/repos", app.Middleware.Authorize("/users-write"), app.deleteGitRepoHandeler)
 
 	private.GET("/projects", app.Middleware.Authorize("/users-write"), app.getProjectsHandeler)
+	private.GET("/projects/list", app.Middleware.Authorize("/users-read"), app.listProjectsHandeler)
+	private.POST("/projects", app.Middleware.Authorize("/users-write"), app.addProjectHandeler)
+	private.PATCH("/projects", app.Middleware.Authorize("/users-write"), app.updateProjectHandeler)
+	private.DELETE("/projects", app.Middleware.Authorize("/users-write"), app.deleteProjectHandeler)
 
 	private.POST("/migrations", app.Middleware.Authorize("/users-write"), app.addMigrationsHandeler)
 	private.GET("/migrations", app.Middleware.Authorize("/users-write"), app.getMigrationsHandeler)
 	private.DELETE("/migrations", app.Middleware.Authorize("/users-write"), app.deleteMigrationsHandeler)
 	private.PATCH("/migrations", app.Middleware.Authorize("/users-write"), app.updateMigrationsHandeler)
+	private.GET("/migrations/all", app.Middleware.Authorize("/users-write"), app.getAllMigrationsHandeler)
 	private.GET("/migrations/table", app.Middleware.Authorize("/users-write"), app.getMigrationTablesHandeler)
+	private.GET("/migrations/list", app.Middleware.Authorize("/users-write"), app.listMigrationsHandeler)
+	private.GET("/migrations/dag", app.Middleware.Authorize("/users-write"), app.getMigrationDAGHandeler)
+	private.GET("/migrations/diff", app.Middleware.Authorize("/users-write"), app.diffMigrationsHandeler)
+	private.POST("/migrations/sync", app.Middleware.Authorize("/users-write"), app.syncMigrationsHandeler)
+	private.POST("/migrations/promote", app.Middleware.Authorize("/users-write"), app.promoteMigrationsHandeler)
+	private.GET("/migrations/schema", app.Middleware.Authorize("/users-write"), app.getMigrationSchemasHandeler)
+	private.POST("/migrations/schema", app.Middleware.Authorize("/users-write"), app.addMigrationSchemaHandeler)
 	private.POST("/migrations/latest", app.Middleware.Authorize("/users-write"), app.setLatestMigrationHandeler)
+	private.GET("/migrations/latest/history", app.Middleware.Authorize("/users-write"), app.getLatestMigrationHistoryHandeler)
+	private.POST("/migrations/latest/undo", app.Middleware.Authorize("/users-write"), app.undoLatestMigrationHandeler)
 
 	return router
 }
@@ -2,12 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/c-jamie/sql-manager/serverlib/api"
 	"github.com/c-jamie/sql-manager/serverlib/db"
@@ -16,6 +22,9 @@ import (
 	"github.com/c-jamie/sql-manager/serverlib/log"
 	"github.com/c-jamie/sql-manager/serverlib/internal/migrations"
 	"github.com/c-jamie/sql-manager/serverlib/internal/mocks"
+	"github.com/go-git/go-billy/v5/util"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/gjson"
 )
@@ -29,20 +38,62 @@ func DoRequest(app *api.Application, json []byte, url string, token string, meth
 	return w.Body, w.Code
 }
 
-func setup() *api.Application {
-	log.New("debug")
+// fixtureFiles are the scripts and migrations committed to the fixture repo
+var fixtureFiles = map[string]string{
+	"proj1/test1.sql":           "select * from proj1/test1.sql\n",
+	"proj1/test2.sql":           "select * from proj1/test2.sql\n",
+	"proj1/a/test1.sql":         "select * from proj1/a/test1.sql\n",
+	"proj1/a/test2.sql":         "select * from proj1/a/test2.sql\n",
+	"proj1/b/test3.sql":         "select * from proj1/b/test3.sql\n",
+	"proj3/test1.sql":           "select * from proj3/test1.sql\n",
+	"proj3/test2.sql":           "select * from proj3/test2.sql\n",
+	"dir1/dir2/1_init.sql":      "-- +migrate Up\ncreate table tb1 (id int);\n\n-- +migrate Down\ndrop table tb1;\n",
+	"dir1/dir2/2_init.sql":      "-- +migrate Up\nalter table tb1 add column name text;\n\n-- +migrate Down\nalter table tb1 drop column name;\n",
+	"dir1/dir2/3_init.sql":      "-- +migrate Up\ncreate table tb2 (id int);\n\n-- +migrate Down\ndrop table tb2;\n",
+	"dir1/dir2/4_init.sql":      "-- +migrate Up\nalter table tb2 add column name text;\n\n-- +migrate Down\nalter table tb2 drop column name;\n",
+	"dir1/customers/1_init.sql": "-- +migrate Up\ncreate table customers (id int primary key);\n\n-- +migrate Down\ndrop table customers;\n",
+	"dir1/orders/1_init.sql":    "-- +migrate Up\ncreate table orders (id int primary key, customer_id int);\n\n-- +migrate Down\ndrop table orders;\n",
+	"dir1/orders/2_fk.sql":      "-- +migrate Up\nalter table orders add foreign key (customer_id) references customers (id);\n\n-- +migrate Down\nalter table orders drop constraint orders_customer_id_fkey;\n",
+}
 
-	gitUserName, ok := os.LookupEnv("SQLM_SER_GIT_USERNAME")
-	if !ok {
-		log.Fatal("unable to load SQLM_SER_GIT_USERNAME")
+// fixture commits the fixture files to a new git repo in a temp dir and returns its file:// url
+func fixture(t *testing.T) string {
+	dir := t.TempDir()
+	r, err := gogit.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
 	}
-	gitToken, ok := os.LookupEnv("SQLM_SER_GIT_TOKEN")
-	if !ok {
-		log.Fatal("unable to load SQLM_SER_GIT_TOKEN")
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
 	}
+	for file, content := range fixtureFiles {
+		err = util.WriteFile(wt.Filesystem, file, []byte(content), 0644)
+		if err == nil {
+			_, err = wt.Add(file)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = wt.Commit("add fixture", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@test.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + dir
+}
+
+func setup(t *testing.T) *api.Application {
+	log.New("debug")
+
+	// the tests run against a fixture repo unless SQLM_SER_GIT_URL points at another one
+	gitUserName := os.Getenv("SQLM_SER_GIT_USERNAME")
+	gitToken := os.Getenv("SQLM_SER_GIT_TOKEN")
 	gitUrl, ok := os.LookupEnv("SQLM_SER_GIT_URL")
 	if !ok {
-		log.Fatal("unable to load SQLM_SER_GIT_URL")
+		gitUrl = fixture(t)
 	}
 	dbHost, ok := os.LookupEnv("SQLM_SER_DB_HOST")
 	if !ok {
@@ -83,18 +134,23 @@ func setup() *api.Application {
 		log.Fatal(err)
 	}
 
-	git, err := git.New(gitUrl, gitUserName, gitToken)
+	remote := git.Remote{URL: gitUrl, Username: gitUserName, Key: gitToken}
+	repo, err := git.Open(remote)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	repos := &git.Pool{}
+	repos.Add(remote, repo)
+
 	app := api.Application{
 		Config:     &cfg,
 		Models:     data.NewModels(db),
 		Middleware: &mocks.MockMiddleware{},
 		Migrations: migrations.Migrations{DB: db},
-		GIT:        git,
+		GIT:        repo,
+		Repos:      repos,
 	}
 	app.Migrations.DoMigrations("up")
 
@@ -102,7 +158,7 @@ func setup() *api.Application {
 }
 
 func TestPingRoute(t *testing.T) {
-	app := setup()
+	app := setup(t)
 	testRouter := app.Routes()
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/v1/ping", nil)
@@ -128,7 +184,7 @@ func TestScriptRegister(t *testing.T) {
 			expect: "must not be empty",
 		},
 	}
-	app := setup()
+	app := setup(t)
 
 	for _, tcase := range testcases {
 		out, code := DoRequest(app, tcase.in, "/v1/files", "", http.MethodPost)
@@ -157,7 +213,7 @@ func TestScriptGet(t *testing.T) {
 			expect: "must not be empty",
 		},
 	}
-	app := setup()
+	app := setup(t)
 
 	for _, tcase := range testcases {
 		app.Models.SQLScript.Register(&tcase.model)
@@ -192,7 +248,7 @@ func TestProjectGet(t *testing.T) {
 			expect: "must not be empty",
 		},
 	}
-	app := setup()
+	app := setup(t)
 
 	for _, tcase := range testcases {
 		for _, m := range tcase.model {
@@ -223,7 +279,7 @@ func TestFilesListAll(t *testing.T) {
 			expect: "files",
 		},
 	}
-	app := setup()
+	app := setup(t)
 
 	for _, tcase := range testcases {
 		for _, m := range tcase.model {
@@ -257,7 +313,7 @@ func TestAddMigration(t *testing.T) {
 			expect: "dir1-dir2-2_init-sql",
 		},
 	}
-	app := setup()
+	app := setup(t)
 	for _, tcase := range testcases {
 		out, code := DoRequest(app, tcase.in, "/v1/migrations", "", http.MethodPost)
 		assert.Equal(t, tcase.code, code)
@@ -284,7 +340,7 @@ func TestGetMigration(t *testing.T) {
 			url:   "/v1/migrations?env=deb&table=db.sch.table1",
 		},
 	}
-	app := setup()
+	app := setup(t)
 	for _, tcase := range testcases {
 		mig := data.SQLMigration{File: tcase.file, Env: tcase.env, SourceTable: tcase.table}
 		err := app.Models.SQLMigration.Add(&mig)
@@ -316,7 +372,7 @@ func TestDeleteMigration(t *testing.T) {
 			},
 		},
 	}
-	app := setup()
+	app := setup(t)
 	for _, tcase := range testcases {
 		for _, m := range tcase.models {
 			err := app.Models.SQLMigration.Add(&m)
@@ -351,7 +407,7 @@ func TestSetLatestMigration(t *testing.T) {
 				{File: "dir1/dir2/2_init.sql", Env: "dev", SourceTable: "db.sch.tb1"}},
 		},
 	}
-	app := setup()
+	app := setup(t)
 	for _, tcase := range testcases {
 		for _, m := range tcase.models {
 			err := app.Models.SQLMigration.Add(&m)
@@ -386,7 +442,7 @@ func TestListMigrationTables(t *testing.T) {
 			},
 		},
 	}
-	app := setup()
+	app := setup(t)
 	for _, tcase := range testcases {
 		for _, m := range tcase.models {
 			err := app.Models.SQLMigration.Add(&m)
@@ -419,7 +475,7 @@ func TestUpdateMigration(t *testing.T) {
 			},
 		},
 	}
-	app := setup()
+	app := setup(t)
 	for _, tcase := range testcases {
 		for _, m := range tcase.models {
 			err := app.Models.SQLMigration.Add(&m)
@@ -431,3 +487,725 @@ func TestUpdateMigration(t *testing.T) {
 	}
 	app.Migrations.DoMigrations("down")
 }
+
+func TestMigrationChecksum(t *testing.T) {
+	testcases := []struct {
+		add   []byte
+		in    []byte
+		code  int
+		url   string
+		file  string
+		added int
+	}{
+		{
+			add:   []byte(`{"file":"dir1/dir2/1_init.sql", "env":"dev", "table":"db.sch.tb1"}`),
+			in:    []byte(`{"sql_migration_id":1, "env":"dev", "migrated_at_null": false}`),
+			code:  http.StatusOK,
+			url:   "/v1/migrations?env=dev&table=db.sch.tb1",
+			file:  "dir1/dir2/1_init.sql",
+			added: http.StatusCreated,
+		},
+		{
+			add:   []byte(`{"file":"dir1/dir2/missing.sql", "env":"dev", "table":"db.sch.tb2"}`),
+			added: http.StatusBadRequest,
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		_, code := DoRequest(app, tcase.add, "/v1/migrations", "", http.MethodPost)
+		assert.Equal(t, tcase.added, code)
+		if tcase.added != http.StatusCreated {
+			continue
+		}
+		sql, err := app.GIT.GetFile(tcase.file)
+		assert.Equal(t, nil, err)
+		_, code = DoRequest(app, tcase.in, "/v1/migrations", "", http.MethodPatch)
+		assert.Equal(t, tcase.code, code)
+		out, code := DoRequest(app, []byte(""), tcase.url, "", http.MethodGet)
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, data.Checksum(sql), gjson.Get(out.String(), "migrations.migrations_up.0.current_checksum").Str)
+		assert.Equal(t, data.Checksum(sql), gjson.Get(out.String(), "migrations.migrations_up.0.applied_checksum").Str)
+		assert.Equal(t, false, gjson.Get(out.String(), "migrations.migrations_up.0.modified").Bool())
+		t.Log(out.String())
+	}
+
+	// the checksum of the script the client ran is recorded rather than that of the file in git
+	ran := data.Checksum("-- +migrate Up\ncreate table tb1 (id int, name text);\n")
+	_, code := DoRequest(app, []byte(fmt.Sprintf(`{"sql_migration_id":1, "env":"dev", "migrated_at_null": false, "checksum":"%s"}`, ran)), "/v1/migrations", "", http.MethodPatch)
+	assert.Equal(t, http.StatusOK, code)
+	out, _ := DoRequest(app, []byte(""), "/v1/migrations?env=dev&table=db.sch.tb1", "", http.MethodGet)
+	assert.Equal(t, ran, gjson.Get(out.String(), "migrations.migrations_up.0.applied_checksum").Str)
+	assert.Equal(t, true, gjson.Get(out.String(), "migrations.migrations_up.0.modified").Bool())
+	_, code = DoRequest(app, []byte(`{"sql_migration_id":1, "env":"dev", "migrated_at_null": false, "checksum":"abc"}`), "/v1/migrations", "", http.MethodPatch)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	app.Migrations.DoMigrations("down")
+}
+
+func TestMigrationDAG(t *testing.T) {
+	testcases := []struct {
+		in     [][]byte
+		code   int
+		url    string
+		expect []int64
+	}{
+		{
+			in: [][]byte{
+				[]byte(`{"file":"dir1/orders/1_init.sql", "env":"dev", "table":"db.sch.orders"}`),
+				[]byte(`{"file":"dir1/customers/1_init.sql", "env":"dev", "table":"db.sch.customers"}`),
+				[]byte(`{"file":"dir1/orders/2_fk.sql", "env":"dev", "table":"db.sch.orders", "depends_on": [{"table": "db.sch.customers", "order": 1}]}`),
+			},
+			code:   http.StatusOK,
+			url:    "/v1/migrations/dag?env=dev",
+			expect: []int64{2, 1, 3},
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		for _, in := range tcase.in {
+			_, code := DoRequest(app, in, "/v1/migrations", "", http.MethodPost)
+			assert.Equal(t, http.StatusCreated, code)
+		}
+		out, code := DoRequest(app, []byte(""), tcase.url, "", http.MethodGet)
+		assert.Equal(t, tcase.code, code)
+		var order []int64
+		for _, id := range gjson.Get(out.String(), "dag.order").Array() {
+			order = append(order, id.Int())
+		}
+		assert.Equal(t, tcase.expect, order)
+		t.Log(out.String())
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestMigrationCycle(t *testing.T) {
+	testcases := []struct {
+		in   []byte
+		code int
+	}{
+		{[]byte(`{"file":"dir1/dir2/2_init.sql", "env":"dev", "table":"db.sch.a"}`), http.StatusCreated},
+		{[]byte(`{"file":"dir1/dir2/1_init.sql", "env":"dev", "table":"db.sch.b", "depends_on": [{"table": "db.sch.a", "order": 2}]}`), http.StatusCreated},
+		// 1_init is applied before 2_init in db.sch.a, which already depends on db.sch.b through it
+		{[]byte(`{"file":"dir1/dir2/1_init.sql", "env":"dev", "table":"db.sch.a", "depends_on": [{"table": "db.sch.b", "order": 1}]}`), http.StatusUnprocessableEntity},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, tcase.in, "/v1/migrations", "", http.MethodPost)
+		assert.Equal(t, tcase.code, code)
+		t.Log(out.String())
+	}
+	out, code := DoRequest(app, []byte(""), "/v1/migrations/dag?env=dev", "", http.MethodGet)
+	assert.Equal(t, http.StatusOK, code)
+	// the rejected migration and its dependency are not left behind
+	assert.Equal(t, int64(2), gjson.Get(out.String(), "dag.nodes.#").Int())
+	assert.Equal(t, int64(1), gjson.Get(out.String(), "dag.edges.#").Int())
+	app.Migrations.DoMigrations("down")
+}
+
+func TestMigrationDiffPromote(t *testing.T) {
+	testcases := []struct {
+		in      [][]byte
+		promote []byte
+		code    int
+		expect  int
+	}{
+		{
+			in: [][]byte{
+				[]byte(`{"file":"dir1/orders/1_init.sql", "env":"dev", "table":"db.sch.orders"}`),
+				[]byte(`{"file":"dir1/orders/2_fk.sql", "env":"dev", "table":"db.sch.orders"}`),
+				[]byte(`{"file":"dir1/orders/1_init.sql", "env":"prod", "table":"db.sch.orders"}`),
+			},
+			promote: []byte(`{"source":"dev", "target":"prod", "table":"db.sch.orders", "require_applied": false}`),
+			code:    http.StatusCreated,
+			expect:  1,
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		for _, in := range tcase.in {
+			_, code := DoRequest(app, in, "/v1/migrations", "", http.MethodPost)
+			assert.Equal(t, http.StatusCreated, code)
+		}
+		out, code := DoRequest(app, []byte(""), "/v1/migrations/diff?source=dev&target=prod", "", http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(tcase.expect), gjson.Get(out.String(), "diff.tables.0.missing_in_target.#").Int())
+		out, code = DoRequest(app, tcase.promote, "/v1/migrations/promote", "", http.MethodPost)
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, int64(tcase.expect), gjson.Get(out.String(), "migrations.#").Int())
+		out, code = DoRequest(app, []byte(""), "/v1/migrations/diff?source=dev&target=prod", "", http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(0), gjson.Get(out.String(), "diff.tables.#").Int())
+		t.Log(out.String())
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestMigrationPromoteAtomic(t *testing.T) {
+	app := setup(t)
+	for _, in := range [][]byte{
+		[]byte(`{"file":"dir1/customers/1_init.sql", "env":"dev", "table":"db.sch.customers"}`),
+		[]byte(`{"file":"dir1/orders/1_init.sql", "env":"dev", "table":"db.sch.orders"}`),
+		[]byte(`{"file":"dir1/orders/2_fk.sql", "env":"dev", "table":"db.sch.orders", "depends_on": [{"table": "db.sch.customers", "order": 1}]}`),
+	} {
+		_, code := DoRequest(app, in, "/v1/migrations", "", http.MethodPost)
+		assert.Equal(t, http.StatusCreated, code)
+	}
+	// 2_fk depends on customers which is not in prod yet, so 1_init must not be registered either
+	_, code := DoRequest(app, []byte(`{"source":"dev", "target":"prod", "table":"db.sch.orders"}`), "/v1/migrations/promote", "", http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, code)
+	out, code := DoRequest(app, []byte(""), "/v1/migrations/dag?env=prod", "", http.MethodGet)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(0), gjson.Get(out.String(), "dag.nodes.#").Int())
+
+	for _, table := range []string{"db.sch.customers", "db.sch.orders"} {
+		out, code = DoRequest(app, []byte(`{"source":"dev", "target":"prod", "table":"`+table+`"}`), "/v1/migrations/promote", "", http.MethodPost)
+		assert.Equal(t, http.StatusCreated, code)
+	}
+	out, code = DoRequest(app, []byte(""), "/v1/migrations/dag?env=prod", "", http.MethodGet)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(3), gjson.Get(out.String(), "dag.nodes.#").Int())
+	// the implicit edge within orders and the promoted dependency on customers
+	assert.Equal(t, int64(2), gjson.Get(out.String(), "dag.edges.#").Int())
+	t.Log(out.String())
+	app.Migrations.DoMigrations("down")
+}
+
+func TestSyncMigrations(t *testing.T) {
+	app := setup(t)
+	mock := &mocks.MockRepo{Dirs: map[string][]string{
+		"dir1/orders": {"dir1/orders/1_init.sql", "dir1/orders/2_fk.sql", "dir1/orders/README.md"},
+		"dir1/gap":    {"dir1/gap/1_init.sql", "dir1/gap/3_fk.sql"},
+		"dir1/dupe":   {"dir1/dupe/1_init.sql", "dir1/dupe/1_fk.sql"},
+		"dir1/later":  {"dir1/later/4_init.sql", "dir1/later/5_fk.sql"},
+	}}
+	app.GIT = mock
+	testcases := []struct {
+		in         []byte
+		files      []string
+		code       int
+		registered int64
+		missing    string
+	}{
+		{in: []byte(`{"dir":"dir1/orders", "env":"dev", "table":"db.sch.orders"}`), code: http.StatusOK, registered: 2},
+		{in: []byte(`{"dir":"dir1/orders", "env":"dev", "table":"db.sch.orders"}`), code: http.StatusOK, registered: 0},
+		{in: []byte(`{"dir":"dir1/orders/", "env":"dev", "table":"db.sch.orders"}`), files: []string{"dir1/orders/1_init.sql"}, code: http.StatusOK, registered: 0, missing: "dir1/orders/2_fk.sql"},
+		{in: []byte(`{"dir":"dir1/gap", "env":"dev", "table":"db.sch.gap"}`), code: http.StatusBadRequest},
+		{in: []byte(`{"dir":"dir1/dupe", "env":"dev", "table":"db.sch.dupe"}`), code: http.StatusBadRequest},
+		{in: []byte(`{"dir":"dir1/later", "env":"dev", "table":"db.sch.later"}`), code: http.StatusOK, registered: 2},
+		{in: []byte(`{"dir":"", "env":"dev", "table":"db.sch.orders"}`), code: http.StatusUnprocessableEntity},
+	}
+	for _, tcase := range testcases {
+		if tcase.files != nil {
+			mock.Dirs["dir1/orders"] = tcase.files
+		}
+		out, code := DoRequest(app, tcase.in, "/v1/migrations/sync", "", http.MethodPost)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		if code != http.StatusOK {
+			continue
+		}
+		assert.Equal(t, tcase.registered, gjson.Get(out.String(), "migrations.#").Int())
+		assert.Equal(t, tcase.missing, gjson.Get(out.String(), "missing.0.file").Str)
+	}
+	out, code := DoRequest(app, []byte(""), "/v1/migrations/dag?env=dev", "", http.MethodGet)
+	assert.Equal(t, http.StatusOK, code)
+	// nothing is registered for a directory which fails its numbering check
+	assert.Equal(t, int64(4), gjson.Get(out.String(), "dag.nodes.#").Int())
+	app.Migrations.DoMigrations("down")
+}
+
+func TestSetBaseMigration(t *testing.T) {
+	testcases := []struct {
+		in     []byte
+		code   int
+		url    string
+		up     int64
+		down   int64
+		models []data.SQLMigration
+	}{
+		{
+			in:   []byte(`{"base":true, "env":"dev", "table":"db.sch.tb1"}`),
+			code: http.StatusOK,
+			url:  "/v1/migrations/latest",
+			up:   0,
+			down: 2,
+			models: []data.SQLMigration{
+				{File: "dir1/dir2/1_init.sql", Env: "dev", SourceTable: "db.sch.tb1"},
+				{File: "dir1/dir2/2_init.sql", Env: "dev", SourceTable: "db.sch.tb1"}},
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		for _, m := range tcase.models {
+			err := app.Models.SQLMigration.Add(&m)
+			assert.Equal(t, err, nil)
+		}
+		_, code := DoRequest(app, tcase.in, tcase.url, "", http.MethodPost)
+		assert.Equal(t, tcase.code, code)
+		out, code := DoRequest(app, []byte(""), "/v1/migrations?env=dev&table=db.sch.tb1", "", http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, tcase.up, gjson.Get(out.String(), "migrations.migrations_up.#").Int())
+		assert.Equal(t, tcase.down, gjson.Get(out.String(), "migrations.migrations_down.#").Int())
+		t.Log(out.String())
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestLatestMigrationHistoryUndo(t *testing.T) {
+	testcases := []struct {
+		in      []byte
+		code    int
+		history int64
+		expect  []int64
+		models  []data.SQLMigration
+	}{
+		{
+			in:      []byte(`{"sql_migration_id":1, "env":"dev", "table":"db.sch.tb1", "reason":"roll back"}`),
+			code:    http.StatusOK,
+			history: 3,
+			// each undo steps further back, past the set to 1, then the add of 2, then the add of 1
+			expect: []int64{2, 1, 0},
+			models: []data.SQLMigration{
+				{File: "dir1/dir2/1_init.sql", Env: "dev", SourceTable: "db.sch.tb1"},
+				{File: "dir1/dir2/2_init.sql", Env: "dev", SourceTable: "db.sch.tb1"}},
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		for _, m := range tcase.models {
+			err := app.Models.SQLMigration.Add(&m)
+			assert.Equal(t, err, nil)
+		}
+		_, code := DoRequest(app, tcase.in, "/v1/migrations/latest", "", http.MethodPost)
+		assert.Equal(t, tcase.code, code)
+		out, code := DoRequest(app, []byte(""), "/v1/migrations/latest/history?env=dev&table=db.sch.tb1", "", http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, tcase.history, gjson.Get(out.String(), "history.#").Int())
+		assert.Equal(t, "roll back", gjson.Get(out.String(), "history.0.reason").String())
+		for _, expect := range tcase.expect {
+			out, code = DoRequest(app, []byte(`{"env":"dev", "table":"db.sch.tb1"}`), "/v1/migrations/latest/undo", "", http.MethodPost)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, expect, gjson.Get(out.String(), "migrations_latest.sql_migrations_id").Int())
+			t.Log(out.String())
+		}
+		out, code = DoRequest(app, []byte(`{"env":"dev", "table":"db.sch.tb1"}`), "/v1/migrations/latest/undo", "", http.MethodPost)
+		assert.Equal(t, http.StatusBadRequest, code)
+		out, code = DoRequest(app, []byte(""), "/v1/migrations/latest/history?env=dev&table=db.sch.tb1", "", http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, tcase.history+int64(len(tcase.expect)), gjson.Get(out.String(), "history.#").Int())
+		// the last undo reverted the first change
+		assert.Equal(t, gjson.Get(out.String(), "history.5.id").Int(), gjson.Get(out.String(), "history.0.undoes_id").Int())
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestMigrationSchema(t *testing.T) {
+	testcases := []struct {
+		in     []byte
+		code   int
+		expect string
+		models []data.SQLMigration
+	}{
+		{
+			in:     []byte(`{"sql_migration_id":1, "schema": {"table": "db.sch.tb1", "columns": [{"name": "id", "type": "integer", "nullable": false}], "indexes": []}}`),
+			code:   http.StatusCreated,
+			expect: "id",
+			models: []data.SQLMigration{
+				{File: "dir1/dir2/1_init.sql", Env: "dev", SourceTable: "db.sch.tb1"}},
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		for _, m := range tcase.models {
+			err := app.Models.SQLMigration.Add(&m)
+			assert.Equal(t, err, nil)
+		}
+		_, code := DoRequest(app, tcase.in, "/v1/migrations/schema", "", http.MethodPost)
+		assert.Equal(t, tcase.code, code)
+		out, code := DoRequest(app, []byte(""), "/v1/migrations/schema?env=dev&table=db.sch.tb1", "", http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, tcase.expect, gjson.Get(out.String(), "schemas.0.schema.columns.0.name").String())
+		t.Log(out.String())
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestGetAllMigrations(t *testing.T) {
+	testcases := []struct {
+		in     [][]byte
+		code   int
+		url    string
+		expect int64
+	}{
+		{
+			in: [][]byte{
+				[]byte(`{"file":"dir1/orders/1_init.sql", "env":"dev", "table":"db.sch.orders"}`),
+				[]byte(`{"file":"dir1/customers/1_init.sql", "env":"dev", "table":"db.sch.customers"}`),
+				[]byte(`{"file":"dir1/orders/1_init.sql", "env":"prod", "table":"db.sch.orders"}`),
+			},
+			code:   http.StatusOK,
+			url:    "/v1/migrations/all?env=dev",
+			expect: 2,
+		},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		for _, in := range tcase.in {
+			_, code := DoRequest(app, in, "/v1/migrations", "", http.MethodPost)
+			assert.Equal(t, http.StatusCreated, code)
+		}
+		out, code := DoRequest(app, []byte(""), tcase.url, "", http.MethodGet)
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, tcase.expect, gjson.Get(out.String(), "migrations.#").Int())
+		assert.Equal(t, int64(1), gjson.Get(out.String(), "migrations.0.migrations_up.#").Int())
+		t.Log(out.String())
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestListPagination(t *testing.T) {
+	testcases := []struct {
+		url   string
+		code  int
+		count int64
+		total int64
+		first string
+		path  string
+	}{
+		{url: "/v1/files/list?project=test1&page_size=2", code: http.StatusOK, count: 2, total: 3, first: "proj1/a/test1.sql", path: "files"},
+		{url: "/v1/files/list?project=test1&page_size=2&page=2", code: http.StatusOK, count: 1, total: 3, first: "proj1/b/test3.sql", path: "files"},
+		{url: "/v1/files/list?project=test1&prefix=proj1/b/&sort=-file_location", code: http.StatusOK, count: 1, total: 1, first: "proj1/b/test3.sql", path: "files"},
+		{url: "/v1/migrations/table?env=dev&page_size=1&sort=-source_table", code: http.StatusOK, count: 1, total: 2, first: "db.sch.tb2", path: "migrations.tables"},
+		{url: "/v1/migrations/table?env=dev&table=db.sch.tb1&status=pending", code: http.StatusOK, count: 1, total: 1, first: "db.sch.tb1", path: "migrations.tables"},
+		{url: "/v1/migrations/list?env=dev&table=db.sch.tb1&page_size=1", code: http.StatusOK, count: 1, total: 2, first: "dir1/dir2/1_init.sql", path: "migrations"},
+		{url: "/v1/migrations/list?env=dev&table=db.sch.tb1&sort=-file_order", code: http.StatusOK, count: 2, total: 2, first: "dir1/dir2/3_init.sql", path: "migrations"},
+		{url: "/v1/migrations/list?table=db.sch.tb2", code: http.StatusOK, count: 1, total: 1, first: "dir1/dir2/2_init.sql", path: "migrations"},
+		{url: "/v1/files/list?project=test1&sort=location", code: http.StatusUnprocessableEntity},
+		{url: "/v1/migrations/table?env=dev&page_size=101", code: http.StatusUnprocessableEntity},
+		{url: "/v1/migrations/list?env=dev&table=db.sch.tb1&sort=file", code: http.StatusUnprocessableEntity},
+		{url: "/v1/migrations/list?env=dev", code: http.StatusUnprocessableEntity},
+	}
+	scripts := []data.SQLScript{
+		{FileLocation: "proj1/a/test2.sql", Project: "test1"},
+		{FileLocation: "proj1/b/test3.sql", Project: "test1"},
+		{FileLocation: "proj1/a/test1.sql", Project: "test1"},
+	}
+	migs := []data.SQLMigration{
+		{File: "dir1/dir2/1_init.sql", Env: "dev", SourceTable: "db.sch.tb1"},
+		{File: "dir1/dir2/2_init.sql", Env: "dev", SourceTable: "db.sch.tb2"},
+		{File: "dir1/dir2/3_init.sql", Env: "dev", SourceTable: "db.sch.tb1"},
+	}
+	app := setup(t)
+	for _, m := range scripts {
+		app.Models.SQLScript.Register(&m)
+	}
+	for _, m := range migs {
+		err := app.Models.SQLMigration.Add(&m)
+		assert.Equal(t, err, nil)
+	}
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, []byte(""), tcase.url, "", http.MethodGet)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		if tcase.code != http.StatusOK {
+			continue
+		}
+		assert.Equal(t, tcase.count, gjson.Get(out.String(), tcase.path+".#").Int())
+		assert.Equal(t, tcase.total, gjson.Get(out.String(), "metadata.total_records").Int())
+		first := gjson.Get(out.String(), tcase.path+".0.file_location").String()
+		switch tcase.path {
+		case "migrations":
+			first = gjson.Get(out.String(), tcase.path+".0.file").String()
+		case "migrations.tables":
+			first = gjson.Get(out.String(), tcase.path+".0.table").String()
+		}
+		assert.Equal(t, tcase.first, first)
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestProjectCRUD(t *testing.T) {
+	testcases := []struct {
+		in     []byte
+		url    string
+		method string
+		code   int
+		expect string
+	}{
+		{in: []byte(`{"name":"proj1", "description":"first"}`), url: "/v1/projects", method: http.MethodPost, code: http.StatusCreated, expect: "first"},
+		{in: []byte(`{"name":"proj1"}`), url: "/v1/projects", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "already exists"},
+		{in: []byte(`{"name":"proj2"}`), url: "/v1/projects", method: http.MethodPost, code: http.StatusCreated, expect: "proj2"},
+		{in: []byte(`{"name":"proj2", "new_name":"proj1"}`), url: "/v1/projects", method: http.MethodPatch, code: http.StatusUnprocessableEntity, expect: "already exists"},
+		{in: []byte(`{"name":"proj2", "new_name":"proj3", "description":"renamed"}`), url: "/v1/projects", method: http.MethodPatch, code: http.StatusOK, expect: "proj3"},
+		{in: []byte(""), url: "/v1/projects/list?sort=-name", method: http.MethodGet, code: http.StatusOK, expect: `"total_records":2`},
+		{in: []byte(`{"name":"proj1"}`), url: "/v1/projects", method: http.MethodDelete, code: http.StatusOK, expect: "deleted"},
+		{in: []byte(`{"name":"proj1"}`), url: "/v1/projects", method: http.MethodDelete, code: http.StatusNotFound, expect: "does not exist"},
+		{in: []byte(""), url: "/v1/projects?name=proj1", method: http.MethodGet, code: http.StatusNotFound, expect: "does not exist"},
+		{in: []byte(`{"name":"proj1"}`), url: "/v1/projects", method: http.MethodPost, code: http.StatusCreated, expect: "proj1"},
+	}
+	app := setup(t)
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, tcase.in, tcase.url, "", tcase.method)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, strings.Contains(out.String(), tcase.expect), true)
+	}
+
+	// registering scripts reuses the project rather than duplicating it
+	for _, m := range []data.SQLScript{{FileLocation: "proj3/test1.sql", Project: "proj3"}, {FileLocation: "proj3/test2.sql", Project: "proj3"}} {
+		err := app.Models.SQLScript.Register(&m)
+		assert.Equal(t, err, nil)
+	}
+	out, code := DoRequest(app, []byte(""), "/v1/projects/list", "", http.MethodGet)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(2), gjson.Get(out.String(), "metadata.total_records").Int())
+	app.Migrations.DoMigrations("down")
+}
+
+func TestScriptUpdateRemove(t *testing.T) {
+	testcases := []struct {
+		in     []byte
+		url    string
+		method string
+		code   int
+		expect string
+	}{
+		{in: []byte(`{"name":"proj1-test1-sql", "project":"missing"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusUnprocessableEntity, expect: "must exist"},
+		{in: []byte(""), url: "/v1/projects?name=missing", method: http.MethodGet, code: http.StatusNotFound, expect: "does not exist"},
+		{in: []byte(`{"name":"proj1-test1-sql", "project":"test2"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusOK, expect: `"project":"test2"`},
+		{in: []byte(""), url: "/v1/files/list?project=test2", method: http.MethodGet, code: http.StatusOK, expect: "proj1/test1.sql"},
+		{in: []byte(`{"name":"proj1-test1-sql", "file":"proj1/missing.sql"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusUnprocessableEntity, expect: "must exist in git"},
+		{in: []byte(`{"name":"proj1-test1-sql", "file":"proj1/test2.sql"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusUnprocessableEntity, expect: "already registered"},
+		{in: []byte(`{"name":"proj1-test1-sql"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusUnprocessableEntity, expect: "must be provided"},
+		{in: []byte(`{"name":"proj1-test1-sql", "file":"proj1/a/test1.sql"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusOK, expect: `"snippit_name":"proj1-a-test1-sql"`},
+		{in: []byte(""), url: "/v1/files?name=proj1-test1-sql", method: http.MethodGet, code: http.StatusNotFound, expect: "does not exist"},
+		{in: []byte(`{"name":"proj1-a-test1-sql"}`), url: "/v1/files", method: http.MethodDelete, code: http.StatusOK, expect: "removed"},
+		{in: []byte(""), url: "/v1/files?name=proj1-a-test1-sql", method: http.MethodGet, code: http.StatusNotFound, expect: "does not exist"},
+		{in: []byte(`{"name":"proj1-a-test1-sql"}`), url: "/v1/files", method: http.MethodDelete, code: http.StatusNotFound, expect: "does not exist"},
+		{in: []byte(""), url: "/v1/files?name=proj1-test2-sql", method: http.MethodGet, code: http.StatusOK, expect: "proj1/test2.sql"},
+	}
+	app := setup(t)
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/test1.sql", Project: "test1"})
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/test2.sql", Project: "test2"})
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, tcase.in, tcase.url, "", tcase.method)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, strings.Contains(out.String(), tcase.expect), true)
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestScriptSync(t *testing.T) {
+	app := setup(t)
+	directive := "/*\n[sqlmbegin]\n[script]\n\t- description: \"test\"\n[sqlmend]\n*/\nselect 1\n"
+	app.GIT = &mocks.MockRepo{
+		Scripts: map[string]string{
+			"proj2/new.sql":       directive,
+			"proj1/new/moved.sql": directive + "select 2\n",
+			"proj4/report.sql":    directive + "select 3\n",
+			"proj1/plain.sql":     "select 1",
+			"root.sql":            directive,
+		},
+		Deleted: map[string]string{
+			"proj1/old/moved.sql":  directive + "select 2\n",
+			"proj1/old/report.sql": directive + "select 4\n",
+		},
+	}
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/test1.sql", Project: "proj1"})
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/deleted.sql", Project: "proj1"})
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/old/moved.sql", Project: "proj1"})
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/old/report.sql", Project: "proj1"})
+	out, code := DoRequest(app, []byte(""), "/v1/sync", "", http.MethodPost)
+	t.Log(out.String())
+	assert.Equal(t, http.StatusCreated, code)
+	// a file at the root of the repo has no project and is skipped
+	assert.Equal(t, int64(2), gjson.Get(out.String(), "sync.added.#").Int())
+	assert.Equal(t, "proj2/new.sql", gjson.Get(out.String(), "sync.added.0").Str)
+	assert.Equal(t, "proj4/report.sql", gjson.Get(out.String(), "sync.added.1").Str)
+	// only the file with the same content is a rename, a new file sharing a file name is not
+	assert.Equal(t, int64(1), gjson.Get(out.String(), "sync.moved.#").Int())
+	assert.Equal(t, "proj1/old/moved.sql -> proj1/new/moved.sql", gjson.Get(out.String(), "sync.moved.0").Str)
+	assert.Equal(t, int64(2), gjson.Get(out.String(), "sync.removed.#").Int())
+	assert.Equal(t, true, strings.Contains(gjson.Get(out.String(), "sync.removed").Raw, "proj1/deleted.sql"))
+	assert.Equal(t, true, strings.Contains(gjson.Get(out.String(), "sync.removed").Raw, "proj1/old/report.sql"))
+	out, code = DoRequest(app, []byte(""), "/v1/files/list?project=proj1", "", http.MethodGet)
+	t.Log(out.String())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, strings.Contains(out.String(), "proj1/test1.sql"))
+	assert.Equal(t, true, strings.Contains(out.String(), "proj1/new/moved.sql"))
+	assert.Equal(t, false, strings.Contains(out.String(), "proj1/deleted.sql"))
+	assert.Equal(t, false, strings.Contains(out.String(), "proj1/plain.sql"))
+	out, code = DoRequest(app, []byte(""), "/v1/files/list?project=proj2", "", http.MethodGet)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, strings.Contains(out.String(), "proj2/new.sql"))
+
+	// a second sync finds nothing to do
+	out, code = DoRequest(app, []byte(""), "/v1/sync", "", http.MethodPost)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, int64(0), gjson.Get(out.String(), "sync.added.#").Int()+gjson.Get(out.String(), "sync.moved.#").Int()+gjson.Get(out.String(), "sync.removed.#").Int())
+	app.Migrations.DoMigrations("down")
+}
+
+func TestGetFileAtRef(t *testing.T) {
+	testcases := []struct {
+		url    string
+		code   int
+		commit string
+	}{
+		{url: "/v1/files?name=proj1-test1-sql", code: http.StatusOK, commit: mocks.MockCommit},
+		{url: "/v1/files?name=proj1-test1-sql&ref=v1.2.0", code: http.StatusOK, commit: mocks.MockCommit},
+		{url: "/v1/files?name=proj1-test1-sql&ref=missing", code: http.StatusNotFound, commit: ""},
+		{url: "/v1/migrations?env=dev&table=abc&ref=v1.2.0", code: http.StatusOK, commit: mocks.MockCommit},
+		{url: "/v1/migrations/all?env=dev&ref=missing", code: http.StatusNotFound, commit: ""},
+	}
+	app := setup(t)
+	app.GIT = &mocks.MockRepo{}
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/test1.sql", Project: "proj1"})
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, []byte(""), tcase.url, "", http.MethodGet)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, tcase.commit, gjson.Get(out.String(), "commit").Str)
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestFileHistoryDiff(t *testing.T) {
+	testcases := []struct {
+		url    string
+		code   int
+		path   string
+		expect string
+	}{
+		{url: "/v1/files/history?name=proj1-test1-sql", code: http.StatusOK, path: "history.0.sha", expect: mocks.MockCommit},
+		{url: "/v1/files/history?name=proj1-test1-sql", code: http.StatusOK, path: "history.1.message", expect: "add proj1/test1.sql"},
+		{url: "/v1/files/history?name=proj1-missing-sql", code: http.StatusNotFound, path: "message", expect: "does not exist"},
+		{url: "/v1/files/diff?name=proj1-test1-sql", code: http.StatusOK, path: "to", expect: mocks.MockCommit},
+		{url: "/v1/files/diff?name=proj1-test1-sql&from=v1.2.0", code: http.StatusOK, path: "diff", expect: "+select * from proj1/test1.sql"},
+		{url: "/v1/files/diff?name=proj1-test1-sql&from=missing", code: http.StatusNotFound, path: "message", expect: "git ref not found"},
+	}
+	app := setup(t)
+	app.GIT = &mocks.MockRepo{}
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/test1.sql", Project: "proj1"})
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, []byte(""), tcase.url, "", http.MethodGet)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, true, strings.Contains(gjson.Get(out.String(), tcase.path).Str, tcase.expect))
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestGitSync(t *testing.T) {
+	app := setup(t)
+	app.GIT = &mocks.MockRepo{}
+	app.Repos = &git.Pool{}
+	app.Repos.Add(git.Remote{URL: "mock"}, app.GIT)
+	app.Config.GitWebhookSecret = "secret"
+	out, code := DoRequest(app, []byte(""), "/v1/git/status", "", http.MethodGet)
+	t.Log(out.String())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, mocks.MockCommit, gjson.Get(out.String(), "git.commit").Str)
+	assert.Equal(t, "", gjson.Get(out.String(), "git.last_error").Str)
+
+	out, code = DoRequest(app, []byte(""), "/v1/git/pull", "", http.MethodPost)
+	t.Log(out.String())
+	assert.Equal(t, http.StatusOK, code)
+
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	testcases := []struct {
+		signature string
+		code      int
+	}{
+		{signature: "sha256=" + hex.EncodeToString(mac.Sum(nil)), code: http.StatusOK},
+		{signature: "sha256=abc", code: http.StatusUnauthorized},
+		{signature: "", code: http.StatusUnauthorized},
+	}
+	// an oversized body is refused before its signature is checked
+	large := bytes.Repeat([]byte("a"), 2<<20)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/v1/git/webhook", bytes.NewBuffer(large))
+	app.Routes().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	for _, tcase := range testcases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/v1/git/webhook", bytes.NewBuffer(body))
+		req.Header.Set("X-Hub-Signature-256", tcase.signature)
+		app.Routes().ServeHTTP(w, req)
+		t.Log(w.Body.String())
+		assert.Equal(t, tcase.code, w.Code)
+	}
+	app.Migrations.DoMigrations("down")
+}
+
+func TestGitRepos(t *testing.T) {
+	app := setup(t)
+	t.Setenv("SQLM_SER_GIT_TOKEN", "server-token")
+	t.Setenv("SQLM_SER_REPO_ANALYTICS_GIT_TOKEN", "analytics-token")
+	cloned := []string{}
+	app.Repos = &git.Pool{Clone: func(remote git.Remote) (git.Repo, error) {
+		if remote.URL == "https://example.com/missing.git" {
+			return nil, errors.New("repository not found")
+		}
+		cloned = append(cloned, remote.URL+"#"+remote.Branch+"#"+remote.Key)
+		return &mocks.MockRepo{}, nil
+	}}
+	app.Repos.Add(git.Remote{URL: "default"}, app.GIT)
+	testcases := []struct {
+		in     []byte
+		url    string
+		method string
+		code   int
+		expect string
+	}{
+		{in: []byte(`{"name":"analytics", "url":"https://example.com/analytics.git", "branch":"main", "credentials_ref":"ANALYTICS_GIT"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusCreated, expect: `"credentials_ref":"ANALYTICS_GIT"`},
+		{in: []byte(`{"name":"analytics", "url":"https://example.com/analytics.git"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "already exists"},
+		{in: []byte(`{"name":"missing", "url":"https://example.com/missing.git"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "unable to clone"},
+		{in: []byte(`{"name":"stolen", "url":"https://example.com/attacker.git", "credentials_ref":"SQLM_SER_GIT"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "credentials_ref"},
+		{in: []byte(`{"name":"stolen", "url":"https://example.com/attacker.git", "credentials_ref":"../HOME"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "credentials_ref"},
+		{in: []byte(`{"name":"secrets", "url":"file:///etc"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "not a path on the server"},
+		{in: []byte(`{"name":"secrets", "url":"/root/.ssh"}`), url: "/v1/git/repos", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "not a path on the server"},
+		{in: []byte(""), url: "/v1/git/repos", method: http.MethodGet, code: http.StatusOK, expect: `"name":"analytics"`},
+		{in: []byte(`{"name":"reporting", "git_repo":"missing"}`), url: "/v1/projects", method: http.MethodPost, code: http.StatusUnprocessableEntity, expect: "must exist"},
+		{in: []byte(`{"name":"reporting", "git_repo":"analytics"}`), url: "/v1/projects", method: http.MethodPost, code: http.StatusCreated, expect: `"git_repo":"analytics"`},
+		{in: []byte(`{"name":"proj1-test1-sql", "project":"reporting"}`), url: "/v1/files", method: http.MethodPatch, code: http.StatusOK, expect: `"project":"reporting"`},
+		{in: []byte(""), url: "/v1/files?name=proj1-test1-sql", method: http.MethodGet, code: http.StatusOK, expect: mocks.MockCommit},
+		{in: []byte(`{"name":"analytics"}`), url: "/v1/git/repos", method: http.MethodDelete, code: http.StatusUnprocessableEntity, expect: "used by a project"},
+		{in: []byte(`{"name":"reporting", "git_repo":""}`), url: "/v1/projects", method: http.MethodPatch, code: http.StatusOK, expect: `"git_repo":""`},
+		{in: []byte(`{"name":"analytics"}`), url: "/v1/git/repos", method: http.MethodDelete, code: http.StatusOK, expect: "deleted"},
+	}
+	app.Models.SQLScript.Register(&data.SQLScript{FileLocation: "proj1/test1.sql", Project: "proj1"})
+	for _, tcase := range testcases {
+		out, code := DoRequest(app, tcase.in, tcase.url, "", tcase.method)
+		t.Log(out.String())
+		assert.Equal(t, tcase.code, code)
+		assert.Equal(t, true, strings.Contains(out.String(), tcase.expect))
+	}
+	assert.Equal(t, []string{"https://example.com/analytics.git#main#analytics-token"}, cloned)
+	app.Migrations.DoMigrations("down")
+}
+
+func TestShutdown(t *testing.T) {
+	log.New("error")
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := api.Config{GitURL: fixture(t), GitSyncInterval: time.Millisecond}
+	app, err := api.NewApplication(ctx, nil, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// let the background pulls run before stopping them
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		app.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background pulls did not stop")
+	}
+}
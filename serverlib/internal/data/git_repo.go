@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrGitRepoNotFound  = errors.New("git repo does not exist")
+	ErrDuplicateGitRepo = errors.New("a git repo with this name already exists")
+	ErrGitRepoInUse     = errors.New("git repo is used by a project")
+)
+
+// GitRepo represents a git repository which projects can be bound to, projects without one use the server's
+// default repository. CredentialsRef names the environment variables holding the credentials, never the
+// credentials themselves
+type GitRepo struct {
+	ID             int        `json:"id"`
+	Name           string     `json:"name"`
+	URL            string     `json:"url"`
+	Branch         string     `json:"branch"`
+	CredentialsRef string     `json:"credentials_ref"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+type GitRepoModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a git repo, names are unique among repos which have not been deleted
+func (m GitRepoModel) Insert(repo *GitRepo) error {
+	query := `
+		insert into git_repo(name, url, branch, credentials_ref, created_at, updated_at)
+		values 		($1, $2, $3, $4, now(), now())
+		returning 	id, created_at, updated_at
+	`
+	args := []interface{}{repo.Name, repo.URL, repo.Branch, repo.CredentialsRef}
+	err := m.DB.QueryRow(query, args...).Scan(&repo.ID, &repo.CreatedAt, &repo.UpdatedAt)
+
+	if err != nil {
+		if strings.Contains(err.Error(), `violates unique constraint "ux_git_repo_name"`) {
+			return ErrDuplicateGitRepo
+		}
+		return fmt.Errorf("unable to add git repo %w", err)
+	}
+	return nil
+}
+
+func (m GitRepoModel) Get(name string) (*GitRepo, error) {
+	query := `
+		select 	id, name, url, branch, credentials_ref, created_at, updated_at
+		from 	git_repo
+		where 	name = $1
+		and 	deleted_at is null
+	`
+	return m.get(query, name)
+}
+
+func (m GitRepoModel) GetByID(id int) (*GitRepo, error) {
+	query := `
+		select 	id, name, url, branch, credentials_ref, created_at, updated_at
+		from 	git_repo
+		where 	id = $1
+		and 	deleted_at is null
+	`
+	return m.get(query, id)
+}
+
+func (m GitRepoModel) get(query string, arg interface{}) (*GitRepo, error) {
+	var repo GitRepo
+	err := m.DB.QueryRow(query, arg).Scan(
+		&repo.ID,
+		&repo.Name,
+		&repo.URL,
+		&repo.Branch,
+		&repo.CredentialsRef,
+		&repo.CreatedAt,
+		&repo.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGitRepoNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &repo, nil
+}
+
+// GetAll returns every git repo which has not been deleted
+func (m GitRepoModel) GetAll() ([]*GitRepo, error) {
+	query := `
+		select 		id, name, url, branch, credentials_ref, created_at, updated_at
+		from 		git_repo
+		where 		deleted_at is null
+		order by 	name asc
+	`
+
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list git repos %w", err)
+	}
+	defer rows.Close()
+
+	repos := []*GitRepo{}
+	for rows.Next() {
+		var repo GitRepo
+		err := rows.Scan(
+			&repo.ID,
+			&repo.Name,
+			&repo.URL,
+			&repo.Branch,
+			&repo.CredentialsRef,
+			&repo.CreatedAt,
+			&repo.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list git repos %w", err)
+		}
+		repos = append(repos, &repo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list git repos %w", err)
+	}
+	return repos, nil
+}
+
+// Delete soft deletes a git repo, repos which projects are bound to cannot be deleted
+func (m GitRepoModel) Delete(name string) error {
+	repo, err := m.Get(name)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+	query := `select exists(select 1 from project where git_repo_id = $1 and deleted_at is null)`
+	err = m.DB.QueryRow(query, repo.ID).Scan(&inUse)
+	if err != nil {
+		return fmt.Errorf("unable to remove git repo %w", err)
+	}
+	if inUse {
+		return ErrGitRepoInUse
+	}
+
+	query = `
+		update 		git_repo
+		set 		deleted_at = now()
+					, updated_at = now()
+		where 		id = $1
+	`
+	_, err = m.DB.Exec(query, repo.ID)
+	if err != nil {
+		return fmt.Errorf("unable to remove git repo %w", err)
+	}
+	return nil
+}
@@ -1,35 +1,81 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 )
 
+// querier runs queries against either the database or a transaction
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
 type Models struct {
 	SQLScript interface {
 		Register(script *SQLScript) error
 		Get(name string) (*SQLScript, error)
-		GetAll(projectName string) ([]*SQLScript, error)
+		List() ([]*SQLScript, error)
+		Update(script *SQLScript) error
+		Remove(script *SQLScript) error
+		GetAll(projectName string, prefix string, filters Filters) ([]*SQLScript, Metadata, error)
 	}
 	SQLMigration interface {
 		Add(mig *SQLMigration) error
+		AddAll(migs []*SQLMigration) error
 		Update(mig *SQLMigration) error
 		Remove(mig *SQLMigration) error
-		GetAll(table string) ([]*SQLMigration, error)
+		Get(id int) (*SQLMigration, error)
+		GetAll(table string, filter SQLMigrationFilter, filters Filters) ([]*SQLMigration, Metadata, error)
 		GetAllByDir(dir string, env string, table string) ([]*SQLMigration, error)
+		GetAllByEnv(env string) ([]*SQLMigration, error)
+		GetByOrder(env string, table string, order int) (*SQLMigration, error)
+	}
+	SQLMigrationDependency interface {
+		Add(dep *SQLMigrationDependency) error
+		GetByEnv(env string) ([]*SQLMigrationDependency, error)
+	}
+	SQLMigrationDAG interface {
+		Get(env string) (*SQLMigrationDAG, error)
+	}
+	SQLMigrationDiff interface {
+		Get(source string, target string) (*SQLMigrationDiff, error)
+	}
+	SQLMigrationSchema interface {
+		Add(schema *SQLMigrationSchema) error
+		GetAll(env string, table string) ([]*SQLMigrationSchema, error)
 	}
 	SQLMigrationGroup interface {
 		Get(env string, table string) (*SQLMigrationGroup, error)
+		GetAll(env string) ([]*SQLMigrationGroup, error)
 	}
 	SQLMigrationsLatest interface {
 		Update(mig *SQLMigrationsLatest) error
+		Undo(mig *SQLMigrationsLatest) error
 		AutoUpdateLatest(env string, table string) error
 		GetByEnv(env string, table string) ([]*SQLMigrationsLatest, error)
 	}
+	SQLMigrationsLatestHistory interface {
+		Add(hist *SQLMigrationsLatestHistory) error
+		GetByEnv(env string, table string) ([]*SQLMigrationsLatestHistory, error)
+	}
 	SQLMigrationTables interface {
-		Get(env string) (*SQLMigrationTables, error)
+		Get(env string, prefix string, filter SQLMigrationFilter, filters Filters) (*SQLMigrationTables, Metadata, error)
 	}
 	Project interface {
+		Insert(project *Project) error
 		Get(name string) (*Project, error)
+		GetAll(filters Filters) ([]*Project, Metadata, error)
+		Update(project *Project) error
+		Delete(name string) error
+	}
+	GitRepo interface {
+		Insert(repo *GitRepo) error
+		Get(name string) (*GitRepo, error)
+		GetByID(id int) (*GitRepo, error)
+		GetAll() ([]*GitRepo, error)
+		Delete(name string) error
 	}
 }
 
@@ -37,9 +83,15 @@ func NewModels(db *sql.DB) Models {
 	return Models{
 		SQLScriptModel{DB: db},
 		SQLMigrationModel{DB: db},
+		SQLMigrationDependencyModel{DB: db},
+		SQLMigrationDAGModel{DB: db},
+		SQLMigrationDiffModel{DB: db},
+		SQLMigrationSchemaModel{DB: db},
 		SQLMigrationGroupModel{DB:db},
 		SQLMigrationsLatestModel{DB: db},
+		SQLMigrationsLatestHistoryModel{DB: db},
 		SQLMigrationTablesModel{DB: db},
 		ProjectModel{DB: db},
+		GitRepoModel{DB: db},
 	}
 }
@@ -1,41 +1,93 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrProjectNotFound  = errors.New("project does not exist")
+	ErrDuplicateProject = errors.New("a project with this name already exists")
 )
 
 type Project struct {
-	Name       string       `json:"name"`
-	ID         int          `json:"id"`
-	SQLScripts []*SQLScript `json:"sql_script"`
+	Name        string       `json:"name"`
+	ID          int          `json:"id"`
+	Description string       `json:"description"`
+	GitRepo     string       `json:"git_repo"`
+	GitRepoID   int          `json:"-"`
+	CreatedAt   *time.Time   `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time   `json:"updated_at,omitempty"`
+	SQLScripts  []*SQLScript `json:"sql_script"`
 }
 
 type ProjectModel struct {
 	DB *sql.DB
 }
 
+// Insert creates a project, names are unique among projects which have not been deleted. The project is bound
+// to the git repo named by GitRepo, or the default repo when it is empty
+func (m ProjectModel) Insert(project *Project) error {
+	query := `
+		insert into project(name, description, git_repo_id, created_at, updated_at)
+		values 		($1, $2, (select id from git_repo where name = $3 and deleted_at is null), now(), now())
+		returning 	id, coalesce(git_repo_id, 0), created_at, updated_at
+	`
+	args := []interface{}{project.Name, project.Description, project.GitRepo}
+	err := m.DB.QueryRow(query, args...).Scan(&project.ID, &project.GitRepoID, &project.CreatedAt, &project.UpdatedAt)
+
+	if err != nil {
+		if isDuplicateProject(err) {
+			return ErrDuplicateProject
+		}
+		return fmt.Errorf("unable to add project %w", err)
+	}
+	return nil
+}
+
 func (m ProjectModel) Get(name string) (*Project, error) {
 
 	query := `
-		select id, name from project where name = $1 and deleted_at is null
+		select 		p.id
+					, p.name
+					, coalesce(p.description, '')
+					, coalesce(g.name, '')
+					, coalesce(p.git_repo_id, 0)
+					, p.created_at
+					, p.updated_at
+		from 		project as p
+		left join 	git_repo as g
+		on 			g.id = p.git_repo_id
+		where 		p.name = $1
+		and 		p.deleted_at is null
 	`
 	var project Project
-	err := m.DB.QueryRow(query, name).Scan(&project.ID, &project.Name)
+	err := m.DB.QueryRow(query, name).Scan(
+		&project.ID,
+		&project.Name,
+		&project.Description,
+		&project.GitRepo,
+		&project.GitRepoID,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
 
 	sqlScriptModel := SQLScriptModel{DB: m.DB}
 
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return nil, fmt.Errorf("project does not exist %w", err)
+			return nil, ErrProjectNotFound
 		default:
 			return nil, err
 		}
 	}
 
-	sqlScripts, err := sqlScriptModel.GetAll(name)
+	sqlScripts, _, err := sqlScriptModel.GetAll(name, "", Filters{Sort: "file_location", SortSafelist: []string{"file_location"}})
 
 	if err != nil {
 		return nil, err
@@ -44,3 +96,114 @@ func (m ProjectModel) Get(name string) (*Project, error) {
 	project.SQLScripts = sqlScripts
 	return &project, nil
 }
+
+// GetAll returns a page of the projects which have not been deleted
+func (m ProjectModel) GetAll(filters Filters) ([]*Project, Metadata, error) {
+	query := fmt.Sprintf(`
+		select 		count(*) over()
+					, p.id
+					, p.name
+					, coalesce(p.description, '')
+					, coalesce(g.name, '')
+					, p.created_at
+					, p.updated_at
+		from 		project as p
+		left join 	git_repo as g
+		on 			g.id = p.git_repo_id
+		where 		p.deleted_at is null
+		order by 	p.%s %s, p.id asc
+		limit 		$1
+		offset 		$2
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("unable to list projects %w", err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	projects := []*Project{}
+	for rows.Next() {
+		var project Project
+		err := rows.Scan(
+			&totalRecords,
+			&project.ID,
+			&project.Name,
+			&project.Description,
+			&project.GitRepo,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, fmt.Errorf("unable to list projects %w", err)
+		}
+		projects = append(projects, &project)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, fmt.Errorf("unable to list projects %w", err)
+	}
+	return projects, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Update renames a project, sets its description and binds it to the git repo named by GitRepo
+func (m ProjectModel) Update(project *Project) error {
+	query := `
+		update 		project
+		set 		name = $1
+					, description = $2
+					, git_repo_id = (select id from git_repo where name = $3 and deleted_at is null)
+					, updated_at = now()
+		where 		id = $4
+		and 		deleted_at is null
+		returning 	coalesce(git_repo_id, 0), updated_at
+	`
+	args := []interface{}{project.Name, project.Description, project.GitRepo, project.ID}
+	err := m.DB.QueryRow(query, args...).Scan(&project.GitRepoID, &project.UpdatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrProjectNotFound
+		case isDuplicateProject(err):
+			return ErrDuplicateProject
+		default:
+			return fmt.Errorf("unable to update project %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete soft deletes a project, its name can then be used by a new project
+func (m ProjectModel) Delete(name string) error {
+	query := `
+		update 		project
+		set 		deleted_at = now()
+					, updated_at = now()
+		where 		name = $1
+		and 		deleted_at is null
+	`
+	result, err := m.DB.Exec(query, name)
+
+	if err != nil {
+		return fmt.Errorf("unable to remove project %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("unable to remove project %w", err)
+	}
+
+	if rows == 0 {
+		return ErrProjectNotFound
+	}
+	return nil
+}
+
+func isDuplicateProject(err error) bool {
+	return strings.Contains(err.Error(), `violates unique constraint "ux_project_name"`)
+}
@@ -2,7 +2,10 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gosimple/slug"
 	"path/filepath"
@@ -12,54 +15,120 @@ import (
 )
 
 type SQLMigration struct {
-	Env            string     `json:"env"`
-	FileID         string     `json:"file_id"`
-	File           string     `json:"file"`
-	FileOrder      int        `json:"file_order"`
-	SourceTable    string     `json:"source_table"`
-	MigratedAt     *time.Time `json:"migrated_at"`
-	MigratedAtNull bool       `json:"migrated_at_null"`
-	ID             int        `json:"id"`
-	Script         string     `json:"script"`
-	Status         *string    `json:"status"`
+	Env             string     `json:"env"`
+	FileID          string     `json:"file_id"`
+	File            string     `json:"file"`
+	FileOrder       int        `json:"file_order"`
+	SourceTable     string     `json:"source_table"`
+	MigratedAt      *time.Time `json:"migrated_at"`
+	MigratedAtNull  bool       `json:"migrated_at_null"`
+	ID              int        `json:"id"`
+	Script          string     `json:"script"`
+	Status          *string    `json:"status"`
+	Checksum        *string    `json:"checksum"`
+	AppliedChecksum *string    `json:"applied_checksum"`
+	CurrentChecksum string     `json:"current_checksum"`
+	Changed         bool       `json:"changed"`
+	Modified        bool       `json:"modified"`
+	ChangedBy       string     `json:"-"`
+	// DependsOn are the migrations of other tables this migration is added with a dependency on
+	DependsOn []*SQLMigration `json:"-"`
+}
+
+// Checksum returns the SHA-256 of a migration script
+func Checksum(script string) string {
+	hash := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(hash[:])
+}
+
+// SetScript attaches the current script to the migration and flags any edits made since it was added or applied
+func (mig *SQLMigration) SetScript(script string) {
+	mig.Script = script
+	mig.CurrentChecksum = Checksum(script)
+	mig.Changed = mig.Checksum != nil && *mig.Checksum != mig.CurrentChecksum
+	mig.Modified = !mig.MigratedAtNull && mig.AppliedChecksum != nil && *mig.AppliedChecksum != mig.CurrentChecksum
+}
+
+// FileOrder returns the order of a migration file named N_name.sql
+func FileOrder(file string) (int, error) {
+	order := strings.Split(filepath.Base(file), "_")
+	if len(order) < 2 {
+		return 0, fmt.Errorf("migration %s is not named N_name.sql", file)
+	}
+	return strconv.Atoi(order[0])
 }
 
 type SQLMigrationModel struct {
 	DB *sql.DB
 }
 
+// Add registers a migration and its dependencies, moving the latest pointer of its table to it
 func (m SQLMigrationModel) Add(mig *SQLMigration) error {
+	return m.AddAll([]*SQLMigration{mig})
+}
+
+// AddAll registers migrations and their dependencies in a single transaction, so either all of them are added or none are,
+// a migration may depend on one added before it in the same call
+func (m SQLMigrationModel) AddAll(migs []*SQLMigration) error {
+	ctx, cancle := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancle()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to add migration %w", err)
+	}
+	defer tx.Rollback()
+
+	envs := make(map[string]bool)
+	for _, mig := range migs {
+		err = addMigration(tx, mig)
+		if err != nil {
+			return err
+		}
+		envs[mig.Env] = true
+	}
+	// a dependency can close a cycle through the file order of a table, so the dag is checked once everything is in
+	for env := range envs {
+		_, err = dagOf(tx, env)
+		if err != nil {
+			return fmt.Errorf("unable to add migration %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func addMigration(q querier, mig *SQLMigration) error {
 
 	fileid := slug.Make(mig.File)
 	fileid = strings.Join(strings.Split(fileid, "."), "-")
 	mig.FileID = fileid
-	file := filepath.Base(mig.File)
-	order := strings.Split(file, "_")
-	if len(order) == 0 {
-		return fmt.Errorf("unable to add migration")
-	}
-	orderInt, err := strconv.Atoi(order[0])
+	orderInt, err := FileOrder(mig.File)
 	if err != nil {
 		return fmt.Errorf("unable to add migration %w", err)
 	}
 
 	query := `
-		insert into sql_migrations(env, file_id, file, file_order, source_table, migrated_at)
-		values 		($1, $2, $3, $4, $5, null)
+		insert into sql_migrations(env, file_id, file, file_order, source_table, migrated_at, checksum)
+		values 		($1, $2, $3, $4, $5, null, $6)
 		returning 	id
 	`
-	args := []interface{}{mig.Env, fileid, mig.File, orderInt, mig.SourceTable}
-	err = m.DB.QueryRow(query, args...).Scan(&mig.ID)
+	args := []interface{}{mig.Env, fileid, mig.File, orderInt, mig.SourceTable, mig.Checksum}
+	err = q.QueryRow(query, args...).Scan(&mig.ID)
 
 	if err != nil {
 		return fmt.Errorf("unable to add project 1 %w", err)
 	}
 
+	oldID, err := latestID(q, mig.Env, mig.SourceTable)
+	if err != nil {
+		return fmt.Errorf("unable to add project 2 %w", err)
+	}
+
 	query = `
 		select id from sql_migrations_latest where source_table = $1 and env = $2
 	`
 	args = []interface{}{mig.SourceTable, mig.Env}
-	result, err := m.DB.Exec(query, args...)
+	result, err := q.Exec(query, args...)
 
 	if err != nil {
 		return fmt.Errorf("unable to add project 2 %w", err)
@@ -77,7 +146,8 @@ func (m SQLMigrationModel) Add(mig *SQLMigration) error {
 			returning 	id
 		`
 		args = []interface{}{mig.ID, mig.SourceTable, mig.Env}
-		err = m.DB.QueryRow(query, args...).Scan(&mig.ID)
+		var latestID int
+		err = q.QueryRow(query, args...).Scan(&latestID)
 		if err != nil {
 			return fmt.Errorf("unable to add project 4 %w", err)
 		}
@@ -89,7 +159,7 @@ func (m SQLMigrationModel) Add(mig *SQLMigration) error {
 			and			source_table 		= $3
 		`
 		args = []interface{}{mig.ID, mig.Env, mig.SourceTable}
-		result, err = m.DB.Exec(query, args...)
+		result, err = q.Exec(query, args...)
 		if err != nil {
 			return fmt.Errorf("unable to add project 5 %w", err)
 		}
@@ -104,9 +174,30 @@ func (m SQLMigrationModel) Add(mig *SQLMigration) error {
 		}
 
 	}
-	return nil
 
+	hist := SQLMigrationsLatestHistory{
+		Env:                mig.Env,
+		Table:              mig.SourceTable,
+		OldSQLMigrationsID: oldID,
+		NewSQLMigrationsID: &mig.ID,
+		ChangedBy:          mig.ChangedBy,
+		Reason:             "migration added",
+	}
+	err = addHistory(q, &hist)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range mig.DependsOn {
+		dep := SQLMigrationDependency{SQLMigrationID: mig.ID, DependsOnID: d.ID}
+		err = addDependency(q, &dep)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
+
 func (m SQLMigrationModel) Update(mig *SQLMigration) error {
 	query := ""
 
@@ -121,14 +212,18 @@ func (m SQLMigrationModel) Update(mig *SQLMigration) error {
 	} else {
 		query = `
 			update 		sql_migrations
-			set			migrated_at 	= now()
-			where		id 				= $1
-			and			env 			= $2
+			set			migrated_at 		= now()
+						, applied_checksum 	= coalesce($3, applied_checksum)
+			where		id 					= $1
+			and			env 				= $2
 			returning 	migrated_at
 		`
 
 	}
 	args := []interface{}{mig.ID, mig.Env}
+	if !mig.MigratedAtNull {
+		args = append(args, mig.AppliedChecksum)
+	}
 	err := m.DB.QueryRow(query, args...).Scan(&mig.MigratedAt)
 
 	if err != nil {
@@ -174,6 +269,23 @@ func (m SQLMigrationModel) Remove(mig *SQLMigration) error {
 			return fmt.Errorf("unable to remove project %w", err)
 		}
 
+		newID, err := latestID(m.DB, mig.Env, mig.SourceTable)
+		if err != nil {
+			return fmt.Errorf("unable to remove project %w", err)
+		}
+		hist := SQLMigrationsLatestHistory{
+			Env:                mig.Env,
+			Table:              mig.SourceTable,
+			OldSQLMigrationsID: &mig.ID,
+			NewSQLMigrationsID: newID,
+			ChangedBy:          mig.ChangedBy,
+			Reason:             "migration removed",
+		}
+		err = SQLMigrationsLatestHistoryModel{DB: m.DB}.Add(&hist)
+		if err != nil {
+			return fmt.Errorf("unable to remove project %w", err)
+		}
+
 	}
 
 	return nil
@@ -194,6 +306,8 @@ func (m SQLMigrationModel) Get(id int) (*SQLMigration, error) {
 					then true
 					else false
 					end as migrated_at_null
+					, m.checksum
+					, m.applied_checksum
 		from 		sql_migrations as m
 		where		m.id = $1
 	`
@@ -210,6 +324,8 @@ func (m SQLMigrationModel) Get(id int) (*SQLMigration, error) {
 		&mig.FileOrder, 
 		&mig.MigratedAt,
 		&mig.MigratedAtNull,
+		&mig.Checksum,
+		&mig.AppliedChecksum,
 	)
 
 	if err != nil {
@@ -219,9 +335,21 @@ func (m SQLMigrationModel) Get(id int) (*SQLMigration, error) {
 	}
 }
 
-func (m SQLMigrationModel) GetAll(table string) ([]*SQLMigration, error) {
-	query := `
-		select 		m.id
+// SQLMigrationSortSafelist are the columns the migrations of a table can be sorted by
+var SQLMigrationSortSafelist = []string{"file_order", "env", "migrated_at", "id", "-file_order", "-env", "-migrated_at", "-id"}
+
+// SQLMigrationFilter narrows the migrations returned for a table, empty fields match everything
+type SQLMigrationFilter struct {
+	Env string
+	// Status is one of applied or pending
+	Status string
+}
+
+// GetAll returns a page of the migrations of a table, ties in the sort column are ordered by env and file order
+func (m SQLMigrationModel) GetAll(table string, filter SQLMigrationFilter, filters Filters) ([]*SQLMigration, Metadata, error) {
+	query := fmt.Sprintf(`
+		select 		count(*) over()
+					, m.id
 					, m.file_id
 					, m.source_table
 					, m.env
@@ -229,27 +357,36 @@ func (m SQLMigrationModel) GetAll(table string) ([]*SQLMigration, error) {
 					, m.file
 					, m.file_order
 					, m.migrated_at
+					, m.checksum
+					, m.applied_checksum
 		from 		sql_migrations as m
 		where 		m.source_table = $1
-	`
+		and 		($2 = '' or m.env = $2)
+		and 		($3 = '' or ($3 = 'applied') = (m.migrated_at is not null))
+		order by 	m.%s %s, m.env asc, m.file_order asc, m.id asc
+		limit 		$4
+		offset 		$5
+	`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancle()
 
-	rows, err := m.DB.QueryContext(ctx, query, table)
+	rows, err := m.DB.QueryContext(ctx, query, table, filter.Env, filter.Status, filters.limit(), filters.offset())
 
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
 	defer rows.Close()
 
+	totalRecords := 0
 	var migs []*SQLMigration
 
 	for rows.Next() {
 		var mig SQLMigration
 
 		err := rows.Scan(
+			&totalRecords,
 			&mig.ID,
 			&mig.FileID,
 			&mig.SourceTable,
@@ -258,19 +395,20 @@ func (m SQLMigrationModel) GetAll(table string) ([]*SQLMigration, error) {
 			&mig.File,
 			&mig.FileOrder,
 			&mig.MigratedAt,
+			&mig.Checksum,
+			&mig.AppliedChecksum,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		migs = append(migs, &mig)
 	}
 
-	if err != nil {
-		return nil, err
-	} else {
-		return migs, nil
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
 	}
+	return migs, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
 }
 
 func (m SQLMigrationModel) GetAllByDir(dir string, env string, table string) ([]*SQLMigration, error) {
@@ -285,14 +423,14 @@ func (m SQLMigrationModel) GetAllByDir(dir string, env string, table string) ([]
 			select
 						sml.source_table
 						, sml.env
-						, sm.file_order
-			from 		sql_migrations as sm
-			inner join 	sql_migrations_latest as sml
+						, coalesce(sm.file_order, 0) as file_order
+			from 		sql_migrations_latest as sml
+			left join 	sql_migrations as sm
 
 			on 			sm.source_table = sml.source_table
 			and 		sm.id 			= sml.sql_migrations_id
-			where 		sm.source_table = $1
-			and 		sm.env 			= $2
+			where 		sml.source_table = $1
+			and 		sml.env 		 = $2
 		)
 		select 		m.id
 					, m.file_id
@@ -306,6 +444,8 @@ func (m SQLMigrationModel) GetAllByDir(dir string, env string, table string) ([]
 					then true
 					else false
 					end as migrated_at_null
+					, m.checksum
+					, m.applied_checksum
 		from 		sql_migrations as m
 
 		inner join 	sql_latest_order as sml 
@@ -341,6 +481,8 @@ func (m SQLMigrationModel) GetAllByDir(dir string, env string, table string) ([]
 			&mig.FileOrder,
 			&mig.MigratedAt,
 			&mig.MigratedAtNull,
+			&mig.Checksum,
+			&mig.AppliedChecksum,
 		)
 		if err != nil {
 			return nil, err
@@ -355,3 +497,95 @@ func (m SQLMigrationModel) GetAllByDir(dir string, env string, table string) ([]
 		return migs, nil
 	}
 }
+
+func (m SQLMigrationModel) GetAllByEnv(env string) ([]*SQLMigration, error) {
+	return migrationsByEnv(m.DB, env)
+}
+
+func migrationsByEnv(q querier, env string) ([]*SQLMigration, error) {
+	query := `
+		select 		m.id
+					, m.file_id
+					, m.source_table
+					, m.env
+					, m.status
+					, m.file
+					, m.file_order
+					, m.migrated_at
+					, case when m.migrated_at is null
+					then true
+					else false
+					end as migrated_at_null
+					, m.checksum
+					, m.applied_checksum
+		from 		sql_migrations as m
+		where 		m.env = $1
+		order by 	m.source_table asc, m.file_order asc
+	`
+
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := q.QueryContext(ctx, query, env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var migs []*SQLMigration
+
+	for rows.Next() {
+		var mig SQLMigration
+
+		err := rows.Scan(
+			&mig.ID,
+			&mig.FileID,
+			&mig.SourceTable,
+			&mig.Env,
+			&mig.Status,
+			&mig.File,
+			&mig.FileOrder,
+			&mig.MigratedAt,
+			&mig.MigratedAtNull,
+			&mig.Checksum,
+			&mig.AppliedChecksum,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		migs = append(migs, &mig)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return migs, nil
+}
+
+func (m SQLMigrationModel) GetByOrder(env string, table string, order int) (*SQLMigration, error) {
+	query := `
+		select 		m.id
+		from 		sql_migrations as m
+		where		m.env 			= $1
+		and 		m.source_table 	= $2
+		and 		m.file_order 	= $3
+		order by 	m.id desc
+		limit 		1
+	`
+
+	var id int
+	err := m.DB.QueryRow(query, env, table, order).Scan(&id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, fmt.Errorf("no migration %d for table %s in env %s", order, table, env)
+		default:
+			return nil, err
+		}
+	}
+	return m.Get(id)
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrMigrationCycle is returned when migration dependencies can not be ordered
+var ErrMigrationCycle = errors.New("migration dependencies contain a cycle")
+
+// SQLMigrationDAG represents every migration in an env along with the order they must be applied in
+type SQLMigrationDAG struct {
+	Env   string                    `json:"env"`
+	Nodes []*SQLMigration           `json:"nodes"`
+	Edges []*SQLMigrationDependency `json:"edges"`
+	Order []int                     `json:"order"`
+}
+
+type SQLMigrationDAGModel struct {
+	DB *sql.DB
+}
+
+func (m SQLMigrationDAGModel) Get(env string) (*SQLMigrationDAG, error) {
+	return dagOf(m.DB, env)
+}
+
+// dagOf loads the migrations of an env and orders them, returning ErrMigrationCycle when they can not be ordered
+func dagOf(q querier, env string) (*SQLMigrationDAG, error) {
+	nodes, err := migrationsByEnv(q, env)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load migration dag %w", err)
+	}
+
+	deps, err := dependenciesByEnv(q, env)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load migration dag %w", err)
+	}
+
+	dag := SQLMigrationDAG{Env: env, Nodes: nodes}
+
+	// migrations within a table are always applied in file order
+	for i := 1; i < len(nodes); i++ {
+		if nodes[i].SourceTable == nodes[i-1].SourceTable {
+			dag.Edges = append(dag.Edges, &SQLMigrationDependency{
+				SQLMigrationID: nodes[i].ID,
+				DependsOnID:    nodes[i-1].ID,
+				Implicit:       true,
+			})
+		}
+	}
+	dag.Edges = append(dag.Edges, deps...)
+
+	dag.Order, err = dag.sort()
+	if err != nil {
+		return nil, err
+	}
+	return &dag, nil
+}
+
+// sort returns the migration ids in topological order, ties are broken by file order then table
+func (dag *SQLMigrationDAG) sort() ([]int, error) {
+	nodes := make(map[int]*SQLMigration)
+	inDegree := make(map[int]int)
+	dependants := make(map[int][]int)
+
+	for _, n := range dag.Nodes {
+		nodes[n.ID] = n
+		inDegree[n.ID] = 0
+	}
+	for _, e := range dag.Edges {
+		if _, ok := nodes[e.DependsOnID]; !ok {
+			continue
+		}
+		inDegree[e.SQLMigrationID]++
+		dependants[e.DependsOnID] = append(dependants[e.DependsOnID], e.SQLMigrationID)
+	}
+
+	var ready []int
+	for id, d := range inDegree {
+		if d == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	var order []int
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			a, b := nodes[ready[i]], nodes[ready[j]]
+			if a.FileOrder != b.FileOrder {
+				return a.FileOrder < b.FileOrder
+			}
+			if a.SourceTable != b.SourceTable {
+				return a.SourceTable < b.SourceTable
+			}
+			return a.ID < b.ID
+		})
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, d := range dependants[id] {
+			inDegree[d]--
+			if inDegree[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if len(order) != len(dag.Nodes) {
+		return nil, ErrMigrationCycle
+	}
+	return order, nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLMigrationDependency records that a migration must be applied after another migration
+type SQLMigrationDependency struct {
+	ID             int  `json:"id"`
+	SQLMigrationID int  `json:"sql_migration_id"`
+	DependsOnID    int  `json:"depends_on_id"`
+	Implicit       bool `json:"implicit"`
+}
+
+type SQLMigrationDependencyModel struct {
+	DB *sql.DB
+}
+
+func (m SQLMigrationDependencyModel) Add(dep *SQLMigrationDependency) error {
+	return addDependency(m.DB, dep)
+}
+
+func addDependency(q querier, dep *SQLMigrationDependency) error {
+	query := `
+		insert into sql_migration_dependencies(sql_migrations_id, depends_on_id, created_at)
+		values 		($1, $2, now())
+		returning 	id
+	`
+	args := []interface{}{dep.SQLMigrationID, dep.DependsOnID}
+	err := q.QueryRow(query, args...).Scan(&dep.ID)
+
+	if err != nil {
+		return fmt.Errorf("unable to add migration dependency %w", err)
+	}
+	return nil
+}
+
+func (m SQLMigrationDependencyModel) GetByEnv(env string) ([]*SQLMigrationDependency, error) {
+	return dependenciesByEnv(m.DB, env)
+}
+
+func dependenciesByEnv(q querier, env string) ([]*SQLMigrationDependency, error) {
+	query := `
+		select 		d.id
+					, d.sql_migrations_id
+					, d.depends_on_id
+		from 		sql_migration_dependencies as d
+		inner join 	sql_migrations as m
+		on 			m.id = d.sql_migrations_id
+		where 		m.env = $1
+		order by 	d.id asc
+	`
+
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := q.QueryContext(ctx, query, env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var deps []*SQLMigrationDependency
+
+	for rows.Next() {
+		var dep SQLMigrationDependency
+
+		err := rows.Scan(
+			&dep.ID,
+			&dep.SQLMigrationID,
+			&dep.DependsOnID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deps = append(deps, &dep)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// SQLMigrationTableDiff represents the differences between the migrations of a table in two envs
+type SQLMigrationTableDiff struct {
+	Table              string          `json:"table"`
+	MissingInTarget    []*SQLMigration `json:"missing_in_target"`
+	MissingInSource    []*SQLMigration `json:"missing_in_source"`
+	NotAppliedInTarget []*SQLMigration `json:"not_applied_in_target"`
+	NotAppliedInSource []*SQLMigration `json:"not_applied_in_source"`
+}
+
+// SQLMigrationDiff represents the differences between the migrations of two envs, split by table
+type SQLMigrationDiff struct {
+	Source string                   `json:"source"`
+	Target string                   `json:"target"`
+	Tables []*SQLMigrationTableDiff `json:"tables"`
+}
+
+type SQLMigrationDiffModel struct {
+	DB *sql.DB
+}
+
+func (m SQLMigrationDiffModel) Get(source string, target string) (*SQLMigrationDiff, error) {
+	migModel := SQLMigrationModel{DB: m.DB}
+
+	sourceMigs, err := migModel.GetAllByEnv(source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load migrations for env %w", err)
+	}
+	targetMigs, err := migModel.GetAllByEnv(target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load migrations for env %w", err)
+	}
+
+	sourceTables := groupByTable(sourceMigs)
+	targetTables := groupByTable(targetMigs)
+
+	var tables []string
+	for t := range sourceTables {
+		tables = append(tables, t)
+	}
+	for t := range targetTables {
+		if _, ok := sourceTables[t]; !ok {
+			tables = append(tables, t)
+		}
+	}
+	sort.Strings(tables)
+
+	diff := SQLMigrationDiff{Source: source, Target: target}
+	for _, t := range tables {
+		tableDiff := diffTable(t, sourceTables[t], targetTables[t])
+		if tableDiff != nil {
+			diff.Tables = append(diff.Tables, tableDiff)
+		}
+	}
+	return &diff, nil
+}
+
+// groupByTable splits migrations by source table, keyed by file
+func groupByTable(migs []*SQLMigration) map[string]map[string]*SQLMigration {
+	tables := make(map[string]map[string]*SQLMigration)
+	for _, mig := range migs {
+		if _, ok := tables[mig.SourceTable]; !ok {
+			tables[mig.SourceTable] = make(map[string]*SQLMigration)
+		}
+		tables[mig.SourceTable][mig.File] = mig
+	}
+	return tables
+}
+
+// diffTable compares the migrations of a table, returning nil if they are the same
+func diffTable(table string, source map[string]*SQLMigration, target map[string]*SQLMigration) *SQLMigrationTableDiff {
+	diff := SQLMigrationTableDiff{Table: table}
+	for file, s := range source {
+		t, ok := target[file]
+		switch {
+		case !ok:
+			diff.MissingInTarget = append(diff.MissingInTarget, s)
+		case s.MigratedAt != nil && t.MigratedAt == nil:
+			diff.NotAppliedInTarget = append(diff.NotAppliedInTarget, t)
+		case s.MigratedAt == nil && t.MigratedAt != nil:
+			diff.NotAppliedInSource = append(diff.NotAppliedInSource, s)
+		}
+	}
+	for file, t := range target {
+		if _, ok := source[file]; !ok {
+			diff.MissingInSource = append(diff.MissingInSource, t)
+		}
+	}
+	if len(diff.MissingInTarget) == 0 && len(diff.MissingInSource) == 0 &&
+		len(diff.NotAppliedInTarget) == 0 && len(diff.NotAppliedInSource) == 0 {
+		return nil
+	}
+	for _, migs := range [][]*SQLMigration{diff.MissingInTarget, diff.MissingInSource, diff.NotAppliedInTarget, diff.NotAppliedInSource} {
+		sort.Slice(migs, func(i, j int) bool { return migs[i].FileOrder < migs[j].FileOrder })
+	}
+	return &diff
+}
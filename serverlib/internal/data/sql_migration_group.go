@@ -40,3 +40,21 @@ func (m SQLMigrationGroupModel) Get(env string, table string) (*SQLMigrationGrou
 
 	return &migGroup, nil
 }
+
+// GetAll returns the migrations of every table in an env
+func (m SQLMigrationGroupModel) GetAll(env string) ([]*SQLMigrationGroup, error) {
+	tables, err := SQLMigrationTablesModel{DB: m.DB}.tables(env)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tables for env %w", err)
+	}
+
+	groups := []*SQLMigrationGroup{}
+	for _, t := range tables {
+		group, err := m.Get(env, t)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
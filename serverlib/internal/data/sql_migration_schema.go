@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SQLMigrationSchema represents the schema of a table captured after a migration was applied
+type SQLMigrationSchema struct {
+	ID             int             `json:"id"`
+	SQLMigrationID int             `json:"sql_migration_id"`
+	Env            string          `json:"env"`
+	SourceTable    string          `json:"source_table"`
+	FileOrder      int             `json:"file_order"`
+	Schema         json.RawMessage `json:"schema"`
+	CapturedAt     time.Time       `json:"captured_at"`
+}
+
+type SQLMigrationSchemaModel struct {
+	DB *sql.DB
+}
+
+func (m SQLMigrationSchemaModel) Add(schema *SQLMigrationSchema) error {
+	query := `
+		insert into sql_migration_schemas(sql_migrations_id, schema)
+		values 		($1, $2)
+		returning 	id, captured_at
+	`
+	args := []interface{}{schema.SQLMigrationID, []byte(schema.Schema)}
+	err := m.DB.QueryRow(query, args...).Scan(&schema.ID, &schema.CapturedAt)
+	if err != nil {
+		return fmt.Errorf("unable to add migration schema %w", err)
+	}
+	return nil
+}
+
+// GetAll returns the latest schema captured for each migration of a table, in migration order
+func (m SQLMigrationSchemaModel) GetAll(env string, table string) ([]*SQLMigrationSchema, error) {
+	query := `
+		select 		distinct on (m.file_order, m.id)
+					s.id
+					, s.sql_migrations_id
+					, m.env
+					, m.source_table
+					, m.file_order
+					, s.schema
+					, s.captured_at
+		from 		sql_migration_schemas as s
+		inner join 	sql_migrations as m
+		on 			m.id 			= s.sql_migrations_id
+		where 		m.env 			= $1
+		and 		m.source_table 	= $2
+		order by 	m.file_order asc, m.id asc, s.captured_at desc, s.id desc
+	`
+
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := m.DB.QueryContext(ctx, query, env, table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var schemas []*SQLMigrationSchema
+
+	for rows.Next() {
+		var schema SQLMigrationSchema
+		var raw []byte
+
+		err := rows.Scan(
+			&schema.ID,
+			&schema.SQLMigrationID,
+			&schema.Env,
+			&schema.SourceTable,
+			&schema.FileOrder,
+			&raw,
+			&schema.CapturedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		schema.Schema = json.RawMessage(raw)
+
+		schemas = append(schemas, &schema)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
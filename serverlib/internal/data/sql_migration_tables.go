@@ -21,27 +21,62 @@ type SQLMigrationTablesModel struct {
 	DB *sql.DB
 }
 
-func (m SQLMigrationTablesModel) Get(env string) (*SQLMigrationTables, error) {
-	tables, err := m.tables(env)
+// Get returns a page of the tables of an env with their migrations, filter.Env is always the env
+func (m SQLMigrationTablesModel) Get(env string, prefix string, filter SQLMigrationFilter, filters Filters) (*SQLMigrationTables, Metadata, error) {
+	filter.Env = env
+
+	query := fmt.Sprintf(`
+		select 		count(*) over()
+					, t.source_table
+		from 		(
+						select 	distinct m.source_table
+						from 	sql_migrations as m
+						where 	m.env = $1
+						and 	left(m.source_table, length($2)) = $2
+						and 	($3 = '' or ($3 = 'applied') = (m.migrated_at is not null))
+					) as t
+		order by 	t.%s %s
+		limit 		$4
+		offset 		$5
+	`, filters.sortColumn(), filters.sortDirection())
 
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := m.DB.QueryContext(ctx, query, env, prefix, filter.Status, filters.limit(), filters.offset())
 	if err != nil {
-		return nil, fmt.Errorf("unable to load migrations for env %w", err)
+		return nil, Metadata{}, fmt.Errorf("unable to load migrations for env %w", err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var tables []string
+	for rows.Next() {
+		var table string
+		err := rows.Scan(&totalRecords, &table)
+		if err != nil {
+			return nil, Metadata{}, fmt.Errorf("unable to load migrations for env %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, fmt.Errorf("unable to load migrations for env %w", err)
 	}
 
-	var migTables SQLMigrationTables
+	migTables := SQLMigrationTables{Env: env, Tables: []*SQLMigrationTable{}}
 	migModel := SQLMigrationModel{DB: m.DB}
+	// every migration of a table is returned, only the tables are paged
+	all := Filters{Sort: "file_order", SortSafelist: SQLMigrationSortSafelist}
 	for _, t := range tables {
-		mig, err := migModel.GetAll(t)
+		mig, _, err := migModel.GetAll(t, filter, all)
 
 		if err != nil {
-			return nil, fmt.Errorf("unable to load migrations for env %w", err)
+			return nil, Metadata{}, fmt.Errorf("unable to load migrations for env %w", err)
 		}
 		migTables.Tables = append(migTables.Tables, &SQLMigrationTable{Table: t, Migrations: mig})
 	}
 
-	migTables.Env = env
-
-	return &migTables, nil
+	return &migTables, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
 
 }
 
@@ -51,6 +86,7 @@ func (m SQLMigrationTablesModel) tables(env string) ([]string, error) {
 		select 	distinct source_table 
 		from 	sql_migrations
 		where 	env = $1
+		order by source_table asc
 	`
 
 	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
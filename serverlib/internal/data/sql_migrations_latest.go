@@ -5,12 +5,15 @@ import (
 	"time"
 	"context"
 	"database/sql"
+	"errors"
 )
 
 type SQLMigrationsLatest struct {
 	Env             string `json:"env"`
 	Table           string `json:"table"`
 	SQLMigrationsID int    `json:"sql_migrations_id"`
+	ChangedBy       string `json:"changed_by"`
+	Reason          string `json:"reason"`
 }
 
 type SQLMigrationsLatestModel struct {
@@ -18,7 +21,76 @@ type SQLMigrationsLatestModel struct {
 	DB *sql.DB
 }
 
+// ErrNothingToUndo is returned when every change to the latest migration pointer of a table has been undone
+var ErrNothingToUndo = errors.New("no latest migration change to undo")
+
+// Update moves the latest migration pointer of a table, recording the move in its history
 func (m SQLMigrationsLatestModel) Update(mig *SQLMigrationsLatest) error {
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to update latest migration %w", err)
+	}
+	defer tx.Rollback()
+
+	err = updateLatest(tx, mig, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Undo moves the latest migration pointer of a table back to where it was before the most recent change which
+// has not been undone, so undoing again steps further back through the history rather than redoing the undo
+func (m SQLMigrationsLatestModel) Undo(mig *SQLMigrationsLatest) error {
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to undo latest migration %w", err)
+	}
+	defer tx.Rollback()
+
+	hists, err := historyByEnv(tx, mig.Env, mig.Table)
+	if err != nil {
+		return fmt.Errorf("unable to undo latest migration %w", err)
+	}
+	undone := make(map[int]bool)
+	var target *SQLMigrationsLatestHistory
+	for _, h := range hists {
+		if h.UndoesID != nil {
+			undone[*h.UndoesID] = true
+			continue
+		}
+		if !undone[h.ID] {
+			target = h
+			break
+		}
+	}
+	if target == nil {
+		return ErrNothingToUndo
+	}
+
+	// an unset pointer restores to base
+	mig.SQLMigrationsID = 0
+	if target.OldSQLMigrationsID != nil {
+		mig.SQLMigrationsID = *target.OldSQLMigrationsID
+	}
+	err = updateLatest(tx, mig, &target.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateLatest(q querier, mig *SQLMigrationsLatest, undoes *int) error {
+	oldID, err := latestID(q, mig.Env, mig.Table)
+	if err != nil {
+		return fmt.Errorf("unable to update latest migration %w", err)
+	}
 
 	query := `
 		update 		sql_migrations_latest
@@ -26,8 +98,13 @@ func (m SQLMigrationsLatestModel) Update(mig *SQLMigrationsLatest) error {
 		where		env 				= $2
 		and			source_table 		= $3
 	`
-	args := []interface{}{mig.SQLMigrationsID, mig.Env, mig.Table}
-	result, err := m.DB.Exec(query, args...)
+	// an id of 0 resets the table to its base, before any migration
+	var id interface{} = mig.SQLMigrationsID
+	if mig.SQLMigrationsID == 0 {
+		id = nil
+	}
+	args := []interface{}{id, mig.Env, mig.Table}
+	result, err := q.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("unable to update latest migration %w", err)
 	}
@@ -41,7 +118,20 @@ func (m SQLMigrationsLatestModel) Update(mig *SQLMigrationsLatest) error {
 		return fmt.Errorf("unable to update latest migration")
 	}
 
-	return nil
+	var newID *int
+	if mig.SQLMigrationsID != 0 {
+		newID = &mig.SQLMigrationsID
+	}
+	hist := SQLMigrationsLatestHistory{
+		Env:                mig.Env,
+		Table:              mig.Table,
+		OldSQLMigrationsID: oldID,
+		NewSQLMigrationsID: newID,
+		ChangedBy:          mig.ChangedBy,
+		Reason:             mig.Reason,
+		UndoesID:           undoes,
+	}
+	return addHistory(q, &hist)
 }
 
 func (m SQLMigrationsLatestModel) GetByEnv(env string, table string) ([]*SQLMigrationsLatest, error) {
@@ -50,7 +140,7 @@ func (m SQLMigrationsLatestModel) GetByEnv(env string, table string) ([]*SQLMigr
 		select
 					sml.source_table
 					, sml.env
-					, sml.sql_migrations_id
+					, coalesce(sml.sql_migrations_id, 0)
 		from 		sql_migrations_latest as sml
 
 		where 		sml.source_table = $1
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLMigrationsLatestHistory represents a single move of the latest migration pointer for a table
+type SQLMigrationsLatestHistory struct {
+	ID                 int       `json:"id"`
+	Env                string    `json:"env"`
+	Table              string    `json:"table"`
+	OldSQLMigrationsID *int      `json:"old_sql_migrations_id"`
+	NewSQLMigrationsID *int      `json:"new_sql_migrations_id"`
+	ChangedBy          string    `json:"changed_by"`
+	ChangedAt          time.Time `json:"changed_at"`
+	Reason             string    `json:"reason"`
+	// UndoesID is the change an undo reverted, nil for any other change
+	UndoesID *int `json:"undoes_id"`
+}
+
+type SQLMigrationsLatestHistoryModel struct {
+	DB *sql.DB
+}
+
+func (m SQLMigrationsLatestHistoryModel) Add(hist *SQLMigrationsLatestHistory) error {
+	return addHistory(m.DB, hist)
+}
+
+func addHistory(q querier, hist *SQLMigrationsLatestHistory) error {
+	query := `
+		insert into sql_migrations_latest_history(env, source_table, old_sql_migrations_id, new_sql_migrations_id, changed_by, reason, undoes_id)
+		values 		($1, $2, $3, $4, $5, $6, $7)
+		returning 	id, changed_at
+	`
+	args := []interface{}{hist.Env, hist.Table, hist.OldSQLMigrationsID, hist.NewSQLMigrationsID, hist.ChangedBy, hist.Reason, hist.UndoesID}
+	err := q.QueryRow(query, args...).Scan(&hist.ID, &hist.ChangedAt)
+	if err != nil {
+		return fmt.Errorf("unable to add latest migration history %w", err)
+	}
+	return nil
+}
+
+// GetByEnv returns the history of the latest migration pointer for a table, most recent first
+func (m SQLMigrationsLatestHistoryModel) GetByEnv(env string, table string) ([]*SQLMigrationsLatestHistory, error) {
+	return historyByEnv(m.DB, env, table)
+}
+
+func historyByEnv(q querier, env string, table string) ([]*SQLMigrationsLatestHistory, error) {
+	query := `
+		select 		h.id
+					, h.env
+					, h.source_table
+					, h.old_sql_migrations_id
+					, h.new_sql_migrations_id
+					, coalesce(h.changed_by, '')
+					, h.changed_at
+					, coalesce(h.reason, '')
+					, h.undoes_id
+		from 		sql_migrations_latest_history as h
+		where 		h.env 			= $1
+		and 		h.source_table 	= $2
+		order by 	h.changed_at desc, h.id desc
+	`
+
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := q.QueryContext(ctx, query, env, table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var hists []*SQLMigrationsLatestHistory
+
+	for rows.Next() {
+		var hist SQLMigrationsLatestHistory
+
+		err := rows.Scan(
+			&hist.ID,
+			&hist.Env,
+			&hist.Table,
+			&hist.OldSQLMigrationsID,
+			&hist.NewSQLMigrationsID,
+			&hist.ChangedBy,
+			&hist.ChangedAt,
+			&hist.Reason,
+			&hist.UndoesID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		hists = append(hists, &hist)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hists, nil
+}
+
+// latestID returns the id the latest migration pointer of a table is set to, nil when at base or unset
+func latestID(q querier, env string, table string) (*int, error) {
+	query := `
+		select 		sql_migrations_id
+		from 		sql_migrations_latest
+		where 		env 			= $1
+		and 		source_table 	= $2
+	`
+	var id *int
+	err := q.QueryRow(query, env, table).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return id, nil
+}
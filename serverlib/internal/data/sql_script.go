@@ -3,12 +3,18 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gosimple/slug"
 )
 
+var (
+	ErrScriptNotFound  = errors.New("script does not exist")
+	ErrDuplicateScript = errors.New("a script with this file location already exists")
+)
+
 type SQLScript struct {
 	ProjectID       int    `json:"project_id"`
 	Project         string `json:"project"`
@@ -18,6 +24,8 @@ type SQLScript struct {
 	SnippitName     string `json:"snippit_name"`
 	SnippitLocation string `json:"snippit_location"`
 	Script          string `json:"script"`
+	// GitRepoID is the git repo of the project, zero for the default repo
+	GitRepoID int `json:"-"`
 }
 
 type SQLScriptModel struct {
@@ -25,9 +33,12 @@ type SQLScriptModel struct {
 }
 
 func (m SQLScriptModel) Register(script *SQLScript) error {
+	// a project is created the first time one of its scripts is registered
 	query := `
 		insert into project(name, created_at, updated_at)
 		values 		($1, now(), now())
+		on conflict (name) where deleted_at is null
+		do update set updated_at = now()
 		returning 	id
 	`
 	args := []interface{}{script.Project}
@@ -67,33 +78,227 @@ func (m SQLScriptModel) Get(name string) (*SQLScript, error) {
 
 	query := `
 		select 		s.name
+					, s.id
 					, gt.location
+					, gt.id
+					, p.name
+					, p.id
+					, coalesce(p.git_repo_id, 0)
 		from 		snippit as s
 		inner join	git as gt 
 		on 			gt.snippit_id = s.id
+		inner join 	project as p
+		on 			p.id = s.project_id
 		where		s.name = $1
+		and 		s.deleted_at is null
+		and 		gt.deleted_at is null
+		and 		p.deleted_at is null
 	`
 
 	var script SQLScript
 
-	err := m.DB.QueryRow(query, name).Scan(&script.SnippitName, &script.FileLocation)
+	err := m.DB.QueryRow(query, name).Scan(
+		&script.SnippitName,
+		&script.SnippitID,
+		&script.FileLocation,
+		&script.FileID,
+		&script.Project,
+		&script.ProjectID,
+		&script.GitRepoID,
+	)
 
 	if err != nil {
-		return nil, err
-	} else {
-		return &script, nil
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrScriptNotFound
+		default:
+			return nil, err
+		}
 	}
+	return &script, nil
 }
 
-func (m SQLScriptModel) GetAll(projectName string) ([]*SQLScript, error) {
+// List returns every script which has not been deleted, across all projects
+func (m SQLScriptModel) List() ([]*SQLScript, error) {
+	query := `
+		select 		p.name
+					, p.id
+					, s.name
+					, s.id
+					, gt.location
+					, gt.id
+					, coalesce(p.git_repo_id, 0)
+		from		project as p
+		inner join 	snippit as s
+		on			p.id = s.project_id
+		inner join	git as gt 
+		on 			gt.snippit_id = s.id
+		where		p.deleted_at is null
+		and 		s.deleted_at is null
+		and 		gt.deleted_at is null
+		order by 	gt.location asc
+	`
 
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list scripts %w", err)
+	}
+	defer rows.Close()
+
+	var scripts []*SQLScript
+	for rows.Next() {
+		var script SQLScript
+		err := rows.Scan(
+			&script.Project,
+			&script.ProjectID,
+			&script.SnippitName,
+			&script.SnippitID,
+			&script.FileLocation,
+			&script.FileID,
+			&script.GitRepoID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list scripts %w", err)
+		}
+		scripts = append(scripts, &script)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list scripts %w", err)
+	}
+	return scripts, nil
+}
+
+// Update moves a script to its file location and project, the project is created if it does not exist
+func (m SQLScriptModel) Update(script *SQLScript) error {
+	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancle()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to update script %w", err)
+	}
+	defer tx.Rollback()
+
+	// a script can only move to a project which exists
 	query := `
-		select 		
-					p.name as project_name
+		select 		id
+		from 		project
+		where 		name = $1
+		and 		deleted_at is null
+	`
+	err = tx.QueryRowContext(ctx, query, script.Project).Scan(&script.ProjectID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrProjectNotFound
+		default:
+			return fmt.Errorf("unable to get project %w", err)
+		}
+	}
+
+	// the name follows the file location so the old location is free to be registered again
+	script.SnippitName = slug.Make(script.FileLocation)
+
+	query = `
+		select 		exists(
+						select 	1
+						from 	snippit
+						where 	name = $1
+						and 	id <> $2
+						and 	deleted_at is null
+					)
+	`
+	var taken bool
+	err = tx.QueryRowContext(ctx, query, script.SnippitName, script.SnippitID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("unable to check snippit %w", err)
+	}
+	if taken {
+		return ErrDuplicateScript
+	}
+
+	query = `
+		update 		snippit
+		set 		project_id = $1
+					, name = $2
+					, updated_at = now()
+		where 		id = $3
+		and 		deleted_at is null
+	`
+	result, err := tx.ExecContext(ctx, query, script.ProjectID, script.SnippitName, script.SnippitID)
+	if err != nil {
+		return fmt.Errorf("unable to update snippit %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrScriptNotFound
+	}
+
+	query = `
+		update 		git
+		set 		location = $1
+					, updated_at = now()
+		where 		id = $2
+		and 		deleted_at is null
+	`
+	result, err = tx.ExecContext(ctx, query, script.FileLocation, script.FileID)
+	if err != nil {
+		return fmt.Errorf("unable to update git %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrScriptNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Remove soft deletes a script and its file location
+func (m SQLScriptModel) Remove(script *SQLScript) error {
+	query := `
+		with s as (
+			update 		snippit
+			set 		deleted_at = now()
+						, updated_at = now()
+			where 		id = $1
+			and 		deleted_at is null
+			returning 	id
+		)
+		update 		git
+		set 		deleted_at = now()
+					, updated_at = now()
+		where 		snippit_id in (select id from s)
+		and 		deleted_at is null
+	`
+	result, err := m.DB.Exec(query, script.SnippitID)
+
+	if err != nil {
+		return fmt.Errorf("unable to remove script %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("unable to remove script %w", err)
+	}
+
+	if rows == 0 {
+		return ErrScriptNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of the scripts of a project, optionally only those whose file location starts with prefix
+func (m SQLScriptModel) GetAll(projectName string, prefix string, filters Filters) ([]*SQLScript, Metadata, error) {
+
+	query := fmt.Sprintf(`
+		select 		count(*) over()
+					, p.name as project_name
 					, p.id as project_id
 					, s.name as snippit_name
 					, s.id as snippit_id
-					, gt.location
+					, gt.location as file_location
 					, gt.id as git_id
 		from		project as p					
 		inner join 	snippit as s
@@ -101,25 +306,34 @@ func (m SQLScriptModel) GetAll(projectName string) ([]*SQLScript, error) {
 		inner join	git as gt 
 		on 			gt.snippit_id = s.id
 		where		p.name = $1
-	`
+		and 		p.deleted_at is null
+		and 		s.deleted_at is null
+		and 		gt.deleted_at is null
+		and 		left(gt.location, length($2)) = $2
+		order by 	%s %s, git_id asc
+		limit 		$3
+		offset 		$4
+	`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancle := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancle()
 
-	rows, err := m.DB.QueryContext(ctx, query, projectName)
+	rows, err := m.DB.QueryContext(ctx, query, projectName, prefix, filters.limit(), filters.offset())
 
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
 	defer rows.Close()
 
-	var scripts []*SQLScript
+	totalRecords := 0
+	scripts := []*SQLScript{}
 
 	for rows.Next() {
 		var script SQLScript
 
 		err := rows.Scan(
+			&totalRecords,
 			&script.Project,
 			&script.ProjectID,
 			&script.SnippitName,
@@ -128,15 +342,14 @@ func (m SQLScriptModel) GetAll(projectName string) ([]*SQLScript, error) {
 			&script.FileID,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		scripts = append(scripts, &script)
 	}
 
-	if err != nil {
-		return nil, err
-	} else {
-		return scripts, nil
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
 	}
+	return scripts, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
 }
@@ -0,0 +1,95 @@
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// AuthKind selects how a remote is authenticated
+type AuthKind string
+
+const (
+	// AuthDefault picks ssh when a key file is set, a token when a username or key is set and anonymous otherwise
+	AuthDefault AuthKind = ""
+	// AuthToken authenticates over https with a username and token
+	AuthToken AuthKind = "token"
+	// AuthSSH authenticates over ssh with a private or deploy key file, checking the host against known_hosts
+	AuthSSH AuthKind = "ssh"
+	// AuthAnonymous clones a public repo without credentials
+	AuthAnonymous AuthKind = "anonymous"
+)
+
+// ParseAuthKind returns the AuthKind named by s
+func ParseAuthKind(s string) (AuthKind, error) {
+	switch kind := AuthKind(s); kind {
+	case AuthDefault, AuthToken, AuthSSH, AuthAnonymous:
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown git auth %s, expected one of token, ssh or anonymous", s)
+}
+
+// kind returns the AuthKind of the remote, inferring it when it is not set
+func (remote Remote) kind() AuthKind {
+	if remote.Auth != AuthDefault {
+		return remote.Auth
+	}
+	switch {
+	case remote.KeyFile != "":
+		return AuthSSH
+	case remote.Username != "" || remote.Key != "":
+		return AuthToken
+	}
+	return AuthAnonymous
+}
+
+// authMethod builds the credentials used to clone and pull the remote
+func (remote Remote) authMethod() (transport.AuthMethod, error) {
+	switch remote.kind() {
+	case AuthToken:
+		return &http.BasicAuth{Username: remote.Username, Password: remote.Key}, nil
+	case AuthSSH:
+		if remote.KeyFile == "" {
+			return nil, fmt.Errorf("ssh auth needs a key file")
+		}
+		user := remote.Username
+		if user == "" {
+			user = "git"
+		}
+		auth, err := ssh.NewPublicKeysFromFile(user, remote.KeyFile, remote.KeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ssh key file %s: %w", remote.KeyFile, err)
+		}
+		// with no file the known_hosts in SSH_KNOWN_HOSTS, ~/.ssh and /etc/ssh are used
+		var files []string
+		if remote.KnownHosts != "" {
+			files = append(files, remote.KnownHosts)
+		}
+		auth.HostKeyCallback, err = ssh.NewKnownHostsCallback(files...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read known_hosts: %w", err)
+		}
+		return auth, nil
+	case AuthAnonymous:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown git auth %s", remote.Auth)
+}
+
+// String describes the remote for logs, leaving out any credentials
+func (remote Remote) String() string {
+	link := remote.URL
+	// scp style ssh urls such as git@host:repo.git cannot hold a password
+	if !strings.Contains(link, "://") {
+		return fmt.Sprintf("%s (%s)", link, remote.kind())
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return fmt.Sprintf("unparsable url (%s)", remote.kind())
+	}
+	return fmt.Sprintf("%s (%s)", u.Redacted(), remote.kind())
+}
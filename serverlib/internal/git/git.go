@@ -1,62 +1,161 @@
 package git
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/c-jamie/sql-manager/serverlib/log"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/memory"
 )
 
+var ErrRefNotFound = errors.New("git ref not found")
+
 // Repo represents a git repository source
 type Repo interface {
 	// GetFile returns a given script from the Repo
 	GetFile(file string) (string, error)
+	// Resolve returns the commit SHA of a branch, tag or commit, an empty ref resolves the default branch
+	Resolve(ref string) (string, error)
+	// GetFileAt returns a given script as it was at a commit SHA returned by Resolve
+	GetFileAt(file string, sha string) (string, error)
+	// History returns the commits which touched a file, newest first
+	History(file string) ([]*Commit, error)
+	// Diff returns a unified diff of a file between two commit SHAs returned by Resolve
+	Diff(file string, from string, to string) (string, error)
+	// ListDir returns the paths of the files in a directory of the Repo
+	ListDir(dir string) ([]string, error)
+	// Files returns the paths of every file in the Repo
+	Files() ([]string, error)
+	// OnPull registers a function which runs each time a pull brings in new commits
+	OnPull(fn func())
+	// Pull brings in new commits from the remote
+	Pull() error
+	// Status reports the outcome of the last pull
+	Status() SyncStatus
+}
+
+// SyncStatus represents the outcome of the last pull
+type SyncStatus struct {
+	URL       string    `json:"url"`
+	Branch    string    `json:"branch"`
+	Commit    string    `json:"commit"`
+	LastSync  time.Time `json:"last_sync"`
+	LastError string    `json:"last_error"`
+}
+
+// Commit represents a commit which touched a file
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// Remote represents a repository to clone, an empty Branch clones the default branch
+type Remote struct {
+	URL    string
+	Branch string
+	// Auth selects the credentials below, by default it is inferred from the ones which are set
+	Auth AuthKind
+	// Username and Key are the https username and token, Username is also the ssh user which defaults to git
+	Username string
+	Key      string
+	// KeyFile is the private or deploy key used over ssh, KnownHosts the file its host is checked against
+	KeyFile       string
+	KeyPassphrase string
+	KnownHosts    string
+	// CredentialsRef names where the credentials were read from, remotes read from different ones get their own clone
+	CredentialsRef string
 }
 
 type repo struct {
-	r    *git.Repository
-	fs   billy.Filesystem
-	Auth *http.BasicAuth
+	r      *git.Repository
+	fs     billy.Filesystem
+	Auth   transport.AuthMethod
+	remote Remote
+	onPull []func()
+	// mu is held for writing while a pull or fetch updates the repo and for reading by everything else
+	mu       sync.RWMutex
+	lastSync time.Time
+	lastErr  error
+	// fetchMu serialises pulls and the fetches of unknown refs and guards lastFetch and misses, the refs a fetch did
+	// not find
+	fetchMu   sync.Mutex
+	lastFetch time.Time
+	misses    map[string]time.Time
 }
 
-func New(repoLink string, username string, key string) (*repo, error) {
+// missTTL is how long a ref a fetch did not find is reported missing without fetching again
+const missTTL = time.Minute
+
+// fetchInterval is the least time between two fetches for unknown refs
+const fetchInterval = 5 * time.Second
+
+// maxMisses bounds the refs remembered as missing
+const maxMisses = 1000
+
+// Clone clones a remote into memory
+func Clone(remote Remote) (*repo, error) {
 	var gitRepo repo
 
 	gitRepo.fs = memfs.New()
-	log.Info(repoLink, " | ", username, " | ", key)
-	if repoLink == "" {
+	gitRepo.remote = remote
+	log.Info("cloning ", remote)
+	if remote.URL == "" {
 		return nil, fmt.Errorf("no git repo link to init")
 	}
+	auth, err := remote.authMethod()
+	if err != nil {
+		return nil, fmt.Errorf("unable to init git: %w", err)
+	}
+	gitRepo.Auth = auth
 	r, err := git.Clone(memory.NewStorage(), gitRepo.fs, &git.CloneOptions{
-		URL:      repoLink,
-		Auth:     &http.BasicAuth{Username: username, Password: key},
-		Progress: os.Stdout,
+		URL:           remote.URL,
+		Auth:          auth,
+		ReferenceName: gitRepo.branch(),
+		Progress:      os.Stdout,
 	})
 
-	gitRepo.Auth = &http.BasicAuth{Username: username, Password: key}
 	if err != nil {
 		log.Error(err)
 		return nil, fmt.Errorf("unable to init git: %w", err)
 	}
 	log.Info("git loaded")
 	gitRepo.r = r
+	gitRepo.lastSync = time.Now()
 	return &gitRepo, nil
 }
 
 func (gt *repo) GetFile(file string) (string, error) {
-	gt.update()
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return readFile(gt.fs, file)
+}
+
+// readFile returns a file from a worktree
+func readFile(fs billy.Filesystem, file string) (string, error) {
 	log.Debug("grabbing: ", file)
-	fo, err := gt.fs.Open(file)
+	fo, err := fs.Open(file)
 	if err != nil {
 		log.Error(fmt.Errorf("error grabbing git file %w", err))
 		return "", err
 	}
+	defer fo.Close()
 	buf, err := ioutil.ReadAll(fo)
 	log.Debug("file is: ", string(buf))
 	if err != nil {
@@ -66,14 +165,380 @@ func (gt *repo) GetFile(file string) (string, error) {
 	return string(buf), nil
 }
 
-func (gt *repo) update() {
-	w, err := gt.r.Worktree()
+func (gt *repo) Resolve(ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	gt.mu.RLock()
+	hash, err := gt.resolve(ref)
+	gt.mu.RUnlock()
+	if err == nil {
+		return hash.String(), nil
+	}
+
+	// branches and tags pushed since the last pull are only known after a fetch, fetches run one at a time
+	// and a ref which is still missing is not fetched again for a while, so unknown refs can not flood the remote
+	gt.fetchMu.Lock()
+	defer gt.fetchMu.Unlock()
+	if at, ok := gt.misses[ref]; ok && time.Since(at) < missTTL {
+		return "", fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+	}
+	// a fetch for another ref may have brought it in while waiting
+	gt.mu.RLock()
+	hash, err = gt.resolve(ref)
+	gt.mu.RUnlock()
+	if err == nil {
+		return hash.String(), nil
+	}
+
+	if time.Since(gt.lastFetch) < fetchInterval {
+		return "", fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+	}
+
+	log.Debug("fetching remote for: ", ref)
+	gt.lastFetch = time.Now()
+	err = gt.fetch()
+	if err != nil {
+		log.Error(fmt.Errorf("error fetching remote: %w", err))
+	}
+	gt.mu.RLock()
+	hash, err = gt.resolve(ref)
+	gt.mu.RUnlock()
+	if err != nil {
+		if gt.misses == nil || len(gt.misses) >= maxMisses {
+			gt.misses = make(map[string]time.Time)
+		}
+		gt.misses[ref] = time.Now()
+		return "", fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+	}
+	return hash.String(), nil
+}
+
+// fetch brings the remote's branches and tags in without holding mu over the network. The fetch runs in a staging
+// repo seeded with the objects and refs already known, so only new objects are downloaded, and they are copied in
+// under the write lock once it is done. The caller holds fetchMu, so nothing else writes to the repo meanwhile
+func (gt *repo) fetch() error {
+	staging, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return err
+	}
+	_, err = staging.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{gt.remote.URL}})
+	if err != nil {
+		return err
+	}
+	gt.mu.RLock()
+	err = copyRepo(gt.r, staging)
+	gt.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	err = staging.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       gt.Auth,
+		RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"},
+		Tags:       git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	return copyRepo(staging, gt.r)
+}
+
+// copyRepo copies the objects missing from one repo to another along with its remote branches and tags
+func copyRepo(from *git.Repository, to *git.Repository) error {
+	objects, err := from.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+	err = objects.ForEach(func(o plumbing.EncodedObject) error {
+		if to.Storer.HasEncodedObject(o.Hash()) == nil {
+			return nil
+		}
+		_, err := to.Storer.SetEncodedObject(o)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	refs, err := from.References()
+	if err != nil {
+		return err
+	}
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsRemote() && !ref.Name().IsTag() {
+			return nil
+		}
+		return to.Storer.SetReference(ref)
+	})
+}
+
+// resolve looks the ref up as a commit, tag or local branch and then as a remote branch
+func (gt *repo) resolve(ref string) (*plumbing.Hash, error) {
+	hash, err := gt.r.ResolveRevision(plumbing.Revision(ref))
+	if err == nil {
+		return hash, nil
+	}
+	return gt.r.ResolveRevision(plumbing.Revision("origin/" + ref))
+}
+
+func (gt *repo) GetFileAt(file string, sha string) (string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return fileAt(gt.r, file, sha)
+}
+
+// fileAt returns a file as it was at a commit SHA
+func fileAt(r *git.Repository, file string, sha string) (string, error) {
+	log.Debug("grabbing: ", file, " at ", sha)
+	commit, err := r.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRefNotFound, sha)
+	}
+	f, err := commit.File(file)
+	if err != nil {
+		log.Error(fmt.Errorf("error grabbing git file %w", err))
+		return "", err
+	}
+	return f.Contents()
+}
+
+func (gt *repo) History(file string) ([]*Commit, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return history(gt.r, &git.LogOptions{FileName: &file})
+}
+
+// history returns the commits matched by the log options, newest first
+func history(r *git.Repository, opts *git.LogOptions) ([]*Commit, error) {
+	log.Debug("history of: ", *opts.FileName)
+	iter, err := r.Log(opts)
+	if err != nil {
+		log.Error(fmt.Errorf("error reading git log %w", err))
+		return nil, err
+	}
+	defer iter.Close()
+	var commits []*Commit
+	err = iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, &Commit{
+			SHA:     c.Hash.String(),
+			Author:  c.Author.Name,
+			Email:   c.Author.Email,
+			Date:    c.Author.When,
+			Message: c.Message,
+		})
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("error reading git log %w", err))
+		return nil, err
+	}
+	return commits, nil
+}
+
+func (gt *repo) Diff(file string, from string, to string) (string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return diffAt(gt.r, file, from, to)
+}
+
+// diffAt returns a unified diff of a file between two commit SHAs
+func diffAt(r *git.Repository, file string, from string, to string) (string, error) {
+	log.Debug("diffing: ", file, " from ", from, " to ", to)
+	fromTree, err := tree(r, from)
+	if err != nil {
+		return "", err
+	}
+	toTree, err := tree(r, to)
+	if err != nil {
+		return "", err
+	}
+	changes, err := fromTree.Diff(toTree)
+	if err != nil {
+		log.Error(fmt.Errorf("error diffing git trees %w", err))
+		return "", err
+	}
+	for _, change := range changes {
+		if change.From.Name != file && change.To.Name != file {
+			continue
+		}
+		patch, err := change.Patch()
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		err = diff.NewUnifiedEncoder(&buf, diff.DefaultContextLines).Encode(patch)
+		if err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	return "", nil
+}
+
+// tree returns the tree of a commit SHA
+func tree(r *git.Repository, sha string) (*object.Tree, error) {
+	commit, err := r.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRefNotFound, sha)
+	}
+	return commit.Tree()
+}
+
+func (gt *repo) ListDir(dir string) ([]string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return listDir(gt.fs, dir)
+}
+
+// listDir returns the paths of the files in a directory of a worktree
+func listDir(fs billy.Filesystem, dir string) ([]string, error) {
+	log.Debug("listing: ", dir)
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		log.Error(fmt.Errorf("error listing git dir %w", err))
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		files = append(files, fs.Join(dir, info.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (gt *repo) Files() ([]string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return allFiles(gt.fs)
+}
+
+// allFiles returns the paths of every file in a worktree
+func allFiles(fs billy.Filesystem) ([]string, error) {
+	log.Debug("listing all files")
+	var files []string
+	err := walk(fs, "", &files)
+	if err != nil {
+		log.Error(fmt.Errorf("error listing git files %w", err))
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// walk appends the files below dir, skipping the .git directory
+func walk(fs billy.Filesystem, dir string, files *[]string) error {
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		path := fs.Join(dir, info.Name())
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				continue
+			}
+			err := walk(fs, path, files)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		*files = append(*files, path)
+	}
+	return nil
+}
+
+func (gt *repo) OnPull(fn func()) {
+	gt.onPull = append(gt.onPull, fn)
+}
+
+func (gt *repo) Pull() error {
+	pulled, err := gt.pull()
+	if err != nil {
+		return err
+	}
+	if pulled {
+		for _, fn := range gt.onPull {
+			fn()
+		}
+	}
+	return nil
+}
+
+// pull updates the worktree, reporting whether new commits were brought in. The fetch runs without the write
+// lock, which is only taken to move the branch and worktree to the fetched commit
+func (gt *repo) pull() (bool, error) {
+	gt.fetchMu.Lock()
+	defer gt.fetchMu.Unlock()
 	log.Debug("pulling remote")
+	err := gt.fetch()
+
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	pulled := false
+	if err == nil {
+		pulled, err = gt.checkout()
+	}
+	if err != nil {
+		err = fmt.Errorf("error pulling remote: %w", err)
+		log.Error(err)
+		gt.lastErr = err
+		return false, err
+	}
+	gt.lastSync = time.Now()
+	gt.lastErr = nil
+	return pulled, nil
+}
+
+// checkout moves the branch and worktree to the fetched commit of the branch, reporting whether it changed
+func (gt *repo) checkout() (bool, error) {
+	head, err := gt.r.Head()
 	if err != nil {
-		log.Error(fmt.Errorf("error loading worktree: %w", err))
+		return false, err
 	}
-	err = w.Pull(&git.PullOptions{Force: true, RemoteName: "origin", Auth: gt.Auth})
+	remote, err := gt.r.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
 	if err != nil {
-		log.Error(fmt.Errorf("error pulling file: %w", err))
+		return false, err
+	}
+	if remote.Hash() == head.Hash() {
+		return false, nil
+	}
+	w, err := gt.r.Worktree()
+	if err != nil {
+		return false, err
+	}
+	// a hard reset matches a forced pull, the worktree is only ever changed by pulls
+	err = w.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.HardReset})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// branch returns the reference of the branch to clone, empty for the default branch
+func (gt *repo) branch() plumbing.ReferenceName {
+	if gt.remote.Branch == "" {
+		return ""
+	}
+	return plumbing.NewBranchReferenceName(gt.remote.Branch)
+}
+
+func (gt *repo) Status() SyncStatus {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	status := SyncStatus{URL: gt.remote.URL, Branch: gt.remote.Branch, LastSync: gt.lastSync}
+	if gt.lastErr != nil {
+		status.LastError = gt.lastErr.Error()
+	}
+	head, err := gt.r.Head()
+	if err == nil {
+		status.Commit = head.Hash().String()
 	}
+	return status
 }
@@ -0,0 +1,252 @@
+package git
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-jamie/sql-manager/serverlib/log"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// initRepo creates a git repo with a worktree in a temp dir
+func initRepo(t *testing.T) (string, *git.Repository) {
+	log.New("error")
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, r
+}
+
+// commit writes files to the worktree of a repo and commits them, an empty content deletes the file
+func commit(t *testing.T, r *git.Repository, message string, files map[string]string) plumbing.Hash {
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		if content == "" {
+			_, err = wt.Remove(file)
+		} else {
+			err = util.WriteFile(wt.Filesystem, file, []byte(content), 0644)
+			if err == nil {
+				_, err = wt.Add(file)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@test.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestHistoryDiff(t *testing.T) {
+	_, r := initRepo(t)
+	first := commit(t, r, "add test1", map[string]string{"proj1/test1.sql": "select 1\n", "proj1/test2.sql": "select 2\n"})
+	second := commit(t, r, "update test1", map[string]string{"proj1/test1.sql": "select 10\n"})
+	third := commit(t, r, "update test2", map[string]string{"proj1/test2.sql": "select 20\n"})
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gt := &repo{r: r, fs: wt.Filesystem}
+
+	commits, err := gt.History("proj1/test1.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].SHA != second.String() || commits[1].SHA != first.String() {
+		t.Errorf(" error history %+v", commits)
+	}
+	if commits[0].Message != "update test1" || commits[0].Author != "test" || commits[0].Email != "test@test.com" {
+		t.Errorf(" error history commit %+v", commits[0])
+	}
+	commits, err = gt.History("proj1/missing.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 0 {
+		t.Errorf(" error history of a missing file %+v", commits)
+	}
+
+	testcases := []struct {
+		file     string
+		from     string
+		to       string
+		contains []string
+		err      bool
+	}{
+		{file: "proj1/test1.sql", from: first.String(), to: second.String(), contains: []string{"--- a/proj1/test1.sql", "+++ b/proj1/test1.sql", "-select 1", "+select 10"}},
+		{file: "proj1/test1.sql", from: second.String(), to: first.String(), contains: []string{"-select 10", "+select 1"}},
+		// test1 did not change between the second and third commits
+		{file: "proj1/test1.sql", from: second.String(), to: third.String(), contains: nil},
+		{file: "proj1/test1.sql", from: strings.Repeat("0", 40), to: third.String(), err: true},
+	}
+	for _, tcase := range testcases {
+		out, err := gt.Diff(tcase.file, tcase.from, tcase.to)
+		if tcase.err {
+			if err == nil {
+				t.Errorf(" error diff expected an error for %s", tcase.from)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tcase.contains == nil && out != "" {
+			t.Errorf(" error diff expected no changes %q", out)
+		}
+		for _, c := range tcase.contains {
+			if !strings.Contains(out, c) {
+				t.Errorf(" error diff %s..%s missing %q in %q", tcase.from[:7], tcase.to[:7], c, out)
+			}
+		}
+	}
+}
+
+func TestResolveFetch(t *testing.T) {
+	dir, origin := initRepo(t)
+	first := commit(t, origin, "add test1", map[string]string{"proj1/test1.sql": "select 1\n"})
+	gt, err := Clone(Remote{URL: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := commit(t, origin, "update test1", map[string]string{"proj1/test1.sql": "select 2\n"})
+	_, err = origin.CreateTag("v1", second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		ref    string
+		expect string
+		// branch is pushed to the origin before resolving
+		branch string
+		// wait clears the last fetch, a fetch straight after another is skipped
+		wait bool
+	}{
+		{ref: "", expect: first.String()},
+		{ref: first.String(), expect: first.String()},
+		{ref: "v1", expect: second.String()},
+		{ref: "feature", expect: "", branch: "feature"},
+		{ref: "feature", expect: first.String(), wait: true},
+		{ref: "missing", expect: "", wait: true},
+	}
+	for _, tcase := range testcases {
+		if tcase.branch != "" {
+			err = origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(tcase.branch), first))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tcase.wait {
+			gt.lastFetch = time.Time{}
+		}
+		sha, err := gt.Resolve(tcase.ref)
+		if tcase.expect == "" {
+			if !errors.Is(err, ErrRefNotFound) {
+				t.Errorf(" error resolve %s expected not found %s %v", tcase.ref, sha, err)
+			}
+			continue
+		}
+		if err != nil || sha != tcase.expect {
+			t.Errorf(" error resolve %s %s %v", tcase.ref, sha, err)
+		}
+	}
+
+	// a missing ref is not fetched again until its miss expires
+	err = origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("missing"), second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gt.lastFetch = time.Time{}
+	_, err = gt.Resolve("missing")
+	if !errors.Is(err, ErrRefNotFound) {
+		t.Errorf(" error resolve expected a cached miss %v", err)
+	}
+	gt.misses["missing"] = time.Now().Add(-missTTL)
+	sha, err := gt.Resolve("missing")
+	if err != nil || sha != second.String() {
+		t.Errorf(" error resolve after the miss expired %s %v", sha, err)
+	}
+	content, err := gt.GetFileAt("proj1/test1.sql", sha)
+	if err != nil || content != "select 2\n" {
+		t.Errorf(" error file at a fetched commit %q %v", content, err)
+	}
+}
+
+func TestPull(t *testing.T) {
+	dir, origin := initRepo(t)
+	first := commit(t, origin, "add test1", map[string]string{"proj1/test1.sql": "select 1\n"})
+	err := origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release"), first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := Clone(Remote{URL: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := Clone(Remote{URL: dir, Branch: "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulls := map[string]int{}
+	head.OnPull(func() { pulls["head"]++ })
+	release.OnPull(func() { pulls["release"]++ })
+
+	second := commit(t, origin, "update test1", map[string]string{"proj1/test1.sql": "select 2\n", "proj1/test2.sql": "select 3\n"})
+	for i := 0; i < 2; i++ {
+		for _, gitRepo := range []*repo{head, release} {
+			err = gitRepo.Pull()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the default branch moves to the new commit, the release branch stays where it was
+	if pulls["head"] != 1 || pulls["release"] != 0 {
+		t.Errorf(" error pull hooks %v", pulls)
+	}
+	testcases := []struct {
+		gitRepo *repo
+		file    string
+		expect  string
+		commit  plumbing.Hash
+	}{
+		{gitRepo: head, file: "proj1/test1.sql", expect: "select 2\n", commit: second},
+		{gitRepo: head, file: "proj1/test2.sql", expect: "select 3\n", commit: second},
+		{gitRepo: release, file: "proj1/test1.sql", expect: "select 1\n", commit: first},
+	}
+	for _, tcase := range testcases {
+		content, err := tcase.gitRepo.GetFile(tcase.file)
+		if err != nil || content != tcase.expect {
+			t.Errorf(" error %s after pull %q %v", tcase.file, content, err)
+		}
+		if status := tcase.gitRepo.Status(); status.Commit != tcase.commit.String() || status.LastError != "" {
+			t.Errorf(" error status after pull %+v", status)
+		}
+	}
+
+	// a failed pull is reported and leaves the clone as it was
+	head.remote.URL = t.TempDir()
+	err = head.Pull()
+	if err == nil || head.Status().LastError == "" {
+		t.Errorf(" error pull expected an error %v %+v", err, head.Status())
+	}
+	content, err := head.GetFile("proj1/test1.sql")
+	if err != nil || content != "select 2\n" {
+		t.Errorf(" error file after a failed pull %q %v", content, err)
+	}
+}
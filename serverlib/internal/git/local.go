@@ -0,0 +1,310 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-jamie/sql-manager/serverlib/log"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// ErrLocalRemote is returned for a url on the disk of the server, which only the server config may serve
+var ErrLocalRemote = errors.New("local git repos can only be set in the server config")
+
+// Open opens a remote, a file:// url is read from disk and any other url is cloned into memory
+func Open(remote Remote) (Repo, error) {
+	root, ok := localPath(remote.URL)
+	if !ok {
+		gitRepo, err := Clone(remote)
+		if err != nil {
+			return nil, err
+		}
+		return gitRepo, nil
+	}
+	// a git repo on disk is opened where it is, cloning it would need the git binary
+	r, err := git.PlainOpen(root)
+	if err == git.ErrRepositoryNotExists {
+		return OpenDir(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open git repo %s: %w", root, err)
+	}
+	gitRepo := &local{r: r, dir: root, remote: remote}
+	gitRepo.head, err = gitRepo.resolveHead()
+	if err != nil {
+		return nil, err
+	}
+	log.Info("opened git repo ", root, " at ", gitRepo.head)
+	gitRepo.lastSync = time.Now()
+	return gitRepo, nil
+}
+
+// localPath returns the path of a file:// url
+func localPath(link string) (string, bool) {
+	if !strings.HasPrefix(link, "file://") {
+		return "", false
+	}
+	return strings.TrimPrefix(link, "file://"), true
+}
+
+// IsLocal reports whether a url points at the disk of the server, either a file:// url or a path
+func IsLocal(link string) bool {
+	if _, ok := localPath(link); ok {
+		return true
+	}
+	endpoint, err := transport.NewEndpoint(link)
+	return err == nil && endpoint.Protocol == "file"
+}
+
+// local is a git repo on disk, bare or with a worktree, scripts are read from its commits and not its worktree
+type local struct {
+	r      *git.Repository
+	dir    string
+	remote Remote
+	onPull []func()
+	// mu is held for writing while a pull moves head and for reading by everything else
+	mu       sync.RWMutex
+	head     plumbing.Hash
+	lastSync time.Time
+	lastErr  error
+}
+
+// resolveHead returns the commit of the branch being served, HEAD when no branch is set
+func (gt *local) resolveHead() (plumbing.Hash, error) {
+	name := plumbing.HEAD
+	if gt.remote.Branch != "" {
+		name = plumbing.NewBranchReferenceName(gt.remote.Branch)
+	}
+	ref, err := gt.r.Reference(name, true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("unable to read %s of git repo %s: %w", name, gt.dir, err)
+	}
+	return ref.Hash(), nil
+}
+
+func (gt *local) GetFile(file string) (string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return fileAt(gt.r, file, gt.head.String())
+}
+
+func (gt *local) Resolve(ref string) (string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	if ref == "" {
+		return gt.head.String(), nil
+	}
+	hash, err := gt.r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+	}
+	return hash.String(), nil
+}
+
+func (gt *local) GetFileAt(file string, sha string) (string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return fileAt(gt.r, file, sha)
+}
+
+func (gt *local) History(file string) ([]*Commit, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return history(gt.r, &git.LogOptions{From: gt.head, FileName: &file})
+}
+
+func (gt *local) Diff(file string, from string, to string) (string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return diffAt(gt.r, file, from, to)
+}
+
+func (gt *local) ListDir(dir string) ([]string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	log.Debug("listing: ", dir)
+	t, err := tree(gt.r, gt.head.String())
+	if err == nil && dir != "" && dir != "." {
+		t, err = t.Tree(dir)
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("error listing git dir %w", err))
+		return nil, err
+	}
+	var files []string
+	for _, entry := range t.Entries {
+		if !entry.Mode.IsFile() {
+			continue
+		}
+		files = append(files, path.Join(dir, entry.Name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (gt *local) Files() ([]string, error) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	log.Debug("listing all files")
+	t, err := tree(gt.r, gt.head.String())
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = t.Files().ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("error listing git files %w", err))
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (gt *local) OnPull(fn func()) {
+	gt.onPull = append(gt.onPull, fn)
+}
+
+func (gt *local) Pull() error {
+	pulled, err := gt.pull()
+	if err != nil {
+		return err
+	}
+	if pulled {
+		for _, fn := range gt.onPull {
+			fn()
+		}
+	}
+	return nil
+}
+
+// pull moves head to the latest commit of the branch, reporting whether it changed
+func (gt *local) pull() (bool, error) {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	log.Debug("reading git repo ", gt.dir)
+	// the repo is opened again as packs written since it was opened are not picked up
+	r, err := git.PlainOpen(gt.dir)
+	if err != nil {
+		err = fmt.Errorf("error opening git repo %s: %w", gt.dir, err)
+		log.Error(err)
+		gt.lastErr = err
+		return false, err
+	}
+	gt.r = r
+	head, err := gt.resolveHead()
+	if err != nil {
+		log.Error(err)
+		gt.lastErr = err
+		return false, err
+	}
+	pulled := head != gt.head
+	gt.head = head
+	gt.lastSync = time.Now()
+	gt.lastErr = nil
+	return pulled, nil
+}
+
+func (gt *local) Status() SyncStatus {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	status := SyncStatus{URL: gt.remote.URL, Branch: gt.remote.Branch, Commit: gt.head.String(), LastSync: gt.lastSync}
+	if gt.lastErr != nil {
+		status.LastError = gt.lastErr.Error()
+	}
+	return status
+}
+
+// scriptDir is a plain directory of scripts, read from disk as they are, it has no commits so the only ref is the empty one
+type scriptDir struct {
+	fs     billy.Filesystem
+	path   string
+	onPull []func()
+	// mu guards lastSync, the files themselves are read without a lock
+	mu       sync.Mutex
+	lastSync time.Time
+}
+
+// OpenDir opens a plain directory of scripts
+func OpenDir(path string) (Repo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open script dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("unable to open script dir: %s is not a directory", path)
+	}
+	log.Info("opened script dir ", path)
+	return &scriptDir{fs: osfs.New(path), path: path, lastSync: time.Now()}, nil
+}
+
+func (gt *scriptDir) GetFile(file string) (string, error) {
+	return readFile(gt.fs, file)
+}
+
+func (gt *scriptDir) Resolve(ref string) (string, error) {
+	if ref != "" {
+		return "", fmt.Errorf("%w: %s, %s is not a git repo", ErrRefNotFound, ref, gt.path)
+	}
+	return "", nil
+}
+
+func (gt *scriptDir) GetFileAt(file string, sha string) (string, error) {
+	if sha != "" {
+		return "", fmt.Errorf("%w: %s, %s is not a git repo", ErrRefNotFound, sha, gt.path)
+	}
+	return readFile(gt.fs, file)
+}
+
+func (gt *scriptDir) History(file string) ([]*Commit, error) {
+	return []*Commit{}, nil
+}
+
+func (gt *scriptDir) Diff(file string, from string, to string) (string, error) {
+	if from != "" || to != "" {
+		return "", fmt.Errorf("%w: %s is not a git repo", ErrRefNotFound, gt.path)
+	}
+	return "", nil
+}
+
+func (gt *scriptDir) ListDir(dir string) ([]string, error) {
+	return listDir(gt.fs, dir)
+}
+
+func (gt *scriptDir) Files() ([]string, error) {
+	return allFiles(gt.fs)
+}
+
+func (gt *scriptDir) OnPull(fn func()) {
+	gt.onPull = append(gt.onPull, fn)
+}
+
+// Pull runs the pull hooks every time, there are no commits to tell whether the files changed
+func (gt *scriptDir) Pull() error {
+	gt.mu.Lock()
+	gt.lastSync = time.Now()
+	gt.mu.Unlock()
+	for _, fn := range gt.onPull {
+		fn()
+	}
+	return nil
+}
+
+func (gt *scriptDir) Status() SyncStatus {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	return SyncStatus{URL: "file://" + gt.path, LastSync: gt.lastSync}
+}
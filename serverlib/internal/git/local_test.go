@@ -0,0 +1,244 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestOpenLocal(t *testing.T) {
+	dir, origin := initRepo(t)
+	first := commit(t, origin, "add scripts", map[string]string{
+		"proj1/test1.sql":     "select 1\n",
+		"proj1/a/test2.sql":   "select 2\n",
+		"proj1/a/b/test3.sql": "select 3\n",
+	})
+	err := origin.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release"), first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bareDir := t.TempDir()
+	bare, err := git.PlainClone(bareDir, true, &git.CloneOptions{URL: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(remote Remote) *local {
+		t.Helper()
+		repo, err := Open(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gitRepo, ok := repo.(*local)
+		if !ok {
+			t.Fatalf(" error open %s expected a local repo got %T", remote, repo)
+		}
+		return gitRepo
+	}
+	worktree := open(Remote{URL: "file://" + dir})
+	branch := open(Remote{URL: "file://" + dir, Branch: "release"})
+	bareRepo := open(Remote{URL: "file://" + bareDir})
+
+	for name, gitRepo := range map[string]*local{"worktree": worktree, "branch": branch, "bare": bareRepo} {
+		sha, err := gitRepo.Resolve("")
+		if err != nil || sha != first.String() {
+			t.Errorf(" error %s head %s %v", name, sha, err)
+		}
+		content, err := gitRepo.GetFile("proj1/test1.sql")
+		if err != nil || content != "select 1\n" {
+			t.Errorf(" error %s file %q %v", name, content, err)
+		}
+		files, err := gitRepo.Files()
+		if err != nil || strings.Join(files, ",") != "proj1/a/b/test3.sql,proj1/a/test2.sql,proj1/test1.sql" {
+			t.Errorf(" error %s files %v %v", name, files, err)
+		}
+	}
+
+	testcases := []struct {
+		dir    string
+		expect []string
+		err    bool
+	}{
+		{dir: "", expect: nil},
+		{dir: ".", expect: nil},
+		{dir: "proj1", expect: []string{"proj1/test1.sql"}},
+		{dir: "proj1/a", expect: []string{"proj1/a/test2.sql"}},
+		{dir: "proj1/a/b", expect: []string{"proj1/a/b/test3.sql"}},
+		{dir: "proj1/missing", err: true},
+	}
+	for _, tcase := range testcases {
+		files, err := worktree.ListDir(tcase.dir)
+		if tcase.err {
+			if err == nil {
+				t.Errorf(" error list %s expected an error got %v", tcase.dir, files)
+			}
+			continue
+		}
+		if err != nil || strings.Join(files, ",") != strings.Join(tcase.expect, ",") {
+			t.Errorf(" error list %s %v %v", tcase.dir, files, err)
+		}
+	}
+
+	// scripts are read from commits, an uncommitted change in the worktree is not served
+	err = os.WriteFile(filepath.Join(dir, "proj1", "test1.sql"), []byte("select 100\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := worktree.GetFile("proj1/test1.sql")
+	if err != nil || content != "select 1\n" {
+		t.Errorf(" error uncommitted file was served %q %v", content, err)
+	}
+
+	second := commit(t, origin, "update test1", map[string]string{"proj1/test1.sql": "select 10\n"})
+	pulls := map[string]int{}
+	worktree.OnPull(func() { pulls["worktree"]++ })
+	branch.OnPull(func() { pulls["branch"]++ })
+	bareRepo.OnPull(func() { pulls["bare"]++ })
+	for i := 0; i < 2; i++ {
+		for _, gitRepo := range []*local{worktree, branch} {
+			err = gitRepo.Pull()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// HEAD follows the new commit, the release branch stays where it was
+	if pulls["worktree"] != 1 || pulls["branch"] != 0 {
+		t.Errorf(" error pull hooks %v", pulls)
+	}
+	content, err = worktree.GetFile("proj1/test1.sql")
+	if err != nil || content != "select 10\n" {
+		t.Errorf(" error file after pull %q %v", content, err)
+	}
+	if status := worktree.Status(); status.Commit != second.String() || status.LastError != "" {
+		t.Errorf(" error status after pull %+v", status)
+	}
+	if status := branch.Status(); status.Commit != first.String() || status.Branch != "release" {
+		t.Errorf(" error status of the branch %+v", status)
+	}
+	commits, err := worktree.History("proj1/test1.sql")
+	if err != nil || len(commits) != 2 || commits[0].SHA != second.String() {
+		t.Errorf(" error history after pull %+v %v", commits, err)
+	}
+
+	// objects fetched into a bare repo after it was opened are read on the next pull
+	err = bare.Fetch(&git.FetchOptions{RefSpecs: []config.RefSpec{"+refs/heads/*:refs/heads/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bareRepo.Pull()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = bareRepo.GetFile("proj1/test1.sql")
+	if err != nil || content != "select 10\n" || pulls["bare"] != 1 {
+		t.Errorf(" error bare repo after pull %q %v %v", content, err, pulls)
+	}
+
+	_, err = Open(Remote{URL: "file://" + dir, Branch: "missing"})
+	if err == nil {
+		t.Error(" error open expected an error for a missing branch")
+	}
+}
+
+func TestOpenDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "scripts")
+	for file, content := range map[string]string{"proj1/test1.sql": "select 1\n", "proj1/a/test2.sql": "select 2\n"} {
+		path := filepath.Join(dir, file)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a file:// url of a directory which is not a git repo is opened as a plain directory
+	repo, err := Open(Remote{URL: "file://" + dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.(*scriptDir); !ok {
+		t.Fatalf(" error open expected a script dir got %T", repo)
+	}
+	_, err = OpenDir(filepath.Join(root, "missing"))
+	if err == nil {
+		t.Error(" error open dir expected an error for a missing dir")
+	}
+	_, err = OpenDir(filepath.Join(dir, "proj1", "test1.sql"))
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf(" error open dir expected an error for a file %v", err)
+	}
+
+	content, err := repo.GetFile("proj1/test1.sql")
+	if err != nil || content != "select 1\n" {
+		t.Errorf(" error file %q %v", content, err)
+	}
+	// the files are read as they are on disk
+	err = os.WriteFile(filepath.Join(dir, "proj1", "test1.sql"), []byte("select 10\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = repo.GetFileAt("proj1/test1.sql", "")
+	if err != nil || content != "select 10\n" {
+		t.Errorf(" error file after a change %q %v", content, err)
+	}
+
+	sha, err := repo.Resolve("")
+	if err != nil || sha != "" {
+		t.Errorf(" error resolve head %q %v", sha, err)
+	}
+	_, err = repo.Resolve("v1")
+	if !errors.Is(err, ErrRefNotFound) {
+		t.Errorf(" error resolve expected not found %v", err)
+	}
+	_, err = repo.GetFileAt("proj1/test1.sql", strings.Repeat("0", 40))
+	if !errors.Is(err, ErrRefNotFound) {
+		t.Errorf(" error file at expected not found %v", err)
+	}
+	_, err = repo.Diff("proj1/test1.sql", "v1", "")
+	if !errors.Is(err, ErrRefNotFound) {
+		t.Errorf(" error diff expected not found %v", err)
+	}
+	commits, err := repo.History("proj1/test1.sql")
+	if err != nil || len(commits) != 0 {
+		t.Errorf(" error history %v %v", commits, err)
+	}
+
+	files, err := repo.ListDir("proj1")
+	if err != nil || strings.Join(files, ",") != "proj1/test1.sql" {
+		t.Errorf(" error list %v %v", files, err)
+	}
+	files, err = repo.ListDir("proj1/a")
+	if err != nil || strings.Join(files, ",") != "proj1/a/test2.sql" {
+		t.Errorf(" error list subtree %v %v", files, err)
+	}
+	files, err = repo.Files()
+	if err != nil || strings.Join(files, ",") != "proj1/a/test2.sql,proj1/test1.sql" {
+		t.Errorf(" error files %v %v", files, err)
+	}
+
+	// there are no commits to compare so every pull runs the hooks
+	pulls := 0
+	repo.OnPull(func() { pulls++ })
+	for i := 0; i < 2; i++ {
+		err = repo.Pull()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pulls != 2 {
+		t.Errorf(" error pull hooks ran %d times", pulls)
+	}
+	if status := repo.Status(); status.URL != "file://"+dir || status.LastSync.IsZero() {
+		t.Errorf(" error status %+v", status)
+	}
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pool keeps one clone of each remote, a remote is cloned the first time it is used
+type Pool struct {
+	// Clone clones a remote, it defaults to Clone. Remotes on the disk of the server are never cloned
+	Clone func(remote Remote) (Repo, error)
+
+	mu      sync.Mutex
+	repos   map[string]Repo
+	keys    []string
+	pending map[string]*cloneCall
+}
+
+// cloneCall is a clone in progress, callers asking for the same remote wait on done
+type cloneCall struct {
+	done chan struct{}
+	repo Repo
+	err  error
+}
+
+// key identifies a clone. It holds the credentials ref but not the credentials, so rotating them does not clone
+// the remote again while a clone made with one set of credentials is never handed to a caller with another
+func key(remote Remote) string {
+	return remote.URL + "#" + remote.Branch + "#" + remote.CredentialsRef
+}
+
+// Add puts an existing clone of a remote in the pool
+func (p *Pool) Add(remote Remote, repo Repo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.add(key(remote), repo)
+}
+
+func (p *Pool) add(k string, repo Repo) {
+	if p.repos == nil {
+		p.repos = make(map[string]Repo)
+	}
+	if _, ok := p.repos[k]; !ok {
+		p.keys = append(p.keys, k)
+	}
+	p.repos[k] = repo
+}
+
+// Get returns the clone of a remote, cloning it if it is not in the pool.
+// The clone runs outside the pool lock, concurrent calls for the same remote share one clone
+func (p *Pool) Get(remote Remote) (Repo, error) {
+	if IsLocal(remote.URL) {
+		return nil, fmt.Errorf("%w: %s", ErrLocalRemote, remote)
+	}
+	k := key(remote)
+	p.mu.Lock()
+	if repo, ok := p.repos[k]; ok {
+		p.mu.Unlock()
+		return repo, nil
+	}
+	if call, ok := p.pending[k]; ok {
+		p.mu.Unlock()
+		<-call.done
+		return call.repo, call.err
+	}
+	if p.pending == nil {
+		p.pending = make(map[string]*cloneCall)
+	}
+	call := &cloneCall{done: make(chan struct{})}
+	p.pending[k] = call
+	p.mu.Unlock()
+
+	clone := p.Clone
+	if clone == nil {
+		clone = cloneRepo
+	}
+	call.repo, call.err = clone(remote)
+
+	p.mu.Lock()
+	delete(p.pending, k)
+	if call.err == nil {
+		p.add(k, call.repo)
+	}
+	p.mu.Unlock()
+	close(call.done)
+	return call.repo, call.err
+}
+
+// cloneRepo clones a remote into memory, it is the default Clone of a pool
+func cloneRepo(remote Remote) (Repo, error) {
+	gitRepo, err := Clone(remote)
+	if err != nil {
+		return nil, err
+	}
+	return gitRepo, nil
+}
+
+// all returns every clone in the order they were added
+func (p *Pool) all() []Repo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	repos := make([]Repo, 0, len(p.keys))
+	for _, k := range p.keys {
+		repos = append(repos, p.repos[k])
+	}
+	return repos
+}
+
+// Pull pulls every clone, returning the first error
+func (p *Pool) Pull() error {
+	var first error
+	for _, repo := range p.all() {
+		err := repo.Pull()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Watch pulls every clone each interval until the context is cancelled
+func (p *Pool) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Pull()
+		}
+	}
+}
+
+// Status reports the outcome of the last pull of every clone
+func (p *Pool) Status() []SyncStatus {
+	repos := p.all()
+	status := make([]SyncStatus, 0, len(repos))
+	for _, repo := range repos {
+		status = append(status, repo.Status())
+	}
+	return status
+}
@@ -0,0 +1,106 @@
+package git
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolGet(t *testing.T) {
+	release := make(chan struct{})
+	var clones int32
+	p := &Pool{Clone: func(remote Remote) (Repo, error) {
+		atomic.AddInt32(&clones, 1)
+		switch remote.URL {
+		case "https://example.com/slow.git":
+			<-release
+		case "https://example.com/broken.git":
+			return nil, errors.New("unable to clone")
+		}
+		return &repo{remote: remote}, nil
+	}}
+
+	var wg sync.WaitGroup
+	repos := make([]Repo, 5)
+	for i := range repos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repo, err := p.Get(Remote{URL: "https://example.com/slow.git"})
+			if err != nil {
+				t.Error(err)
+			}
+			repos[i] = repo
+		}(i)
+	}
+
+	// another remote is not blocked by the slow clone
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := p.Get(Remote{URL: "https://example.com/fast.git"})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(" error get was blocked by the clone of another remote")
+	}
+
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&clones); n != 2 {
+		t.Errorf(" error expected 2 clones got %d", n)
+	}
+	for _, repo := range repos {
+		if repo == nil || repo != repos[0] {
+			t.Errorf(" error concurrent gets returned different clones %v", repos)
+			break
+		}
+	}
+
+	// a failed clone is not kept in the pool
+	for i := 0; i < 2; i++ {
+		_, err := p.Get(Remote{URL: "https://example.com/broken.git"})
+		if err == nil {
+			t.Error(" error get expected a clone error")
+		}
+	}
+	if n := atomic.LoadInt32(&clones); n != 4 {
+		t.Errorf(" error expected a failed clone to be retried got %d clones", n)
+	}
+	if n := len(p.all()); n != 2 {
+		t.Errorf(" error expected 2 clones in the pool got %d", n)
+	}
+
+	// a remote read with other credentials gets its own clone
+	public, err := p.Get(Remote{URL: "https://example.com/fast.git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := p.Get(Remote{URL: "https://example.com/fast.git", Key: "token", CredentialsRef: "PRIVATE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public == private {
+		t.Error(" error remotes with different credentials shared a clone")
+	}
+	if n := atomic.LoadInt32(&clones); n != 5 {
+		t.Errorf(" error expected a clone for the other credentials got %d clones", n)
+	}
+
+	// the disk of the server is never cloned
+	for _, link := range []string{"file:///etc", "/etc", "../repo", "repo"} {
+		_, err := p.Get(Remote{URL: link})
+		if !errors.Is(err, ErrLocalRemote) {
+			t.Errorf(" error get %s expected a local remote error got %v", link, err)
+		}
+	}
+	if n := atomic.LoadInt32(&clones); n != 5 {
+		t.Errorf(" error a local remote was cloned got %d clones", n)
+	}
+}
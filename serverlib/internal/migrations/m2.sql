@@ -0,0 +1,11 @@
+-- +migrate Up
+alter table sql_migrations add column checksum varchar(64) null;
+
+-- +migrate Up
+alter table sql_migrations add column applied_checksum varchar(64) null;
+
+-- +migrate Down
+alter table sql_migrations drop column if exists applied_checksum;
+
+-- +migrate Down
+alter table sql_migrations drop column if exists checksum;
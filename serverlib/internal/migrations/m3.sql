@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE sql_migration_dependencies (
+	id int GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY
+  , sql_migrations_id int not null
+  , depends_on_id int not null
+  , created_at timestamp
+  , unique (sql_migrations_id, depends_on_id)
+);
+
+-- +migrate Up
+alter table sql_migration_dependencies add constraint fk_dep_sql_migrations_id foreign key(sql_migrations_id) references sql_migrations(id) on delete cascade;
+
+-- +migrate Up
+alter table sql_migration_dependencies add constraint fk_dep_depends_on_id foreign key(depends_on_id) references sql_migrations(id) on delete cascade;
+
+-- +migrate Down
+drop table if exists sql_migration_dependencies;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE sql_migrations_latest_history (
+	id int GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY
+  , env varchar(20) not null
+  , source_table varchar(255) not null
+  , old_sql_migrations_id int
+  , new_sql_migrations_id int
+  , changed_by varchar(255)
+  , changed_at timestamp not null default now()
+  , reason text
+);
+
+-- +migrate Down
+drop table if exists sql_migrations_latest_history;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE sql_migration_schemas (
+	id int GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY
+  , sql_migrations_id int not null
+  , schema jsonb not null
+  , captured_at timestamp not null default now()
+);
+
+-- +migrate Up
+alter table sql_migration_schemas add constraint fk_schema_sql_migrations_id foreign key(sql_migrations_id) references sql_migrations(id) on delete cascade;
+
+-- +migrate Down
+drop table if exists sql_migration_schemas;
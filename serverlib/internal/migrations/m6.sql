@@ -0,0 +1,29 @@
+-- +migrate Up
+update snippit as s
+set 		project_id = d.keep_id
+from 		(
+				select 	p.id
+						, min(p.id) over (partition by p.name) as keep_id
+				from 	project as p
+				where 	p.deleted_at is null
+			) as d
+where 		s.project_id = d.id
+and 		d.id <> d.keep_id;
+
+-- +migrate Up
+delete from project as p
+using 		project as k
+where 		k.name = p.name
+and 		k.id < p.id
+and 		k.deleted_at is null
+and 		p.deleted_at is null;
+
+-- +migrate Up
+alter table project add column description text null;
+
+-- +migrate Up
+create unique index ux_project_name on project (name) where deleted_at is null;
+
+-- +migrate Down
+drop index if exists ux_project_name;
+alter table project drop column if exists description;
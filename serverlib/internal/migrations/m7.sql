@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE git_repo (
+	id int GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY
+  , name text not null
+  , url text not null
+  , branch text not null default ''
+  , credentials_ref text not null default ''
+  , created_at timestamp
+  , updated_at timestamp
+  , deleted_at timestamp
+);
+
+-- +migrate Up
+create unique index ux_git_repo_name on git_repo (name) where deleted_at is null;
+
+-- +migrate Up
+alter table project add column git_repo_id int null;
+
+-- +migrate Up
+alter table project add constraint fk_project_git_repo_id foreign key(git_repo_id) references git_repo(id);
+
+-- +migrate Down
+alter table project drop constraint if exists fk_project_git_repo_id;
+alter table project drop column if exists git_repo_id;
+drop table if exists git_repo;
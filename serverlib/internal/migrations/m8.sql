@@ -0,0 +1,5 @@
+-- +migrate Up
+alter table sql_migrations_latest_history add column undoes_id int null;
+
+-- +migrate Down
+alter table sql_migrations_latest_history drop column if exists undoes_id;
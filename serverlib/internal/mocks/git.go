@@ -1,10 +1,80 @@
 package mocks
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/c-jamie/sql-manager/serverlib/internal/git"
+)
 
 type MockRepo struct {
+	// Dirs overrides the files listed in a directory
+	Dirs map[string][]string
+	// Scripts are files listed along with the default files, with their contents
+	Scripts map[string]string
+	// Deleted are files no longer listed, with the contents they had in the commits which still had them
+	Deleted map[string]string
 }
 
 func (mi *MockRepo) GetFile(file string) (string, error) {
+	if sql, ok := mi.Scripts[file]; ok {
+		return sql, nil
+	}
 	return fmt.Sprintf("select * from %s", file), nil
 }
+
+// MockCommit is the SHA every ref resolves to
+const MockCommit = "0123456789abcdef0123456789abcdef01234567"
+
+func (mi *MockRepo) Resolve(ref string) (string, error) {
+	if ref == "missing" {
+		return "", fmt.Errorf("%w: %s", git.ErrRefNotFound, ref)
+	}
+	return MockCommit, nil
+}
+
+func (mi *MockRepo) GetFileAt(file string, sha string) (string, error) {
+	if sql, ok := mi.Deleted[file]; ok {
+		return sql, nil
+	}
+	return fmt.Sprintf("select * from %s", file), nil
+}
+
+func (mi *MockRepo) History(file string) ([]*git.Commit, error) {
+	return []*git.Commit{
+		{SHA: MockCommit, Author: "test", Email: "test@test.com", Date: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), Message: "update " + file},
+		{SHA: "fedcba9876543210fedcba9876543210fedcba98", Author: "test", Email: "test@test.com", Date: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Message: "add " + file},
+	}, nil
+}
+
+func (mi *MockRepo) Diff(file string, from string, to string) (string, error) {
+	return fmt.Sprintf("--- a/%s\n+++ b/%s\n@@ -1 +1 @@\n-select 1\n+select * from %s\n", file, file, file), nil
+}
+
+func (mi *MockRepo) ListDir(dir string) ([]string, error) {
+	if files, ok := mi.Dirs[dir]; ok {
+		return files, nil
+	}
+	return []string{dir + "/1_init.sql", dir + "/2_update.sql"}, nil
+}
+
+func (mi *MockRepo) Files() ([]string, error) {
+	files := []string{"dir1/1_init.sql", "proj1/test1.sql"}
+	for f := range mi.Scripts {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (mi *MockRepo) OnPull(fn func()) {
+}
+
+func (mi *MockRepo) Pull() error {
+	return nil
+}
+
+func (mi *MockRepo) Status() git.SyncStatus {
+	return git.SyncStatus{URL: "mock", Commit: MockCommit, LastSync: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)}
+}
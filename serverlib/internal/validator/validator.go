@@ -1,5 +1,7 @@
 package validator
 
+import "regexp"
+
 type Validator struct {
 	Errors map[string]string
 }
@@ -25,6 +27,10 @@ func (v *Validator) Check(ok bool, key, message string) {
 }
 
 
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
 func In(value string, list ...string) bool {
 	for i := range list {
 		if value == list[i] {